@@ -0,0 +1,207 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// DefaultDropReportInterval is the default minimum interval between drop reports of an async sink.
+const DefaultDropReportInterval = 10 * time.Second
+
+// asyncSink is a sink that hands entries to a background goroutine through a bounded queue.
+// Entries are dropped instead of blocking the caller when the queue is full.
+// Drops are reported by a structured entry written at most once per interval.
+// Flushes are requests queued behind the entries, so that a flush only waits
+// for the entries queued before it, even under constant load.
+type asyncSink struct {
+	out      sink
+	queue    chan asyncItem
+	dropped  atomic.Uint64
+	interval time.Duration
+	done     chan struct{}
+
+	// mu guards closed, it is held for writing only while closing,
+	// so that no item is queued after the queue has been drained.
+	mu     sync.RWMutex
+	closed bool
+
+	// lastReport is only accessed by the background goroutine.
+	lastReport time.Time
+}
+
+// asyncItem is an item of the queue of an asyncSink,
+// either an entry or a flush request.
+type asyncItem struct {
+	entry logging.Entry
+
+	// flushed receives the result of the flush, if the item is a flush request.
+	flushed chan error
+}
+
+// newAsyncSink creates a new asyncSink writing to the given sink and starts its goroutine.
+// The goroutine runs until the sink is closed.
+//
+// Parameters:
+// - out: The sink to write entries to.
+// - size: The capacity of the queue.
+// - interval: The minimum interval between drop reports, DefaultDropReportInterval if zero.
+//
+// Returns:
+// - A new asyncSink.
+func newAsyncSink(out sink, size int, interval time.Duration) *asyncSink {
+	if interval <= 0 {
+		interval = DefaultDropReportInterval
+	}
+	s := &asyncSink{
+		out:      out,
+		queue:    make(chan asyncItem, size),
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	go s.run()
+
+	return s
+}
+
+// run writes the queued entries to the underlying sink and answers flush requests,
+// until the queue is closed.
+func (s *asyncSink) run() {
+	defer close(s.done)
+	for item := range s.queue {
+		if item.flushed != nil {
+			s.reportDrops(true)
+			item.flushed <- s.out.Flush()
+			continue
+		}
+		s.out.Log(item.entry)
+		s.reportDrops(false)
+	}
+	s.reportDrops(true)
+}
+
+// Log queues the given entry, or drops it if the queue is full. It never blocks.
+// Once the sink is closed, the entry is written to the underlying sink directly.
+//
+// Parameters:
+// - e: The entry to queue.
+func (s *asyncSink) Log(e logging.Entry) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		s.out.Log(e)
+		return
+	}
+
+	select {
+	case s.queue <- asyncItem{entry: e}:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Flush waits for the entries queued before the call to be written, reports pending drops
+// and flushes the underlying sink. Entries queued concurrently are not waited for.
+//
+// Returns:
+// - An error if the underlying sink could not be flushed, nil otherwise.
+func (s *asyncSink) Flush() error {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return s.out.Flush()
+	}
+	flushed := make(chan error, 1)
+	s.queue <- asyncItem{flushed: flushed}
+	s.mu.RUnlock()
+
+	return <-flushed
+}
+
+// Close writes the queued entries, stops the background goroutine and flushes the underlying sink,
+// or closes it if it can be closed. Entries logged afterwards are written to the underlying sink directly.
+// It is safe to call Close multiple times.
+//
+// Returns:
+// - An error if the underlying sink could not be flushed, nil otherwise.
+func (s *asyncSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	if closer, ok := s.out.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return s.out.Flush()
+}
+
+// reportDrops writes an entry reporting the number of dropped entries, if any,
+// unless a report has been written within the interval.
+// It is only called by the background goroutine, so that writers never block on the underlying sink.
+//
+// Parameters:
+// - force: Whether to ignore the interval.
+func (s *asyncSink) reportDrops(force bool) {
+	if s.dropped.Load() == 0 {
+		return
+	}
+
+	now := time.Now()
+	if !force && now.Sub(s.lastReport) < s.interval {
+		return
+	}
+	s.lastReport = now
+
+	n := s.dropped.Swap(0)
+	if n == 0 {
+		return
+	}
+	s.out.Log(dropReport(n, now))
+}
+
+// dropReport returns an entry reporting the given number of dropped entries.
+//
+// Parameters:
+// - n: The number of dropped entries.
+// - now: The time of the report.
+//
+// Returns:
+// - The entry reporting the dropped entries.
+func dropReport(n uint64, now time.Time) logging.Entry {
+	return logging.Entry{
+		Timestamp: now.UTC(),
+		Severity:  logging.Warning,
+		Payload: map[string]interface{}{
+			"message": fmt.Sprintf("%d log entries dropped", n),
+			"dropped": n,
+		},
+	}
+}
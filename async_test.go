@@ -0,0 +1,341 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap/zapcore"
+)
+
+// gateSink is a sink whose writes block until a token is available.
+type gateSink struct {
+	fakeSink
+	tokens chan struct{}
+}
+
+// Log waits for a token and records the given entry.
+//
+// Parameters:
+// - e: The entry to record.
+func (s *gateSink) Log(e logging.Entry) {
+	<-s.tokens
+	s.fakeSink.Log(e)
+}
+
+// allow lets the given number of writes pass.
+//
+// Parameters:
+// - n: The number of writes.
+func (s *gateSink) allow(n int) {
+	for i := 0; i < n; i++ {
+		s.tokens <- struct{}{}
+	}
+}
+
+// waitDrained waits until the background goroutine has taken all queued items.
+//
+// Parameters:
+// - t: The test.
+// - s: The async sink.
+func waitDrained(t *testing.T, s *asyncSink) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(s.queue) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("queue not drained")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// droppedIn returns the number of dropped entries reported by the given entries.
+//
+// Parameters:
+// - entries: The written entries.
+//
+// Returns:
+// - The number of reports.
+// - The total number of dropped entries reported.
+func droppedIn(entries []logging.Entry) (reports int, dropped uint64) {
+	for _, e := range entries {
+		if payload, ok := e.Payload.(map[string]interface{}); ok {
+			reports++
+			dropped += payload["dropped"].(uint64)
+		}
+	}
+	return reports, dropped
+}
+
+func TestAsyncDropReport(t *testing.T) {
+	tests := []struct {
+		name        string
+		writes      int
+		wantDropped uint64
+	}{
+		{name: "no overflow", writes: 3},
+		{name: "overflow", writes: 6, wantDropped: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &gateSink{tokens: make(chan struct{}, 64)}
+			s := newAsyncSink(out, 2, time.Hour)
+			defer func() {
+				out.allow(8)
+				_ = s.Close()
+			}()
+
+			// The goroutine blocks on the first entry, so that the queue fills up.
+			s.Log(logging.Entry{Payload: "0"})
+			waitDrained(t, s)
+			for i := 1; i < tt.writes; i++ {
+				s.Log(logging.Entry{Payload: strconv.Itoa(i)})
+			}
+
+			written := tt.writes - int(tt.wantDropped)
+			reports := 0
+			if tt.wantDropped > 0 {
+				reports = 1
+			}
+			out.allow(written + reports)
+			if err := s.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries := out.Entries()
+			if len(entries) != written+reports {
+				t.Fatalf("got %d entries, want %d", len(entries), written+reports)
+			}
+			gotReports, gotDropped := droppedIn(entries)
+			if gotReports != reports || gotDropped != tt.wantDropped {
+				t.Errorf("got %d reports of %d dropped entries, want %d reports of %d", gotReports, gotDropped, reports, tt.wantDropped)
+			}
+			for _, e := range entries {
+				if payload, ok := e.Payload.(map[string]interface{}); ok && e.Severity != logging.Warning {
+					t.Errorf("report %v has severity %v, want %v", payload, e.Severity, logging.Warning)
+				}
+			}
+		})
+	}
+}
+
+func TestAsyncDropReportRateLimited(t *testing.T) {
+	out := &gateSink{tokens: make(chan struct{}, 64)}
+	s := newAsyncSink(out, 2, time.Hour)
+	defer func() {
+		out.allow(8)
+		_ = s.Close()
+	}()
+
+	overflow := func() {
+		s.Log(logging.Entry{Payload: "blocked"})
+		waitDrained(t, s)
+		for i := 0; i < 3; i++ {
+			s.Log(logging.Entry{Payload: "queued or dropped"})
+		}
+	}
+
+	// The first drops are reported right away.
+	overflow()
+	out.allow(4)
+	waitEntries(t, &out.fakeSink, 4)
+	if reports, dropped := droppedIn(out.Entries()); reports != 1 || dropped != 1 {
+		t.Fatalf("got %d reports of %d dropped entries, want 1 of 1", reports, dropped)
+	}
+
+	// Further drops within the interval are held back until the flush.
+	overflow()
+	out.allow(3)
+	waitEntries(t, &out.fakeSink, 7)
+	if reports, _ := droppedIn(out.Entries()); reports != 1 {
+		t.Fatalf("got %d reports within the interval, want 1", reports)
+	}
+	out.allow(1)
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if reports, dropped := droppedIn(out.Entries()); reports != 2 || dropped != 2 {
+		t.Errorf("got %d reports of %d dropped entries after the flush, want 2 of 2", reports, dropped)
+	}
+}
+
+func TestAsyncFlush(t *testing.T) {
+	out := &fakeSink{}
+	s := newAsyncSink(out, 256, time.Hour)
+	defer s.Close()
+
+	for i := 0; i < 100; i++ {
+		s.Log(logging.Entry{Payload: strconv.Itoa(i)})
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := out.Entries()
+	if len(entries) != 100 {
+		t.Fatalf("got %d entries after the flush, want 100", len(entries))
+	}
+	for i, e := range entries {
+		if e.Payload != strconv.Itoa(i) {
+			t.Fatalf("entry %d = %v, want entries in order", i, e.Payload)
+		}
+	}
+	if out.Flushes() != 1 {
+		t.Errorf("got %d flushes, want 1", out.Flushes())
+	}
+}
+
+func TestAsyncFlushUnderLoad(t *testing.T) {
+	out := &fakeSink{}
+	s := newAsyncSink(out, 16, time.Hour)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					s.Log(logging.Entry{Payload: "load"})
+				}
+			}
+		}()
+	}
+
+	// Flushes must not wait for entries queued concurrently.
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 10; i++ {
+			if err := s.Flush(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("flush did not return under constant load")
+	}
+
+	close(stop)
+	wg.Wait()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncClose(t *testing.T) {
+	out := &fakeSink{}
+	core := newCore(out, Config{AsyncBufferSize: 8})
+	s, ok := core.out.(*asyncSink)
+	if !ok {
+		t.Fatalf("sink is %T, want *asyncSink", core.out)
+	}
+
+	if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "queued"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-s.done:
+	default:
+		t.Fatal("background goroutine still running after Close")
+	}
+	if got := len(out.Entries()); got != 1 {
+		t.Fatalf("got %d entries after Close, want the queued entry", got)
+	}
+
+	// Entries written after Close are written synchronously.
+	if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "after close"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(out.Entries()); got != 2 {
+		t.Errorf("got %d entries, want the entry written after Close", got)
+	}
+	if err := core.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestAsyncConcurrentClose(t *testing.T) {
+	out := &fakeSink{}
+	s := newAsyncSink(out, 4, time.Hour)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				s.Log(logging.Entry{Payload: "entry"})
+				if i%10 == 0 {
+					_ = s.Flush()
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = s.Close()
+	}()
+	wg.Wait()
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, dropped := droppedIn(out.Entries())
+	if written := uint64(len(out.Entries())) - uint64(countReports(out.Entries())); written+dropped != 200 {
+		t.Errorf("written %d and dropped %d entries, want 200 in total", written, dropped)
+	}
+}
+
+// countReports returns the number of drop reports among the given entries.
+//
+// Parameters:
+// - entries: The written entries.
+//
+// Returns:
+// - The number of drop reports.
+func countReports(entries []logging.Entry) int {
+	reports, _ := droppedIn(entries)
+	return reports
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"errors"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// bufferedEntry is an entry held back by a bufferedCore.
+type bufferedEntry struct {
+	core   zapcore.Core
+	ent    zapcore.Entry
+	fields []zapcore.Field
+}
+
+// entryBuffer holds the entries of a Buffered logger and its children.
+type entryBuffer struct {
+	mu      sync.Mutex
+	entries []bufferedEntry
+}
+
+// bufferedCore is a zapcore.Core that holds entries back until they are committed.
+type bufferedCore struct {
+	zapcore.Core
+	buf *entryBuffer
+}
+
+// With adds structured context to the wrapped Core, sharing the buffer.
+//
+// Parameters:
+// - fields: The fields to add.
+//
+// Returns:
+// - A new Core with the given fields added.
+func (c *bufferedCore) With(fields []zapcore.Field) zapcore.Core {
+	return &bufferedCore{Core: c.Core.With(fields), buf: c.buf}
+}
+
+// Check determines whether the given entry should be logged.
+//
+// Parameters:
+// - ent: The entry to check.
+// - ce: The checked entry to add the Core to.
+//
+// Returns:
+// - The checked entry, with the Core added if the entry is enabled.
+func (c *bufferedCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write buffers the given entry. Entries at DPanic level or above are written
+// immediately, as the program may not reach the commit.
+//
+// Parameters:
+// - ent: The entry to write.
+// - fields: The fields of the entry.
+//
+// Returns:
+// - An error if an entry written immediately could not be written, nil otherwise.
+func (c *bufferedCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level >= zapcore.DPanicLevel {
+		return c.Core.Write(ent, fields)
+	}
+
+	c.buf.mu.Lock()
+	defer c.buf.mu.Unlock()
+	c.buf.entries = append(c.buf.entries, bufferedEntry{
+		core:   c.Core,
+		ent:    ent,
+		fields: append([]zapcore.Field(nil), fields...),
+	})
+	return nil
+}
+
+// Sync does nothing, as buffered entries are only written on commit.
+//
+// Returns:
+// - Always nil.
+func (c *bufferedCore) Sync() error {
+	return nil
+}
+
+// Buffered is a zap.Logger that holds entries back until they are committed or discarded,
+// e.g. to emit the entries of a request only if it fails.
+// Loggers derived from it, e.g. with With, share its buffer.
+type Buffered struct {
+	*zap.Logger
+	buf  *entryBuffer
+	sync func() error
+}
+
+// NewBuffered creates a new Buffered logger that writes committed entries to the given logger.
+//
+// Parameters:
+// - logger: The logger to write committed entries to.
+//
+// Returns:
+// - A new Buffered logger.
+func NewBuffered(logger *zap.Logger) *Buffered {
+	buf := &entryBuffer{}
+	return &Buffered{
+		Logger: logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return &bufferedCore{Core: core, buf: buf}
+		})),
+		buf:  buf,
+		sync: logger.Sync,
+	}
+}
+
+// take removes and returns the buffered entries.
+//
+// Returns:
+// - The buffered entries.
+func (b *Buffered) take() []bufferedEntry {
+	b.buf.mu.Lock()
+	defer b.buf.mu.Unlock()
+	entries := b.buf.entries
+	b.buf.entries = nil
+	return entries
+}
+
+// Commit writes the buffered entries in the order they were logged and flushes them.
+// The buffer is emptied, so the logger can be reused.
+//
+// Returns:
+// - An error if an entry could not be written or flushed, nil otherwise.
+func (b *Buffered) Commit() error {
+	var errs []error
+	for _, e := range b.take() {
+		errs = append(errs, e.core.Write(e.ent, e.fields))
+	}
+	errs = append(errs, b.sync())
+
+	return errors.Join(errs...)
+}
+
+// Discard drops the buffered entries without writing them.
+func (b *Buffered) Discard() {
+	b.take()
+}
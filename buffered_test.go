@@ -0,0 +1,103 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestBuffered(t *testing.T) {
+	tests := []struct {
+		name   string
+		commit bool
+		want   []string
+	}{
+		{name: "discard emits nothing", want: nil},
+		{name: "commit emits all in order", commit: true, want: []string{"first", "second", "third"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			logger := NewBuffered(zap.New(newCore(out, Config{})))
+			child := logger.With(zap.String("step", "child"))
+
+			logger.Info("first")
+			child.Warn("second")
+			logger.Debug("disabled")
+			logger.Error("third")
+			if got := len(out.Entries()); got != 0 {
+				t.Fatalf("got %d entries before the commit, want 0", got)
+			}
+
+			if tt.commit {
+				if err := logger.Commit(); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				logger.Discard()
+			}
+
+			entries := out.Entries()
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(entries), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := payloadOf(t, entries[i])["message"]; got != want {
+					t.Errorf("entry %d = %v, want %q", i, got, want)
+				}
+			}
+			if tt.commit {
+				if got := payloadOf(t, entries[1])["step"]; got != "child" {
+					t.Errorf("step = %v, want the fields of the child logger", got)
+				}
+				if out.Flushes() == 0 {
+					t.Error("committed entries were not flushed")
+				}
+			}
+
+			// The buffer is emptied, so the logger can be reused.
+			if err := logger.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(out.Entries()); got != len(tt.want) {
+				t.Errorf("got %d entries after a second commit, want %d", got, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestBufferedDPanicWrittenImmediately(t *testing.T) {
+	out := &fakeSink{}
+	logger := NewBuffered(zap.New(newCore(out, Config{})))
+
+	logger.DPanic("invariant violated")
+	if got := len(out.Entries()); got != 1 {
+		t.Fatalf("got %d entries, want the DPanic entry to be written immediately", got)
+	}
+	logger.Discard()
+	if got := len(out.Entries()); got != 1 {
+		t.Errorf("got %d entries after discarding, want 1", got)
+	}
+}
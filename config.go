@@ -22,16 +22,320 @@
 package gclzap
 
 import (
+	"time"
+
 	"cloud.google.com/go/logging"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
 )
 
 // Config is a configuration struct for the zap.Logger that writes logs to Google Cloud Logging.
 type Config struct {
-	EncoderConfig   EncoderConfig
-	Level           zapcore.Level
+	EncoderConfig EncoderConfig
+	Level         zapcore.Level
+	// LevelToSeverity converts zapcore levels to Google Cloud Logging severities.
+	// It determines both the severity of the entry and the "severity" key of the payload.
+	// If nil, DefaultLevelToSeverity is used.
 	LevelToSeverity func(zapcore.Level) logging.Severity
+
+	// DedupWindow suppresses identical consecutive entries (same message and severity)
+	// written within the window. A summary entry carrying the number of suppressed
+	// entries is written once the window closes. Zero disables deduplication.
+	DedupWindow time.Duration
+
+	// IncludeHostInfo attaches the "pid" and "hostname" labels to every entry.
+	// Both values are read once when the logger is built.
+	IncludeHostInfo bool
+
+	// LabelPrefix is prepended to the keys of all labels attached via Label.
+	// Labels set by the package itself, such as the host info and "user_id" labels, are not prefixed.
+	LabelPrefix string
+
+	// IncludeSeverityNumber adds the numeric value of the severity (100 to 800)
+	// as the "severityNumber" field to the payload.
+	IncludeSeverityNumber bool
+
+	// WriteTimeout bounds the time spent writing and flushing entries that are flushed on write.
+	// If the timeout expires, the entry is written to the Fallback syncer instead.
+	// Zero disables the timeout.
+	WriteTimeout time.Duration
+
+	// Fallback receives the encoded entries that could not be written to Google Cloud Logging
+	// in time. If nil, standard error is used.
+	Fallback zapcore.WriteSyncer
+
+	// FilePath is the path of a file the entries are written to as JSON lines in the
+	// structured logging format, alongside Google Cloud Logging, e.g. for the Ops Agent to tail.
+	// The file is closed by Core.Close.
+	// The file is reopened within a second when it is rotated, or immediately by
+	// Core.ReopenFile. Use NewFile to write to a file instead of Google Cloud Logging.
+	// Empty disables the file output.
+	FilePath string
+
+	// DisableFatalExit logs Fatal entries without exiting the process afterwards.
+	// This is useful in tests and on serverless platforms where os.Exit is harmful.
+	DisableFatalExit bool
+
+	// IncludePayloadSize adds the size of the encoded payload in bytes
+	// as the "payload_bytes" field to the payload.
+	// The entry is encoded twice when enabled.
+	IncludePayloadSize bool
+
+	// Resource is the monitored resource of all entries.
+	// It can be overridden per entry with the Resource field.
+	// If nil, the resource of the Google Cloud Logging logger is used.
+	Resource *mrpb.MonitoredResource
+
+	// FieldMapping maps the keys of fields to special fields of the entry.
+	// Mapped fields are removed from the payload. Supported destinations are
+	// "trace", "spanId", "insertId", "httpRequest" and "label:<key>".
+	// Fields mapped to "httpRequest" must hold a *logging.HTTPRequest.
+	FieldMapping map[string]string
+
+	// MaxLabels is the maximum number of labels per entry.
+	// Excess labels are dropped and reported to OnError.
+	// Labels set by the package itself are kept in favor of user labels.
+	// Zero disables the limit.
+	MaxLabels int
+
+	// OnError is called with errors that do not prevent an entry from being written,
+	// such as dropped labels. If nil, such errors are ignored.
+	// Loggers built from the configuration also report zap's internal errors,
+	// e.g. failed writes, to OnError instead of stderr.
+	OnError func(error)
+
+	// EnableContextObject adds the "context" object expected by Cloud Error Reporting
+	// to entries at ErrorLevel and above. It holds the HTTP request and the user,
+	// set via ErrorContext, and the report location derived from the caller.
+	EnableContextObject bool
+
+	// SeverityClients routes entries with the given severities to dedicated loggers,
+	// e.g. to isolate the quota of high-volume debug logs in a separate project.
+	// Entries with other severities are written to the default logger.
+	SeverityClients map[logging.Severity]*logging.Logger
+
+	// Clock is the source of the current time, used for entries without a time.
+	// It is also passed to the zap.Logger. If nil, the system clock is used.
+	Clock zapcore.Clock
+
+	// Synchronous flushes the log buffer after every entry, so that entries reach
+	// Google Cloud Logging in the order they were written.
+	// This defeats the batching of the underlying logger and severely limits
+	// the throughput, as every entry costs a round trip to the API.
+	// Use it for debugging ordering issues only.
+	Synchronous bool
+
+	// ElevateGRPCSeverity raises the severity of entries with a "grpcCode" field
+	// to the severity returned by GRPCStatusSeverity, if it is higher.
+	// The field may hold a codes.Code or an integer.
+	ElevateGRPCSeverity bool
+
+	// PreferTextPayload writes entries without any fields as a text payload
+	// holding only the message. Entries with fields are written as a JSON payload.
+	PreferTextPayload bool
+
+	// EmitSummaryOnClose writes a summary entry holding the number of entries
+	// written by severity when the Core is closed, e.g. at the end of a batch job.
+	EmitSummaryOnClose bool
+
+	// LevelSchedule raises the minimum enabled level during daily time windows,
+	// e.g. to WarnLevel during off-hours to reduce noise.
+	// The windows are evaluated against the wall clock time of Clock.
+	LevelSchedule []LevelWindow
+
+	// MDC returns ambient labels attached to every entry, e.g. from an MDC-style
+	// goroutine-local map of a framework. Labels set via Label take precedence.
+	// MDC is called for every entry on the goroutine writing the entry,
+	// which is the goroutine calling the logger unless the Core is wrapped by a core
+	// writing asynchronously, in which case goroutine-local state is not available.
+	MDC func() map[string]string
+
+	// MaxMessageBytes truncates the message of entries to the given number of bytes,
+	// marking the truncation with an ellipsis. Fields are not truncated.
+	// Zero disables the truncation.
+	MaxMessageBytes int
+
+	// MaxSQLQueryBytes truncates the queries described by SQLEvent to the given number of bytes,
+	// marking the truncation with an ellipsis. If zero, DefaultMaxSQLQueryBytes is used.
+	// A negative value disables the truncation.
+	MaxSQLQueryBytes int
+
+	// Development puts the logger in development mode, making DPanic entries panic
+	// and enabling the validation of payloads using PayloadSchema.
+	Development bool
+
+	// PayloadSchema validates the decoded payload of every entry in development mode,
+	// e.g. against a JSON schema. Entries that do not conform are still written,
+	// but the validation error is returned from the write and reported by zap.
+	PayloadSchema func(payload map[string]interface{}) error
+
+	// DisableCaller disables the capture of the caller, which is expensive,
+	// and guarantees that neither the "caller" key nor the source location is written,
+	// even if the logger is built with zap.AddCaller.
+	DisableCaller bool
+
+	// Encoders are alternative encoders selected per entry with the UseEncoder field,
+	// e.g. to give audit entries a different payload shape.
+	// Fields added with With are added to all encoders.
+	Encoders map[string]zapcore.Encoder
+
+	// DeployLabelEnv is the name of an environment variable, e.g. "DEPLOY_SHA", holding
+	// the deployed version. If set, the variable is read once when the Core is created
+	// and its value is attached to every entry as the "deploy_sha" label.
+	// Nothing is attached if the variable is unset or empty.
+	DeployLabelEnv string
+
+	// UserIDLabel attaches the id of the User field as the "user_id" label,
+	// so that entries can be filtered by user.
+	UserIDLabel bool
+
+	// PreFlushHook is called at the start of every flush, e.g. to drain buffered spans
+	// or metrics together with the logs. Its error is joined with the flush error.
+	PreFlushHook func() error
+
+	// IncludeSequence adds a "seq" field holding a sequence number to the payload,
+	// so that the order of entries can be reconstructed despite batching.
+	// The number increases monotonically across the Core and its clones, starting at 1.
+	IncludeSequence bool
+
+	// PayloadMarshaler prepares the decoded payload for the entry, e.g. to sanitize values,
+	// convert types or order keys. Numbers are passed as json.Number. The result is used as
+	// the payload of the entry. If the marshaler fails, the error is reported to OnError
+	// and the encoded payload is written unchanged. If nil, the encoded payload is written.
+	PayloadMarshaler func(map[string]interface{}) (interface{}, error)
+
+	// KeyNormalizer normalizes the keys of the fields of every entry, e.g. SnakeCaseKeys.
+	// It is applied after the field mapping to top-level keys only. The keys of the encoder,
+	// e.g. "severity" and "time", and the fields added by the package are not normalized.
+	// If nil, the keys are left untouched.
+	KeyNormalizer func(string) string
+
+	// FieldsAsLabels writes the message as a text payload and promotes the fields of
+	// the entry, including fields added with With, to labels. This suits pipelines that
+	// only index labels and the text payload. Fields with non-string values are
+	// stringified unless DropNonStringLabels is set. Labels set explicitly, e.g. with
+	// the Label field, take precedence over promoted fields.
+	FieldsAsLabels bool
+
+	// DropNonStringLabels drops fields with non-string values instead of stringifying
+	// them when FieldsAsLabels is set.
+	DropNonStringLabels bool
+
+	// OmitNilFields drops fields whose value is nil, e.g. zap.Any("x", nil) or a nil
+	// pointer, map or slice, instead of writing them as null.
+	OmitNilFields bool
+
+	// ProjectID is the ID of the Google Cloud project used to qualify bare trace IDs,
+	// e.g. those extracted by Middleware, as "projects/<ProjectID>/traces/<trace>".
+	// If empty, traces are written as given.
+	ProjectID string
+
+	// OperationProducer is the producer of the operations set with the Operation field,
+	// e.g. "github.com/my/worker", so that only the operation ID has to be given per entry.
+	OperationProducer string
+
+	// BaggageLabels are the names of the OpenTelemetry baggage members attached as labels
+	// to entries logged with the Context field. Missing members are skipped.
+	BaggageLabels []string
+
+	// KeepZeroTime keeps the zero time of entries. By default, the current time is
+	// substituted for the zero time, consistently for the "time" key of the payload and
+	// the timestamp of the entry. If set, the zero time is passed to the encoder as is
+	// and the Google Cloud Logging client sets the timestamp of the entry.
+	KeepZeroTime bool
+
+	// AsyncBufferSize enables asynchronous writing: entries are queued in a buffer of the
+	// given size and written by a background goroutine, so that writes never block.
+	// Entries are dropped when the buffer is full, and an entry at WARNING severity
+	// reporting the number of dropped entries is written at most once per DropReportInterval.
+	// Flushing waits for the entries queued before the flush, not for entries queued
+	// concurrently. Close stops the background goroutine. Entries routed by SeverityClients
+	// are written synchronously. Zero disables asynchronous writing.
+	AsyncBufferSize int
+
+	// DropReportInterval is the minimum interval between reports of dropped entries
+	// in asynchronous mode. If zero, DefaultDropReportInterval is used.
+	DropReportInterval time.Duration
+
+	// DynamicLabels returns labels that may change at runtime, e.g. the current deployment color.
+	// They are attached to every entry, with labels of the entry taking precedence.
+	// To avoid calling the function on every write, its result is cached for DynamicLabelsTTL,
+	// so changes are picked up after at most that time.
+	DynamicLabels func() map[string]string
+
+	// DynamicLabelsTTL is the time the result of DynamicLabels is cached.
+	// If zero, DefaultDynamicLabelsTTL is used.
+	DynamicLabelsTTL time.Duration
+
+	// BatchFlushSize is the number of entries after which WriteBatch flushes its sinks,
+	// so that large batches do not exceed the request limits of Google Cloud Logging.
+	// The Core is still synced only once per batch. Zero flushes the whole batch at once.
+	BatchFlushSize int
+
+	// DeduplicateFields keeps only the last of the fields sharing a key, instead of
+	// emitting all of them, which Cloud Logging may collapse unpredictably.
+	// The fields of an entry and the fields of a With call are deduplicated among
+	// themselves; fields added with With are not replaced by fields of an entry.
+	DeduplicateFields bool
+
+	// LogName is the name of the log written to by loggers created with NewFromProject.
+	// If empty, DefaultLogName is used.
+	LogName string
+
+	// TraceURLTemplate adds a "trace_url" field linking to the trace to the payload of entries
+	// at Error level and above that carry a trace, e.g. DefaultTraceURLTemplate.
+	// The placeholders "{project}" and "{trace}" are replaced by the project and trace ID.
+	// Bare trace IDs require ProjectID. If empty, no link is added.
+	TraceURLTemplate string
+
+	// FieldEncoders transform the values of the fields with the given keys before they are
+	// encoded, e.g. to format a "price" field as a fixed-point string. The functions receive
+	// the value as encoded by zap's map encoder, e.g. an int64 for zap.Int, and the result
+	// is encoded like zap.Any. Fields added with With are transformed as well.
+	FieldEncoders map[string]func(interface{}) interface{}
+
+	// LogEffectiveConfig logs the configuration at Info level when a logger is built
+	// with New or NewStderr, to help debugging misconfiguration.
+	// Functions and other values that cannot be represented are logged as whether they are set.
+	LogEffectiveConfig bool
+
+	// ResourceLabelFields are the keys of fields, e.g. "tenant", whose values are also added
+	// to the labels of the monitored resource of the entry, e.g. for quota segmentation.
+	// The fields are kept in the payload. A resource must be set, either with Resource
+	// or with the Resource field, as the resource detected by the client cannot be extended.
+	ResourceLabelFields []string
+
+	// MinSeverity is the lowest severity written, e.g. logging.Notice.
+	// Entries with a lower severity are dropped, independently of Level.
+	// The severity is compared after ElevateGRPCSeverity is applied.
+	// If zero, i.e. logging.Default, no entries are dropped.
+	MinSeverity logging.Severity
+
+	// NameAsLabel is the key of a label, e.g. "component", holding the name of the logger
+	// set with zap.Logger.Named. Labels set explicitly take precedence.
+	// If empty, the name is not attached as a label.
+	NameAsLabel string
+
+	// OTelBatchSize is the maximum number of records per export of a Core created with
+	// NewOTelCore. A batch is exported as soon as it is full.
+	// If zero, DefaultOTelBatchSize is used.
+	OTelBatchSize int
+
+	// OTelMaxQueueSize is the maximum number of records buffered by a Core created with
+	// NewOTelCore. Records are dropped when the buffer is full.
+	// If zero, DefaultOTelMaxQueueSize is used.
+	OTelMaxQueueSize int
+
+	// OTelExportInterval is the interval at which a Core created with NewOTelCore
+	// exports the buffered records. If zero, DefaultOTelExportInterval is used.
+	OTelExportInterval time.Duration
+
+	// MaxFields is the maximum number of fields per entry, including the fields added
+	// with With. Excess fields of the entry are dropped, keeping the first ones, and a
+	// "fields_truncated" field holding the number of dropped fields is added.
+	// Fields added by the package are not counted. Zero disables the limit.
+	MaxFields int
 }
 
 // NewConfig creates a new configuration for the zap.Logger that writes logs to Google Cloud Logging.
@@ -62,6 +366,228 @@ func (c Config) Build(logger *logging.Logger) *zap.Logger {
 	return New(logger, c)
 }
 
+// MergeConfig merges the given configurations, with the non-zero fields of override
+// taking precedence over the fields of base.
+//
+// Fields are merged as follows:
+// - Scalar fields are overridden if the value in override is not the zero value.
+// Since zapcore.InfoLevel is the zero value of zapcore.Level, a level cannot be overridden to InfoLevel.
+// - Boolean fields are enabled if they are enabled in either configuration.
+// - Function and interface fields are overridden if the value in override is not nil.
+// - Slice fields are replaced as a whole if the value in override is not nil.
+// - Map fields are merged key by key, with the keys in override taking precedence.
+// - The EncoderConfig is merged field by field following the same rules.
+//
+// Parameters:
+// - base: The base configuration.
+// - override: The configuration whose non-zero fields take precedence.
+//
+// Returns:
+// - The merged configuration.
+func MergeConfig(base, override Config) Config {
+	merged := base
+	merged.EncoderConfig = mergeEncoderConfig(base.EncoderConfig, override.EncoderConfig)
+	if override.Level != zapcore.InfoLevel {
+		merged.Level = override.Level
+	}
+	if override.LevelToSeverity != nil {
+		merged.LevelToSeverity = override.LevelToSeverity
+	}
+	if override.DedupWindow != 0 {
+		merged.DedupWindow = override.DedupWindow
+	}
+	merged.IncludeHostInfo = base.IncludeHostInfo || override.IncludeHostInfo
+	if override.LabelPrefix != "" {
+		merged.LabelPrefix = override.LabelPrefix
+	}
+	merged.IncludeSeverityNumber = base.IncludeSeverityNumber || override.IncludeSeverityNumber
+	if override.WriteTimeout != 0 {
+		merged.WriteTimeout = override.WriteTimeout
+	}
+	if override.Fallback != nil {
+		merged.Fallback = override.Fallback
+	}
+	if override.FilePath != "" {
+		merged.FilePath = override.FilePath
+	}
+	merged.DisableFatalExit = base.DisableFatalExit || override.DisableFatalExit
+	merged.IncludePayloadSize = base.IncludePayloadSize || override.IncludePayloadSize
+	if override.Resource != nil {
+		merged.Resource = override.Resource
+	}
+	merged.FieldMapping = mergeMaps(base.FieldMapping, override.FieldMapping)
+	if override.MaxLabels != 0 {
+		merged.MaxLabels = override.MaxLabels
+	}
+	if override.OnError != nil {
+		merged.OnError = override.OnError
+	}
+	merged.EnableContextObject = base.EnableContextObject || override.EnableContextObject
+	merged.SeverityClients = mergeMaps(base.SeverityClients, override.SeverityClients)
+	if override.Clock != nil {
+		merged.Clock = override.Clock
+	}
+	merged.Synchronous = base.Synchronous || override.Synchronous
+	merged.ElevateGRPCSeverity = base.ElevateGRPCSeverity || override.ElevateGRPCSeverity
+	merged.PreferTextPayload = base.PreferTextPayload || override.PreferTextPayload
+	merged.EmitSummaryOnClose = base.EmitSummaryOnClose || override.EmitSummaryOnClose
+	if override.LevelSchedule != nil {
+		merged.LevelSchedule = override.LevelSchedule
+	}
+	if override.MDC != nil {
+		merged.MDC = override.MDC
+	}
+	if override.MaxMessageBytes != 0 {
+		merged.MaxMessageBytes = override.MaxMessageBytes
+	}
+	if override.MaxSQLQueryBytes != 0 {
+		merged.MaxSQLQueryBytes = override.MaxSQLQueryBytes
+	}
+	merged.Development = base.Development || override.Development
+	merged.DisableCaller = base.DisableCaller || override.DisableCaller
+	merged.Encoders = mergeMaps(base.Encoders, override.Encoders)
+	if override.DeployLabelEnv != "" {
+		merged.DeployLabelEnv = override.DeployLabelEnv
+	}
+	merged.UserIDLabel = base.UserIDLabel || override.UserIDLabel
+	if override.PreFlushHook != nil {
+		merged.PreFlushHook = override.PreFlushHook
+	}
+	merged.IncludeSequence = base.IncludeSequence || override.IncludeSequence
+	if override.PayloadMarshaler != nil {
+		merged.PayloadMarshaler = override.PayloadMarshaler
+	}
+	if override.KeyNormalizer != nil {
+		merged.KeyNormalizer = override.KeyNormalizer
+	}
+	merged.FieldsAsLabels = base.FieldsAsLabels || override.FieldsAsLabels
+	merged.DropNonStringLabels = base.DropNonStringLabels || override.DropNonStringLabels
+	merged.OmitNilFields = base.OmitNilFields || override.OmitNilFields
+	if override.ProjectID != "" {
+		merged.ProjectID = override.ProjectID
+	}
+	if override.OperationProducer != "" {
+		merged.OperationProducer = override.OperationProducer
+	}
+	if override.BaggageLabels != nil {
+		merged.BaggageLabels = override.BaggageLabels
+	}
+	merged.KeepZeroTime = base.KeepZeroTime || override.KeepZeroTime
+	if override.AsyncBufferSize != 0 {
+		merged.AsyncBufferSize = override.AsyncBufferSize
+	}
+	if override.DropReportInterval != 0 {
+		merged.DropReportInterval = override.DropReportInterval
+	}
+	if override.DynamicLabels != nil {
+		merged.DynamicLabels = override.DynamicLabels
+	}
+	if override.DynamicLabelsTTL != 0 {
+		merged.DynamicLabelsTTL = override.DynamicLabelsTTL
+	}
+	if override.BatchFlushSize != 0 {
+		merged.BatchFlushSize = override.BatchFlushSize
+	}
+	merged.DeduplicateFields = base.DeduplicateFields || override.DeduplicateFields
+	if override.LogName != "" {
+		merged.LogName = override.LogName
+	}
+	if override.TraceURLTemplate != "" {
+		merged.TraceURLTemplate = override.TraceURLTemplate
+	}
+	merged.FieldEncoders = mergeMaps(base.FieldEncoders, override.FieldEncoders)
+	merged.LogEffectiveConfig = base.LogEffectiveConfig || override.LogEffectiveConfig
+	if override.ResourceLabelFields != nil {
+		merged.ResourceLabelFields = override.ResourceLabelFields
+	}
+	if override.MinSeverity != logging.Default {
+		merged.MinSeverity = override.MinSeverity
+	}
+	if override.NameAsLabel != "" {
+		merged.NameAsLabel = override.NameAsLabel
+	}
+	if override.OTelBatchSize != 0 {
+		merged.OTelBatchSize = override.OTelBatchSize
+	}
+	if override.OTelMaxQueueSize != 0 {
+		merged.OTelMaxQueueSize = override.OTelMaxQueueSize
+	}
+	if override.OTelExportInterval != 0 {
+		merged.OTelExportInterval = override.OTelExportInterval
+	}
+	if override.MaxFields != 0 {
+		merged.MaxFields = override.MaxFields
+	}
+	if override.PayloadSchema != nil {
+		merged.PayloadSchema = override.PayloadSchema
+	}
+
+	return merged
+}
+
+// mergeMaps merges the given maps into a new map,
+// with the keys in override taking precedence over the keys in base.
+//
+// Parameters:
+// - base: The base map.
+// - override: The map whose keys take precedence.
+//
+// Returns:
+// - The merged map, or nil if both maps are nil.
+func mergeMaps[K comparable, V any](base, override map[K]V) map[K]V {
+	if base == nil && override == nil {
+		return nil
+	}
+
+	merged := make(map[K]V, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// Options returns the zap options derived from the configuration.
+// Pass them to zap.New when assembling a logger from a Core manually.
+//
+// Returns:
+// - The zap options derived from the configuration.
+func (c Config) Options() []zap.Option {
+	var options []zap.Option
+	if c.DisableFatalExit {
+		options = append(options, zap.WithFatalHook(noopHook{}))
+	}
+	if c.Clock != nil {
+		options = append(options, zap.WithClock(c.Clock))
+	}
+	if c.Development {
+		options = append(options, zap.Development())
+	}
+	if c.DisableCaller {
+		options = append(options, zap.WithCaller(false))
+	}
+	if c.OnError != nil {
+		options = append(options, zap.ErrorOutput(errorOutput{onError: c.OnError}))
+	}
+
+	return options
+}
+
+// noopHook is a zapcore.CheckWriteHook that does nothing.
+// zap replaces zapcore.WriteThenNoop with zapcore.WriteThenFatal for Fatal entries,
+// so a distinct hook is required to continue execution after a Fatal entry.
+type noopHook struct{}
+
+// OnWrite does nothing.
+//
+// Parameters:
+// - ce: The checked entry that has been written.
+// - fields: The fields of the entry.
+func (noopHook) OnWrite(*zapcore.CheckedEntry, []zapcore.Field) {}
+
 // NewProductionConfig returns a new configuration for the zap.Logger that writes logs to Google Cloud Logging.
 //
 // Returns:
@@ -70,7 +596,8 @@ func NewProductionConfig() Config {
 	return Config{
 		EncoderConfig:   DefaultEncoderConfig(),
 		Level:           zapcore.InfoLevel,
-		LevelToSeverity: toSeverity,
+		LevelToSeverity: DefaultLevelToSeverity,
+		MaxLabels:       DefaultMaxLabels,
 	}
 }
 
@@ -82,18 +609,23 @@ func NewDevelopmentConfig() Config {
 	return Config{
 		EncoderConfig:   DefaultEncoderConfig(),
 		Level:           zapcore.DebugLevel,
-		LevelToSeverity: toSeverity,
+		LevelToSeverity: DefaultLevelToSeverity,
+		MaxLabels:       DefaultMaxLabels,
+		Development:     true,
 	}
 }
 
-// toSeverity converts the given zapcore level to a Google Cloud Logging severity.
+// DefaultLevelToSeverity converts the given zapcore level to a Google Cloud Logging severity.
+// DPanicLevel and PanicLevel map to CRITICAL and FatalLevel maps to EMERGENCY,
+// so that fatal entries stay distinguishable from panics.
+// Set Config.LevelToSeverity to map the levels differently.
 //
 // Parameters:
 // - l: The zapcore level to convert.
 //
 // Returns:
 // - The converted logging severity.
-func toSeverity(l zapcore.Level) logging.Severity {
+func DefaultLevelToSeverity(l zapcore.Level) logging.Severity {
 	switch l {
 	case zapcore.DebugLevel:
 		return logging.Debug
@@ -103,13 +635,40 @@ func toSeverity(l zapcore.Level) logging.Severity {
 		return logging.Warning
 	case zapcore.ErrorLevel:
 		return logging.Error
-	case zapcore.DPanicLevel:
-		return logging.Critical
-	case zapcore.PanicLevel:
+	case zapcore.DPanicLevel, zapcore.PanicLevel:
 		return logging.Critical
 	case zapcore.FatalLevel:
-		return logging.Critical
+		return logging.Emergency
 	default:
 		return logging.Default
 	}
 }
+
+// FromSeverity converts the given Google Cloud Logging severity to a zapcore level,
+// inverting DefaultLevelToSeverity. Severities without an exact zap equivalent map to the
+// nearest lower level: DEFAULT maps to DebugLevel, NOTICE maps to InfoLevel and ALERT maps
+// to DPanicLevel. PanicLevel is never returned, as it shares CRITICAL with DPanicLevel.
+// EMERGENCY and above map to FatalLevel, so callers logging at the returned level should
+// handle FatalLevel explicitly to avoid exiting.
+//
+// Parameters:
+// - s: The logging severity to convert.
+//
+// Returns:
+// - The converted zapcore level.
+func FromSeverity(s logging.Severity) zapcore.Level {
+	switch {
+	case s >= logging.Emergency:
+		return zapcore.FatalLevel
+	case s >= logging.Critical:
+		return zapcore.DPanicLevel
+	case s >= logging.Error:
+		return zapcore.ErrorLevel
+	case s >= logging.Warning:
+		return zapcore.WarnLevel
+	case s >= logging.Info:
+		return zapcore.InfoLevel
+	default:
+		return zapcore.DebugLevel
+	}
+}
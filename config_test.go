@@ -0,0 +1,314 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestMergeConfig(t *testing.T) {
+	errBase := errors.New("base")
+	errOverride := errors.New("override")
+
+	tests := []struct {
+		name     string
+		base     Config
+		override Config
+		check    func(t *testing.T, merged Config)
+	}{
+		{
+			name:     "level is overridden",
+			base:     Config{Level: zapcore.WarnLevel},
+			override: Config{Level: zapcore.DebugLevel},
+			check: func(t *testing.T, merged Config) {
+				if merged.Level != zapcore.DebugLevel {
+					t.Errorf("level = %v, want debug", merged.Level)
+				}
+			},
+		},
+		{
+			name:     "zero level keeps the base",
+			base:     Config{Level: zapcore.WarnLevel},
+			override: Config{},
+			check: func(t *testing.T, merged Config) {
+				if merged.Level != zapcore.WarnLevel {
+					t.Errorf("level = %v, want warn", merged.Level)
+				}
+			},
+		},
+		{
+			name: "encoder config is merged field by field",
+			base: Config{EncoderConfig: EncoderConfig{
+				LineEnding:   "\n",
+				LevelStrings: map[zapcore.Level]string{zapcore.InfoLevel: "info", zapcore.WarnLevel: "warn"},
+			}},
+			override: Config{EncoderConfig: EncoderConfig{
+				EncodeCaller: FullPathCallerEncoder,
+				LevelStrings: map[zapcore.Level]string{zapcore.WarnLevel: "warning"},
+			}},
+			check: func(t *testing.T, merged Config) {
+				if merged.EncoderConfig.LineEnding != "\n" {
+					t.Errorf("line ending = %q, want the base", merged.EncoderConfig.LineEnding)
+				}
+				if merged.EncoderConfig.EncodeCaller == nil {
+					t.Error("caller encoder not overridden")
+				}
+				want := map[zapcore.Level]string{zapcore.InfoLevel: "info", zapcore.WarnLevel: "warning"}
+				if !reflect.DeepEqual(merged.EncoderConfig.LevelStrings, want) {
+					t.Errorf("level strings = %v, want %v", merged.EncoderConfig.LevelStrings, want)
+				}
+			},
+		},
+		{
+			name:     "hooks are overridden if set",
+			base:     Config{PreFlushHook: func() error { return errBase }, OnError: func(error) {}},
+			override: Config{PreFlushHook: func() error { return errOverride }},
+			check: func(t *testing.T, merged Config) {
+				if err := merged.PreFlushHook(); err != errOverride {
+					t.Errorf("pre-flush hook returned %v, want the override", err)
+				}
+				if merged.OnError == nil {
+					t.Error("error handler of the base dropped")
+				}
+			},
+		},
+		{
+			name:     "booleans are combined",
+			base:     Config{Synchronous: true},
+			override: Config{IncludeSequence: true},
+			check: func(t *testing.T, merged Config) {
+				if !merged.Synchronous || !merged.IncludeSequence {
+					t.Errorf("synchronous = %v, sequence = %v, want both enabled", merged.Synchronous, merged.IncludeSequence)
+				}
+			},
+		},
+		{
+			name:     "slices are replaced as a whole",
+			base:     Config{LevelSchedule: []LevelWindow{{}, {}}},
+			override: Config{LevelSchedule: []LevelWindow{{}}},
+			check: func(t *testing.T, merged Config) {
+				if len(merged.LevelSchedule) != 1 {
+					t.Errorf("got %d level windows, want the override", len(merged.LevelSchedule))
+				}
+			},
+		},
+		{
+			name:     "maps are merged key by key",
+			base:     Config{FieldMapping: map[string]string{"a": "trace", "b": "spanId"}},
+			override: Config{FieldMapping: map[string]string{"b": "insertId"}},
+			check: func(t *testing.T, merged Config) {
+				want := map[string]string{"a": "trace", "b": "insertId"}
+				if !reflect.DeepEqual(merged.FieldMapping, want) {
+					t.Errorf("field mapping = %v, want %v", merged.FieldMapping, want)
+				}
+			},
+		},
+		{
+			name:     "durations are overridden if non-zero",
+			base:     Config{DedupWindow: time.Second, WriteTimeout: time.Second},
+			override: Config{DedupWindow: time.Minute},
+			check: func(t *testing.T, merged Config) {
+				if merged.DedupWindow != time.Minute || merged.WriteTimeout != time.Second {
+					t.Errorf("dedup window = %v, write timeout = %v", merged.DedupWindow, merged.WriteTimeout)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, MergeConfig(tt.base, tt.override))
+		})
+	}
+}
+
+// fatalExitEnv is the environment variable telling the test binary to log a Fatal entry.
+const fatalExitEnv = "GCLZAP_TEST_FATAL"
+
+func TestDisableFatalExit(t *testing.T) {
+	if os.Getenv(fatalExitEnv) != "" {
+		// Running in the child process.
+		out := &fakeSink{}
+		config := Config{}
+		zap.New(newCore(out, config), config.Options()...).Fatal("boom")
+		os.Exit(0)
+	}
+
+	tests := []struct {
+		name     string
+		disable  bool
+		wantExit bool
+	}{
+		{name: "disabled", disable: true, wantExit: false},
+		{name: "enabled", disable: false, wantExit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.wantExit {
+				out := &fakeSink{}
+				config := Config{DisableFatalExit: tt.disable}
+				zap.New(newCore(out, config), config.Options()...).Fatal("boom")
+
+				// Reaching this line means the process did not exit.
+				entries := out.Entries()
+				if len(entries) != 1 {
+					t.Fatalf("got %d entries, want 1", len(entries))
+				}
+				if entries[0].Severity != DefaultLevelToSeverity(zapcore.FatalLevel) {
+					t.Errorf("severity = %v, want %v", entries[0].Severity, DefaultLevelToSeverity(zapcore.FatalLevel))
+				}
+				return
+			}
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestDisableFatalExit$")
+			cmd.Env = append(os.Environ(), fatalExitEnv+"=1")
+			var exitErr *exec.ExitError
+			if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+				t.Errorf("child process returned %v, want exit status 1", err)
+			}
+		})
+	}
+}
+
+func TestDefaultLevelToSeverity(t *testing.T) {
+	tests := []struct {
+		level zapcore.Level
+		want  logging.Severity
+	}{
+		{zapcore.DebugLevel, logging.Debug},
+		{zapcore.InfoLevel, logging.Info},
+		{zapcore.WarnLevel, logging.Warning},
+		{zapcore.ErrorLevel, logging.Error},
+		{zapcore.DPanicLevel, logging.Critical},
+		{zapcore.PanicLevel, logging.Critical},
+		{zapcore.FatalLevel, logging.Emergency},
+		{zapcore.InvalidLevel, logging.Default},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			if got := DefaultLevelToSeverity(tt.level); got != tt.want {
+				t.Errorf("DefaultLevelToSeverity(%v) = %v, want %v", tt.level, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevelToSeverity(t *testing.T) {
+	custom := func(l zapcore.Level) logging.Severity {
+		if l == zapcore.PanicLevel {
+			return logging.Alert
+		}
+		return DefaultLevelToSeverity(l)
+	}
+
+	tests := []struct {
+		name            string
+		levelToSeverity func(zapcore.Level) logging.Severity
+		level           zapcore.Level
+		want            logging.Severity
+		wantString      string
+	}{
+		{name: "default panic", level: zapcore.PanicLevel, want: logging.Critical, wantString: "CRITICAL"},
+		{name: "default fatal", level: zapcore.FatalLevel, want: logging.Emergency, wantString: "EMERGENCY"},
+		{name: "custom panic", levelToSeverity: custom, level: zapcore.PanicLevel, want: logging.Alert, wantString: "ALERT"},
+		{name: "custom keeps others", levelToSeverity: custom, level: zapcore.DPanicLevel, want: logging.Critical, wantString: "CRITICAL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{LevelToSeverity: tt.levelToSeverity})
+			if err := core.Write(zapcore.Entry{Level: tt.level, Message: "hello"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if entry.Severity != tt.want {
+				t.Errorf("severity = %v, want %v", entry.Severity, tt.want)
+			}
+			if got := payloadOf(t, entry)["severity"]; got != tt.wantString {
+				t.Errorf("payload severity = %v, want %q", got, tt.wantString)
+			}
+		})
+	}
+}
+
+func TestFromSeverity(t *testing.T) {
+	tests := []struct {
+		severity logging.Severity
+		want     zapcore.Level
+	}{
+		{logging.Default, zapcore.DebugLevel},
+		{logging.Debug, zapcore.DebugLevel},
+		{logging.Info, zapcore.InfoLevel},
+		{logging.Notice, zapcore.InfoLevel},
+		{logging.Warning, zapcore.WarnLevel},
+		{logging.Error, zapcore.ErrorLevel},
+		{logging.Critical, zapcore.DPanicLevel},
+		{logging.Alert, zapcore.DPanicLevel},
+		{logging.Emergency, zapcore.FatalLevel},
+		{logging.Emergency + 100, zapcore.FatalLevel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.severity.String(), func(t *testing.T) {
+			if got := FromSeverity(tt.severity); got != tt.want {
+				t.Errorf("FromSeverity(%v) = %v, want %v", tt.severity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromSeverityRoundTrip(t *testing.T) {
+	levels := []zapcore.Level{
+		zapcore.DebugLevel,
+		zapcore.InfoLevel,
+		zapcore.WarnLevel,
+		zapcore.ErrorLevel,
+		zapcore.DPanicLevel,
+		zapcore.PanicLevel,
+		zapcore.FatalLevel,
+	}
+
+	for _, level := range levels {
+		t.Run(level.String(), func(t *testing.T) {
+			severity := DefaultLevelToSeverity(level)
+			if got := DefaultLevelToSeverity(FromSeverity(severity)); got != severity {
+				t.Errorf("round trip of %v = %v, want %v", severity, got, severity)
+			}
+			if got := FromSeverity(severity); got == zapcore.PanicLevel {
+				t.Errorf("FromSeverity(%v) = %v, want a level that does not panic", severity, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// contextFieldsKey is the context key of the fields registered with WithContextFields.
+type contextFieldsKey struct{}
+
+// WithContextFields returns a copy of the given context carrying the given fields
+// in addition to the fields already registered. The fields are added to every
+// entry logged with the Context field of the returned context.
+//
+// Parameters:
+// - ctx: The parent context.
+// - fields: The fields to register.
+//
+// Returns:
+// - The context carrying the fields.
+func WithContextFields(ctx context.Context, fields ...zap.Field) context.Context {
+	registered := contextFields(ctx)
+	return context.WithValue(ctx, contextFieldsKey{}, append(registered[:len(registered):len(registered)], fields...))
+}
+
+// contextFields returns the fields registered in the given context.
+//
+// Parameters:
+// - ctx: The context.
+//
+// Returns:
+// - The registered fields, or nil if there are none.
+func contextFields(ctx context.Context) []zap.Field {
+	fields, _ := ctx.Value(contextFieldsKey{}).([]zap.Field)
+	return fields
+}
+
+// contextField is the value of a field created by Context.
+// It is expanded into the fields derived from the context before the fields are split.
+type contextField struct {
+	ctx context.Context
+}
+
+// apply does nothing, as context fields are expanded before they are applied.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata, unused.
+func (contextField) apply(string, *entryMeta) {}
+
+// Context returns a zap.Field that correlates the entry with the given context.
+// The trace, span ID and sampling decision are taken from the OpenTelemetry span
+// of the context, and the fields registered with WithContextFields are added to the entry.
+// The baggage members named in Config.BaggageLabels are attached as labels.
+// Set Config.ProjectID to qualify the trace with the project.
+//
+// Parameters:
+// - ctx: The context of the entry.
+//
+// Returns:
+// - A zap.Field that correlates the entry with the context.
+func Context(ctx context.Context) zap.Field {
+	return special("context", contextField{ctx: ctx})
+}
+
+// expandContext replaces the Context fields among the given fields by the fields
+// derived from their context. The given slice is not modified.
+//
+// Parameters:
+// - baggageLabels: The names of the baggage members to attach as labels.
+// - fields: The fields to expand.
+//
+// Returns:
+// - The expanded fields.
+func expandContext(baggageLabels []string, fields []zapcore.Field) []zapcore.Field {
+	var expanded []zapcore.Field
+	for i, f := range fields {
+		cf, ok := f.Interface.(contextField)
+		if !ok || f.Type != zapcore.SkipType {
+			if expanded != nil {
+				expanded = append(expanded, f)
+			}
+			continue
+		}
+		if expanded == nil {
+			expanded = append(make([]zapcore.Field, 0, len(fields)+4), fields[:i]...)
+		}
+		if sc := trace.SpanContextFromContext(cf.ctx); sc.IsValid() {
+			expanded = append(expanded,
+				Trace(sc.TraceID().String()),
+				SpanID(sc.SpanID().String()),
+				TraceSampled(sc.IsSampled()),
+			)
+		}
+		if len(baggageLabels) > 0 {
+			// Missing members are skipped.
+			bag := baggage.FromContext(cf.ctx)
+			for _, name := range baggageLabels {
+				if member := bag.Member(name); member.Key() != "" {
+					expanded = append(expanded, Label(name, member.Value()))
+				}
+			}
+		}
+		expanded = append(expanded, contextFields(cf.ctx)...)
+	}
+	if expanded == nil {
+		return fields
+	}
+
+	return expanded
+}
+
+// cancellation is a zapcore.ObjectMarshaler for the cancellation of a context.
+type cancellation struct {
+	err   error
+	cause error
+}
+
+// MarshalLogObject adds the cancellation to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the cancellation to.
+//
+// Returns:
+// - Always nil.
+func (c cancellation) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("error", c.err.Error())
+	enc.AddString("cause", c.cause.Error())
+	return nil
+}
+
+// CancelCause returns a zap.Field that describes why the given context was cancelled
+// as a nested "cancellation" object with the keys "error", holding the error of the context,
+// and "cause", holding the cause set with context.WithCancelCause or the error of the
+// context if no cause was set. The field is skipped if the context is not cancelled.
+//
+// Parameters:
+// - ctx: The context.
+//
+// Returns:
+// - A zap.Field that describes the cancellation, or a no-op field if the context is live.
+func CancelCause(ctx context.Context) zap.Field {
+	err := ctx.Err()
+	if err == nil {
+		return zap.Skip()
+	}
+
+	return zap.Object("cancellation", cancellation{err: err, cause: context.Cause(ctx)})
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCancelCause(t *testing.T) {
+	shutdown := errors.New("server shutting down")
+
+	tests := []struct {
+		name string
+		ctx  func() context.Context
+		want interface{}
+	}{
+		{
+			name: "live context",
+			ctx:  context.Background,
+		},
+		{
+			name: "cancelled with cause",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancelCause(context.Background())
+				cancel(shutdown)
+				return ctx
+			},
+			want: map[string]interface{}{"error": "context canceled", "cause": "server shutting down"},
+		},
+		{
+			name: "cancelled without cause",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			want: map[string]interface{}{"error": "context canceled", "cause": "context canceled"},
+		},
+		{
+			name: "deadline exceeded",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithDeadline(context.Background(), time.Unix(0, 0))
+				t.Cleanup(cancel)
+				return ctx
+			},
+			want: map[string]interface{}{"error": "context deadline exceeded", "cause": "context deadline exceeded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			if err := core.Write(zapcore.Entry{Level: zapcore.WarnLevel, Message: "request aborted"}, []zapcore.Field{CancelCause(tt.ctx())}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := payloadOf(t, out.Entries()[0])["cancellation"]
+			if tt.want == nil {
+				if ok {
+					t.Errorf("cancellation = %#v, want the field to be skipped", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cancellation = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
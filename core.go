@@ -22,35 +22,127 @@
 package gclzap
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"cloud.google.com/go/logging"
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Core is a custom zapcore.Core implementation that writes logs to Google Cloud Logging.
 type Core struct {
-	out             *logging.Logger
+	out             sink
 	enc             zapcore.Encoder
 	LevelEnabler    zapcore.LevelEnabler
 	LevelToSeverity func(zapcore.Level) logging.Severity
+	config          Config
+	dedup           *deduper
+	labels          map[string]string
+	special         []zapcore.Field
+	fields          []zapcore.Field
+	fallback        zapcore.WriteSyncer
+	file            *fileSyncer
+	routes          map[logging.Severity]sink
+	stats           *stats
+	closeOnce       *sync.Once
+	encoders        map[string]zapcore.Encoder
+	hub             *hub
+	seq             *atomic.Uint64
+	dynamicLabels   *labelCache
 }
 
-// NewCore creates a new Core based on the given configuration.
+// NewCore creates a new Core that writes logs to the given Google Cloud Logging logger.
+// The Core can be combined with other cores, e.g. using zapcore.NewTee,
+// or wrapped by cores for sampling or buffering.
 //
 // Parameters:
 // - out: The Google Cloud Logging logger to write logs to.
-// - config: The configuration for the Encoder.
-// - level: The logging level.
-// - levelToSeverity: A function that converts a zapcore level to a Google Cloud Logging severity.
+// - config: The configuration for the Core.
+//
+// Returns:
+// - A new Core.
+func NewCore(out *logging.Logger, config Config) *Core {
+	return newCore(out, config)
+}
+
+// newCore creates a new Core based on the given configuration.
+//
+// Parameters:
+// - out: The sink to write logs to.
+// - config: The configuration for the Core.
 //
 // Returns:
 // - A new Core.
-func newCore(out *logging.Logger, config EncoderConfig, level zapcore.LevelEnabler, levelToSeverity func(zapcore.Level) logging.Severity) *Core {
-	return &Core{
+func newCore(out sink, config Config) *Core {
+	levelToSeverity := config.LevelToSeverity
+	if levelToSeverity == nil {
+		levelToSeverity = DefaultLevelToSeverity
+	}
+
+	core := &Core{
 		out:             out,
-		enc:             newEncoder(config),
-		LevelEnabler:    level,
+		enc:             newEncoder(config.EncoderConfig, levelToSeverity),
+		LevelEnabler:    config.Level,
 		LevelToSeverity: levelToSeverity,
+		config:          config,
+		fallback:        config.Fallback,
+		stats:           &stats{},
+		closeOnce:       &sync.Once{},
+		hub:             &hub{},
+		seq:             &atomic.Uint64{},
+	}
+	if core.fallback == nil {
+		core.fallback = zapcore.Lock(os.Stderr)
+	}
+	if config.DynamicLabels != nil {
+		core.dynamicLabels = newLabelCache(config.DynamicLabels, config.DynamicLabelsTTL)
 	}
+	if config.AsyncBufferSize > 0 {
+		core.out = newAsyncSink(out, config.AsyncBufferSize, config.DropReportInterval)
+	}
+	if config.FilePath != "" {
+		core.file = newFileSyncer(config.FilePath)
+	}
+	if len(config.Encoders) > 0 {
+		core.encoders = make(map[string]zapcore.Encoder, len(config.Encoders))
+		for name, enc := range config.Encoders {
+			core.encoders[name] = enc.Clone()
+		}
+	}
+	if len(config.LevelSchedule) > 0 {
+		core.LevelEnabler = scheduledLevel{
+			base:     config.Level,
+			schedule: append([]LevelWindow(nil), config.LevelSchedule...),
+			now:      core.now,
+		}
+	}
+	if len(config.SeverityClients) > 0 {
+		core.routes = make(map[logging.Severity]sink, len(config.SeverityClients))
+		for severity, logger := range config.SeverityClients {
+			core.routes[severity] = logger
+		}
+	}
+	if config.DedupWindow > 0 {
+		core.dedup = newDeduper(config.DedupWindow)
+	}
+	if config.IncludeHostInfo {
+		core.labels = hostLabels()
+	}
+	if config.DeployLabelEnv != "" {
+		core.labels = mergeLabels(core.labels, deployLabels(config.DeployLabelEnv))
+	}
+
+	return core
 }
 
 // Level returns the current logging level.
@@ -81,10 +173,54 @@ func (c *Core) Enabled(lvl zapcore.Level) bool {
 // - A new Core with the given fields added.
 func (c *Core) With(fields []zapcore.Field) zapcore.Core {
 	clone := c.clone()
-	addFields(clone.enc, fields)
+	regular, special := splitFields(mapFields(c.config.FieldMapping, expandContext(c.config.BaggageLabels, fields)))
+	regular = normalizeKeys(c.config.KeyNormalizer, regular)
+	if c.config.OmitNilFields {
+		regular = omitNilFields(regular)
+	}
+	if c.config.DeduplicateFields {
+		regular = dedupFields(regular)
+	}
+	regular = encodeFields(c.config.FieldEncoders, regular)
+	clone.special = append(clone.special[:len(clone.special):len(clone.special)], special...)
+	clone.fields = append(clone.fields[:len(clone.fields):len(clone.fields)], regular...)
+	regular = expandErrors(encodeLatencies(regular))
+	addFields(clone.enc, regular)
+	for _, enc := range clone.encoders {
+		addFields(enc, regular)
+	}
 	return clone
 }
 
+// WithOptions returns a new Core with the given fields, labels and monitored resource added.
+// All of them are inherited by the Cores derived from the returned Core.
+//
+// Parameters:
+// - fields: The fields to add.
+// - labels: The labels to add, may be nil.
+// - res: The monitored resource of all entries, may be nil to keep the current one.
+//
+// Returns:
+// - A new Core with the given fields, labels and resource added.
+func (c *Core) WithOptions(fields []zapcore.Field, labels map[string]string, res *mrpb.MonitoredResource) zapcore.Core {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	all := make([]zapcore.Field, 0, len(fields)+len(labels)+1)
+	all = append(all, fields...)
+	for _, k := range keys {
+		all = append(all, Label(k, labels[k]))
+	}
+	if res != nil {
+		all = append(all, Resource(res))
+	}
+
+	return c.With(all)
+}
+
 // Check checks whether the given entry should be logged.
 //
 // Parameters:
@@ -101,7 +237,10 @@ func (c *Core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.Check
 }
 
 // Write writes the given entry and fields to the log buffer.
-// If the log level is higher than ErrorLevel, the log buffer is flushed.
+// If the log level is higher than ErrorLevel or the Core is synchronous, the log buffer is flushed.
+// If deduplication is enabled, identical consecutive entries within the
+// configured window are suppressed and summarized once the window closes.
+// Entries without a time are stamped with the current time of the configured clock.
 //
 // Parameters:
 // - ent: The entry to write.
@@ -110,38 +249,472 @@ func (c *Core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.Check
 // Returns:
 // - An error if the entry could not be written, nil otherwise.
 func (c *Core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
-	buf, err := c.enc.EncodeEntry(ent, fields)
+	// The time is filled here, so that the payload and the entry carry the same timestamp,
+	// instead of the client filling in the timestamp of the entry only.
+	if !c.config.KeepZeroTime && ent.Time.IsZero() {
+		ent.Time = c.now()
+	}
+
+	if c.dedup != nil {
+		suppress, run := c.dedup.observe(c, ent)
+		if run != nil {
+			if err := run.write(); err != nil {
+				return err
+			}
+		}
+		if suppress {
+			return nil
+		}
+	}
+
+	return c.write(ent, fields)
+}
+
+// write encodes the given entry and fields and writes them to Google Cloud Logging.
+//
+// Parameters:
+// - ent: The entry to write.
+// - fields: The fields to write.
+//
+// Returns:
+// - An error if the entry could not be written, nil otherwise.
+func (c *Core) write(ent zapcore.Entry, fields []zapcore.Field) error {
+	severity := c.LevelToSeverity(ent.Level)
+	if c.config.MaxMessageBytes > 0 {
+		ent.Message = truncate(ent.Message, c.config.MaxMessageBytes)
+	}
+	if c.config.DisableCaller {
+		ent.Caller = zapcore.EntryCaller{}
+	}
+
+	regular, special := splitFields(mapFields(c.config.FieldMapping, expandContext(c.config.BaggageLabels, fields)))
+	regular = normalizeKeys(c.config.KeyNormalizer, regular)
+	if c.config.OmitNilFields {
+		regular = omitNilFields(regular)
+	}
+	if c.config.DeduplicateFields {
+		regular = dedupFields(regular)
+	}
+	regular = encodeFields(c.config.FieldEncoders, regular)
+	var truncated int
+	if limit := c.config.MaxFields; limit > 0 {
+		// Fields added with With count towards the limit, as they come first.
+		if allowed := max(limit-len(c.fields), 0); len(regular) > allowed {
+			truncated = len(regular) - allowed
+			regular = regular[:allowed:allowed]
+		}
+	}
+
+	var meta entryMeta
+	meta.collect(c.special)
+	meta.collect(special)
+	// Labels set by the package for the entry are kept apart, as they are not prefixed.
+	var entryLabels map[string]string
+	if c.config.UserIDLabel && meta.identity != nil && meta.identity.id != "" {
+		entryLabels = mergeLabels(entryLabels, map[string]string{userIDLabelKey: meta.identity.id})
+	}
+	if key := c.config.NameAsLabel; key != "" && ent.LoggerName != "" {
+		if _, ok := meta.labels[key]; !ok {
+			entryLabels = mergeLabels(entryLabels, map[string]string{key: ent.LoggerName})
+		}
+	}
+
+	if c.config.ElevateGRPCSeverity {
+		severity = elevateGRPCSeverity(severity, regular)
+	}
+	if severity < c.config.MinSeverity {
+		// Entries below the severity floor are dropped, regardless of the level.
+		return nil
+	}
+
+	payload := expandErrors(encodeLatencies(regular))
+	if meta.payloadType != "" {
+		payload = append([]zapcore.Field{zap.String("@type", meta.payloadType)}, payload...)
+	}
+	if meta.identity != nil {
+		payload = append(payload[:len(payload):len(payload)], zap.Object("user", meta.identity))
+	}
+	if len(meta.flags) > 0 {
+		payload = append(payload[:len(payload):len(payload)], zap.Object("feature_flag", meta.flags))
+	}
+	if len(meta.metrics) > 0 {
+		payload = append(payload[:len(payload):len(payload)], zap.Object("metrics", meta.metrics))
+	}
+	if meta.sql != nil {
+		payload = append(payload[:len(payload):len(payload)], zap.Object("sql", meta.sql.withLimit(c.config.MaxSQLQueryBytes)))
+	}
+	if c.config.IncludeSeverityNumber {
+		payload = append(payload[:len(payload):len(payload)], zap.Int("severityNumber", int(severity)))
+	}
+	if truncated > 0 {
+		payload = append(payload[:len(payload):len(payload)], zap.Int("fields_truncated", truncated))
+	}
+	if c.config.IncludeSequence {
+		payload = append(payload[:len(payload):len(payload)], zap.Uint64("seq", c.seq.Add(1)))
+	}
+	if c.config.TraceURLTemplate != "" && ent.Level >= zapcore.ErrorLevel {
+		if u, ok := traceURL(c.config.TraceURLTemplate, qualifyTrace(c.config.ProjectID, meta.trace)); ok {
+			payload = append(payload[:len(payload):len(payload)], zap.String("trace_url", u))
+		}
+	}
+	if c.config.EnableContextObject && ent.Level >= zapcore.ErrorLevel {
+		user := meta.user
+		if user == "" && meta.identity != nil {
+			user = meta.identity.id
+		}
+		payload = append(payload[:len(payload):len(payload)], zap.Object("context", errorContext{
+			user:    user,
+			request: meta.httpRequest,
+			caller:  ent.Caller,
+		}))
+	}
+
+	enc := c.enc
+	if meta.encoder != "" {
+		if selected, ok := c.encoders[meta.encoder]; ok {
+			enc = selected
+		} else {
+			c.reportError(fmt.Errorf("gclzap: unknown encoder %q, using the default encoder", meta.encoder))
+		}
+	}
+
+	buf, err := enc.EncodeEntry(ent, payload)
+	if err == nil && c.config.IncludePayloadSize {
+		// Encode again with the size of the first encoding,
+		// which approximates the final size up to the size field itself.
+		size := buf.Len()
+		buf.Free()
+		buf, err = enc.EncodeEntry(ent, append(payload[:len(payload):len(payload)], zap.Int("payload_bytes", size)))
+	}
 	defer buf.Free()
 	if err != nil {
 		return err
 	}
 
+	userLabels := meta.labels
+	if c.config.FieldsAsLabels {
+		// Labels set explicitly take precedence over labels promoted from fields.
+		promoted := append(c.fields[:len(c.fields):len(c.fields)], regular...)
+		userLabels = mergeLabels(fieldLabels(promoted, c.config.DropNonStringLabels), userLabels)
+	}
+	if c.config.MDC != nil {
+		userLabels = mergeLabels(c.config.MDC(), userLabels)
+	}
+	if c.dynamicLabels != nil {
+		userLabels = mergeLabels(c.dynamicLabels.get(c.now()), userLabels)
+	}
+	userLabels = prefixLabels(c.config.LabelPrefix, userLabels)
+	if limit := c.config.MaxLabels; limit > 0 {
+		// Labels set by the package itself are kept in favor of user labels.
+		userLabels = mergeLabels(userLabels)
+		if dropped := capLabels(userLabels, limit-len(c.labels)-len(entryLabels)); dropped > 0 {
+			c.reportError(fmt.Errorf("gclzap: dropped %d labels exceeding the limit of %d labels", dropped, limit))
+		}
+	}
+
 	entry := logging.Entry{
-		Timestamp: ent.Time,
-		Severity:  c.LevelToSeverity(ent.Level),
-		Payload:   buf.String(),
+		Timestamp: ent.Time.UTC(),
+		Severity:  severity,
+		Payload:   json.RawMessage(append([]byte(nil), buf.Bytes()...)),
+		Labels:    mergeLabels(userLabels, entryLabels, c.labels),
+		Resource:  c.config.Resource,
+	}
+	if meta.resource != nil {
+		entry.Resource = meta.resource
+	}
+	if len(c.config.ResourceLabelFields) > 0 && entry.Resource != nil {
+		entry.Resource = liftResourceLabels(entry.Resource, c.config.ResourceLabelFields, c.fields, regular)
+	}
+	entry.Trace = qualifyTrace(c.config.ProjectID, meta.trace)
+	entry.SpanID = meta.spanID
+	entry.TraceSampled = meta.sampled
+	if meta.operationID != "" {
+		entry.Operation = &logpb.LogEntryOperation{
+			Id:       meta.operationID,
+			Producer: c.config.OperationProducer,
+		}
+	}
+	entry.InsertID = meta.insertID
+	entry.HTTPRequest = meta.httpRequest
+	if c.config.PayloadMarshaler != nil {
+		// The encoded payload is kept if it cannot be prepared.
+		if prepared, err := marshalPayload(c.config.PayloadMarshaler, buf.Bytes()); err != nil {
+			c.reportError(err)
+		} else {
+			entry.Payload = prepared
+		}
+	}
+	if c.config.FieldsAsLabels || (c.config.PreferTextPayload && len(payload) == 0 && len(c.fields) == 0) {
+		entry.Payload = ent.Message
+	}
+	if ent.Caller.Defined {
+		entry.SourceLocation = &logpb.LogEntrySourceLocation{
+			File:     ent.Caller.File,
+			Line:     int64(ent.Caller.Line),
+			Function: ent.Caller.Function,
+		}
 	}
 
-	// Write the log entry.
-	c.out.Log(entry)
+	// Validate the payload in development mode.
+	// Invalid entries are still written, but the error is returned.
+	var schemaErr error
+	if c.config.Development && c.config.PayloadSchema != nil {
+		schemaErr = validatePayload(c.config.PayloadSchema, buf.Bytes())
+	}
+
+	// Tee the entry to the file, if any, in the structured logging format,
+	// so that the file holds the trace, labels and source location as well.
+	var fileErr error
+	if c.file != nil {
+		var line []byte
+		if line, fileErr = renderStructured(entry); fileErr == nil {
+			_, fileErr = c.file.Write(line)
+		}
+	}
 
 	// Since we may be crashing the program, sync the output.
-	if ent.Level >= zapcore.ErrorLevel {
-		err := c.Sync()
-		if err != nil {
-			return err
+	// In synchronous mode, every entry is flushed to preserve ordering.
+	flush := c.config.Synchronous || ent.Level >= zapcore.ErrorLevel
+	out := c.sinkFor(severity)
+	if flush && c.config.WriteTimeout > 0 {
+		return errors.Join(schemaErr, fileErr, c.writeWithTimeout(out, entry, buf.Bytes()))
+	}
+
+	// Write the log entry.
+	out.Log(entry)
+	c.stats.add(severity)
+	c.hub.publish(entry)
+
+	if flush {
+		return errors.Join(schemaErr, fileErr, c.Sync())
+	}
+
+	return errors.Join(schemaErr, fileErr)
+}
+
+// WriteBatch writes the given pre-built entries in timestamp order and flushes once,
+// bypassing the encoder. It is meant for bulk ingestion, e.g. of historical logs.
+// Entries with equal timestamps keep their relative order.
+// The given slice is not modified.
+// Invalid entries, e.g. with out of range timestamps or malformed labels, are skipped
+// while the valid entries are still written.
+// If Config.BatchFlushSize is set, the sinks are flushed after each full chunk of that size,
+// while the Core is synced, e.g. running Config.PreFlushHook, only once at the end.
+//
+// Parameters:
+// - entries: The entries to write.
+//
+// Returns:
+//   - An error listing the skipped entries by their index in the given slice
+//     joined with the flush error, nil if all entries were written and flushed.
+func (c *Core) WriteBatch(entries []logging.Entry) error {
+	var errs []error
+	valid := make([]logging.Entry, 0, len(entries))
+	for i, entry := range entries {
+		if err := validateEntry(entry); err != nil {
+			errs = append(errs, fmt.Errorf("gclzap: entry %d: %w", i, err))
+			continue
 		}
+		valid = append(valid, entry)
 	}
+	sort.SliceStable(valid, func(i, j int) bool {
+		return valid[i].Timestamp.Before(valid[j].Timestamp)
+	})
 
+	// The sinks written to since the last chunk was flushed.
+	written := map[sink]bool{}
+	for i, entry := range valid {
+		out := c.sinkFor(entry.Severity)
+		out.Log(entry)
+		written[out] = true
+		c.stats.add(entry.Severity)
+		c.hub.publish(entry)
+
+		// Flush full chunks to the sinks only, the whole Core is synced once below.
+		if size := c.config.BatchFlushSize; size > 0 && (i+1)%size == 0 && i+1 < len(valid) {
+			for out := range written {
+				errs = append(errs, out.Flush())
+			}
+			clear(written)
+		}
+	}
+
+	errs = append(errs, c.Sync())
+	return errors.Join(errs...)
+}
+
+// Limits of labels accepted by Google Cloud Logging.
+const (
+	maxLabelKeyBytes   = 512
+	maxLabelValueBytes = 64 * 1024
+)
+
+// validateEntry checks that the given entry is accepted by Google Cloud Logging.
+// A zero timestamp is valid, as it is filled in by the client.
+//
+// Parameters:
+// - entry: The entry to validate.
+//
+// Returns:
+// - An error describing why the entry is invalid, nil otherwise.
+func validateEntry(entry logging.Entry) error {
+	if !entry.Timestamp.IsZero() {
+		if err := timestamppb.New(entry.Timestamp).CheckValid(); err != nil {
+			return fmt.Errorf("invalid timestamp: %w", err)
+		}
+	}
+	for key, value := range entry.Labels {
+		if key == "" {
+			return errors.New("empty label key")
+		}
+		if len(key) > maxLabelKeyBytes {
+			return fmt.Errorf("label key %q exceeds %d bytes", truncate(key, 32), maxLabelKeyBytes)
+		}
+		if len(value) > maxLabelValueBytes {
+			return fmt.Errorf("value of label %q exceeds %d bytes", key, maxLabelValueBytes)
+		}
+	}
 	return nil
 }
 
+// writeWithTimeout writes and flushes the given entry, bounded by the configured write timeout.
+// If the timeout expires, the encoded entry is written to the fallback syncer instead.
+// The entry may still reach Google Cloud Logging after the timeout has expired.
+//
+// Parameters:
+// - out: The sink to write the entry to.
+// - entry: The entry to write.
+// - encoded: The encoded entry, written to the fallback syncer on timeout.
+//
+// Returns:
+// - An error if the entry could not be written, nil otherwise.
+func (c *Core) writeWithTimeout(out sink, entry logging.Entry, encoded []byte) error {
+	done := make(chan error, 1)
+	go func() {
+		out.Log(entry)
+		c.stats.add(entry.Severity)
+		c.hub.publish(entry)
+		done <- c.Sync()
+	}()
+
+	timer := time.NewTimer(c.config.WriteTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		_, err := c.fallback.Write(encoded)
+		return err
+	}
+}
+
 // Sync flushes the log buffer.
+// The configured pre-flush hook runs first, and pending deduplication summaries
+// are written before flushing. Neither a failing hook nor a failing summary prevents the flush.
 //
 // Returns:
-// - An error if the log buffer could not be flushed, nil otherwise.
+// - An error if the hook failed or the log buffer could not be flushed, nil otherwise.
 func (c *Core) Sync() error {
-	return c.out.Flush()
+	var hookErr error
+	if c.config.PreFlushHook != nil {
+		hookErr = c.config.PreFlushHook()
+	}
+
+	errs := []error{hookErr}
+	if c.dedup != nil {
+		if run := c.dedup.drain(); run != nil {
+			errs = append(errs, run.write())
+		}
+	}
+
+	errs = append(errs, c.out.Flush())
+	flushed := map[sink]bool{c.out: true}
+	for _, route := range c.routes {
+		if !flushed[route] {
+			flushed[route] = true
+			errs = append(errs, route.Flush())
+		}
+	}
+	if c.file != nil {
+		errs = append(errs, c.file.Sync())
+	}
+
+	return errors.Join(errs...)
+}
+
+// Stats returns the number of entries written by the Core and its clones, by severity.
+//
+// Returns:
+// - The number of entries written by severity.
+func (c *Core) Stats() SeverityCounts {
+	return c.stats.snapshot()
+}
+
+// Close flushes the log buffer and closes the file configured by Config.FilePath, if any.
+// If the Core is configured to emit a summary on close, a summary entry holding
+// the number of entries written by severity is written before flushing.
+// The summary is written at most once, even if Close is called multiple times
+// or on multiple clones.
+// In asynchronous mode, the background goroutine shared with the clones is stopped,
+// and entries written afterwards are written synchronously.
+//
+// Returns:
+// - An error if the summary could not be written or the log buffer could not be flushed, nil otherwise.
+func (c *Core) Close() error {
+	var err error
+	if c.config.EmitSummaryOnClose {
+		c.closeOnce.Do(func() {
+			ent := zapcore.Entry{Level: zapcore.InfoLevel, Time: c.now(), Message: "log summary"}
+			err = c.write(ent, []zapcore.Field{zap.Object("entries", c.stats.snapshot())})
+		})
+	}
+
+	err = errors.Join(err, c.Sync())
+	if closer, ok := c.out.(interface{ Close() error }); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	if c.file != nil {
+		err = errors.Join(err, c.file.Close())
+	}
+
+	return err
+}
+
+// sinkFor returns the sink entries with the given severity are written to.
+//
+// Parameters:
+// - severity: The severity of the entry.
+//
+// Returns:
+// - The sink configured for the severity, or the default sink.
+func (c *Core) sinkFor(severity logging.Severity) sink {
+	if route, ok := c.routes[severity]; ok {
+		return route
+	}
+	return c.out
+}
+
+// now returns the current time of the configured clock.
+//
+// Returns:
+// - The current time.
+func (c *Core) now() time.Time {
+	if c.config.Clock != nil {
+		return c.config.Clock.Now()
+	}
+	return time.Now()
+}
+
+// reportError reports the given error to the configured error handler, if any.
+// It is used for errors that do not prevent the entry from being written.
+//
+// Parameters:
+// - err: The error to report.
+func (c *Core) reportError(err error) {
+	if c.config.OnError != nil {
+		c.config.OnError(err)
+	}
 }
 
 // clone returns a copy of the Core.
@@ -149,12 +722,15 @@ func (c *Core) Sync() error {
 // Returns:
 // - A copy of the Core.
 func (c *Core) clone() *Core {
-	return &Core{
-		LevelEnabler:    c.LevelEnabler,
-		enc:             c.enc.Clone(),
-		out:             c.out,
-		LevelToSeverity: c.LevelToSeverity,
+	clone := *c
+	clone.enc = c.enc.Clone()
+	if c.encoders != nil {
+		clone.encoders = make(map[string]zapcore.Encoder, len(c.encoders))
+		for name, enc := range c.encoders {
+			clone.encoders[name] = enc.Clone()
+		}
 	}
+	return &clone
 }
 
 // addFields adds the given fields to the encoder.
@@ -0,0 +1,1010 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestIncludeSeverityNumber(t *testing.T) {
+	tests := []struct {
+		level      zapcore.Level
+		wantString string
+		wantNumber float64
+	}{
+		{zapcore.DebugLevel, "DEBUG", 100},
+		{zapcore.InfoLevel, "INFO", 200},
+		{zapcore.WarnLevel, "WARNING", 400},
+		{zapcore.ErrorLevel, "ERROR", 500},
+		{zapcore.DPanicLevel, "CRITICAL", 600},
+		{zapcore.PanicLevel, "CRITICAL", 600},
+		{zapcore.FatalLevel, "EMERGENCY", 800},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{Level: zapcore.DebugLevel, IncludeSeverityNumber: true})
+			if err := core.Write(zapcore.Entry{Level: tt.level, Message: "hello"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			payload := payloadOf(t, entry)
+			if payload["severity"] != tt.wantString {
+				t.Errorf("severity = %v, want %q", payload["severity"], tt.wantString)
+			}
+			if payload["severityNumber"] != tt.wantNumber {
+				t.Errorf("severityNumber = %v, want %v", payload["severityNumber"], tt.wantNumber)
+			}
+			if entry.Severity != logging.Severity(tt.wantNumber) {
+				t.Errorf("entry severity = %v, want %v", entry.Severity, tt.wantNumber)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		out := &fakeSink{}
+		core := newCore(out, Config{})
+		if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := payloadOf(t, out.Entries()[0])["severityNumber"]; ok {
+			t.Errorf("severityNumber = %v, want none", got)
+		}
+	})
+}
+
+// blockingSink is a sink whose flushes block until it is released.
+type blockingSink struct {
+	fakeSink
+	release chan struct{}
+}
+
+// Flush blocks until the sink is released.
+//
+// Returns:
+// - The configured flush error.
+func (s *blockingSink) Flush() error {
+	<-s.release
+	return s.fakeSink.Flush()
+}
+
+func TestWriteTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		block        bool
+		wantFallback bool
+	}{
+		{name: "blocking sink falls back", block: true, wantFallback: true},
+		{name: "fast sink", block: false, wantFallback: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &blockingSink{release: make(chan struct{})}
+			if !tt.block {
+				close(out.release)
+			} else {
+				t.Cleanup(func() { close(out.release) })
+			}
+			var fallback bytes.Buffer
+			core := newCore(out, Config{
+				Synchronous:  true,
+				WriteTimeout: 20 * time.Millisecond,
+				Fallback:     zapcore.AddSync(&fallback),
+			})
+
+			start := time.Now()
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Write took %v, want it to be bounded by the timeout", elapsed)
+			}
+			if got := strings.Contains(fallback.String(), `"message":"hello"`); got != tt.wantFallback {
+				t.Errorf("fallback = %q, want the entry written: %v", fallback.String(), tt.wantFallback)
+			}
+		})
+	}
+}
+
+func TestIncludePayloadSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []zapcore.Field
+	}{
+		{name: "message only"},
+		{name: "with fields", fields: []zapcore.Field{zap.String("user", "alice"), zap.Int("attempt", 3)}},
+		{name: "large field", fields: []zapcore.Field{zap.String("body", strings.Repeat("x", 10000))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{IncludePayloadSize: true})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			size, ok := payloadOf(t, entry)["payload_bytes"].(float64)
+			if !ok {
+				t.Fatal("payload_bytes missing")
+			}
+			// The size is measured before the size field itself is added.
+			actual := len(entry.Payload.(json.RawMessage))
+			if diff := actual - int(size); diff < 0 || diff > len(`,"payload_bytes":00000`) {
+				t.Errorf("payload_bytes = %v, actual size %d", size, actual)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		out := &fakeSink{}
+		core := newCore(out, Config{})
+		if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := payloadOf(t, out.Entries()[0])["payload_bytes"]; ok {
+			t.Errorf("payload_bytes = %v, want none", got)
+		}
+	})
+}
+
+func TestSeverityClients(t *testing.T) {
+	tests := []struct {
+		name       string
+		level      zapcore.Level
+		wantRouted bool
+	}{
+		{name: "info to default", level: zapcore.InfoLevel, wantRouted: false},
+		{name: "error routed", level: zapcore.ErrorLevel, wantRouted: true},
+		{name: "warning to default", level: zapcore.WarnLevel, wantRouted: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routed, server := newFakeLogger(t)
+			out := &fakeSink{}
+			core := newCore(out, Config{SeverityClients: map[logging.Severity]*logging.Logger{logging.Error: routed}})
+			if err := core.Write(zapcore.Entry{Level: tt.level, Message: "hello"}, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := core.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			wantDefault, wantRouted := 1, 0
+			if tt.wantRouted {
+				wantDefault, wantRouted = 0, 1
+			}
+			if got := len(out.Entries()); got != wantDefault {
+				t.Errorf("got %d entries in the default sink, want %d", got, wantDefault)
+			}
+			if got := len(server.Entries()); got != wantRouted {
+				t.Errorf("got %d routed entries, want %d", got, wantRouted)
+			}
+		})
+	}
+}
+
+// fixedClock is a zapcore.Clock returning a fixed time.
+type fixedClock struct {
+	now time.Time
+}
+
+// Now returns the fixed time.
+//
+// Returns:
+// - The fixed time.
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+// NewTicker returns a ticker of the system clock.
+//
+// Parameters:
+// - d: The interval of the ticker.
+//
+// Returns:
+// - A new ticker.
+func (fixedClock) NewTicker(d time.Duration) *time.Ticker {
+	return time.NewTicker(d)
+}
+
+func TestMissingTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	given := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		keepZeroTime bool
+		time         time.Time
+		want         time.Time
+	}{
+		{name: "zero time is stamped", time: time.Time{}, want: now},
+		{name: "given time is kept", time: given, want: given},
+		{name: "zero time is kept", keepZeroTime: true, time: time.Time{}, want: time.Time{}},
+		{name: "given time is kept with zero time kept", keepZeroTime: true, time: given, want: given},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{EncoderConfig: DefaultEncoderConfig(), Clock: fixedClock{now: now}, KeepZeroTime: tt.keepZeroTime})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Time: tt.time, Message: "hello"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if !entry.Timestamp.Equal(tt.want) {
+				t.Errorf("timestamp = %v, want %v", entry.Timestamp, tt.want)
+			}
+			got, ok := payloadOf(t, entry)["time"]
+			if tt.want.IsZero() {
+				if ok {
+					t.Errorf("payload time = %v, want none for the zero time", got)
+				}
+				return
+			}
+			if got != tt.want.Format("2006-01-02T15:04:05.000Z0700") {
+				t.Errorf("payload time = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSynchronous(t *testing.T) {
+	tests := []struct {
+		name        string
+		synchronous bool
+		level       zapcore.Level
+		wantFlushes int
+	}{
+		{name: "synchronous", synchronous: true, level: zapcore.InfoLevel, wantFlushes: 3},
+		{name: "asynchronous", synchronous: false, level: zapcore.InfoLevel, wantFlushes: 0},
+		{name: "errors are always flushed", synchronous: false, level: zapcore.ErrorLevel, wantFlushes: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{Synchronous: tt.synchronous})
+			for i := 0; i < 3; i++ {
+				if err := core.Write(zapcore.Entry{Level: tt.level, Message: "hello"}, nil); err != nil {
+					t.Fatal(err)
+				}
+				if got, want := out.Flushes(), tt.wantFlushes*(i+1)/3; got != want {
+					t.Errorf("after write %d: got %d flushes, want %d", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPreferTextPayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefer   bool
+		with     []zapcore.Field
+		fields   []zapcore.Field
+		wantText bool
+	}{
+		{name: "field-less entry as text", prefer: true, wantText: true},
+		{name: "entry with fields as JSON", prefer: true, fields: []zapcore.Field{zap.Int("n", 1)}, wantText: false},
+		{name: "inherited fields as JSON", prefer: true, with: []zapcore.Field{zap.Int("n", 1)}, wantText: false},
+		{name: "labels only as text", prefer: true, fields: []zapcore.Field{Label("team", "core")}, wantText: true},
+		{name: "disabled", prefer: false, wantText: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{PreferTextPayload: tt.prefer}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if !tt.wantText {
+				if got := payloadOf(t, entry)["message"]; got != "hello" {
+					t.Errorf("message = %v, want %q", got, "hello")
+				}
+				return
+			}
+			if entry.Payload != "hello" {
+				t.Errorf("payload = %#v, want the text payload %q", entry.Payload, "hello")
+			}
+		})
+	}
+}
+
+// discardSink is a sink discarding all entries.
+type discardSink struct{}
+
+// Log discards the given entry.
+//
+// Parameters:
+// - e: The entry to discard.
+func (discardSink) Log(logging.Entry) {}
+
+// Flush does nothing.
+//
+// Returns:
+// - Always nil.
+func (discardSink) Flush() error { return nil }
+
+// BenchmarkWriteRepeatedFields measures the allocations of writing entries
+// whose string fields repeat the same values, e.g. tenants and regions.
+// Run it with -benchmem.
+func BenchmarkWriteRepeatedFields(b *testing.B) {
+	core := newCore(discardSink{}, Config{EncoderConfig: DefaultEncoderConfig()})
+	ent := zapcore.Entry{Level: zapcore.InfoLevel, Time: time.Now(), Message: "request served"}
+	fields := []zapcore.Field{
+		zap.String("tenant", "acme"),
+		zap.String("region", "europe-west1"),
+		zap.String("status", "ok"),
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := core.Write(ent, fields); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestNewCoreTee(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     zapcore.Level
+		wantCloud int
+		wantLocal bool
+	}{
+		{name: "info reaches both", level: zapcore.InfoLevel, wantCloud: 1, wantLocal: true},
+		{name: "debug below the level of the core", level: zapcore.DebugLevel, wantCloud: 0, wantLocal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, server := newFakeLogger(t)
+			var local bytes.Buffer
+			tee := zapcore.NewTee(
+				NewCore(out, NewProductionConfig()),
+				zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.AddSync(&local), zapcore.DebugLevel),
+			)
+			logger := zap.New(tee)
+			logger.Check(tt.level, "hello").Write(zap.String("user", "alice"))
+			if err := logger.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := len(server.Entries()); got != tt.wantCloud {
+				t.Errorf("got %d entries in Cloud Logging, want %d", got, tt.wantCloud)
+			}
+			if got := strings.Contains(local.String(), `"user":"alice"`); got != tt.wantLocal {
+				t.Errorf("local output = %q, want the entry: %v", local.String(), tt.wantLocal)
+			}
+		})
+	}
+}
+
+func TestNewCoreWithOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		log    func(logger *zap.Logger)
+		want   logging.Severity
+	}{
+		{
+			name:   "info",
+			config: NewProductionConfig(),
+			log:    func(logger *zap.Logger) { logger.Info("hello", zap.String("user", "alice")) },
+			want:   logging.Info,
+		},
+		{
+			name:   "fatal without exit",
+			config: Config{EncoderConfig: DefaultEncoderConfig(), DisableFatalExit: true},
+			log:    func(logger *zap.Logger) { logger.Fatal("hello", zap.String("user", "alice")) },
+			want:   logging.Emergency,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, server := newFakeLogger(t)
+			logger := zap.New(NewCore(out, tt.config), tt.config.Options()...)
+			tt.log(logger)
+			if err := logger.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries := server.Entries()
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			if got := logging.Severity(entries[0].GetSeverity()); got != tt.want {
+				t.Errorf("severity = %v, want %v", got, tt.want)
+			}
+			if got := entries[0].GetJsonPayload().GetFields()["user"].GetStringValue(); got != "alice" {
+				t.Errorf("user = %q, want %q", got, "alice")
+			}
+		})
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(payload string, offset time.Duration) logging.Entry {
+		return logging.Entry{Timestamp: base.Add(offset), Severity: logging.Info, Payload: payload}
+	}
+
+	tests := []struct {
+		name    string
+		entries []logging.Entry
+		want    []string
+	}{
+		{name: "empty"},
+		{
+			name:    "sorted by timestamp",
+			entries: []logging.Entry{entry("c", 2*time.Second), entry("a", 0), entry("b", time.Second)},
+			want:    []string{"a", "b", "c"},
+		},
+		{
+			name:    "equal timestamps keep their order",
+			entries: []logging.Entry{entry("b1", time.Second), entry("a", 0), entry("b2", time.Second), entry("b3", time.Second)},
+			want:    []string{"a", "b1", "b2", "b3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			given := append([]logging.Entry(nil), tt.entries...)
+			if err := core.WriteBatch(tt.entries); err != nil {
+				t.Fatal(err)
+			}
+
+			entries := out.Entries()
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(entries), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if entries[i].Payload != want {
+					t.Errorf("entry %d = %v, want %q", i, entries[i].Payload, want)
+				}
+			}
+			if got := out.Flushes(); got != 1 {
+				t.Errorf("got %d flushes, want 1", got)
+			}
+			for i := range given {
+				if given[i].Payload != tt.entries[i].Payload {
+					t.Fatal("the given slice has been modified")
+				}
+			}
+		})
+	}
+}
+
+func TestBatchFlushSize(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		entries     int
+		size        int
+		wantFlushes int
+	}{
+		{name: "unchunked", entries: 10, wantFlushes: 1},
+		{name: "partial last chunk", entries: 10, size: 4, wantFlushes: 3},
+		{name: "full last chunk", entries: 10, size: 5, wantFlushes: 2},
+		{name: "chunk larger than batch", entries: 10, size: 20, wantFlushes: 1},
+		{name: "large batch", entries: 2500, size: 1000, wantFlushes: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := make([]logging.Entry, tt.entries)
+			for i := range entries {
+				entries[i] = logging.Entry{Timestamp: base.Add(time.Duration(i) * time.Second), Severity: logging.Info, Payload: strconv.Itoa(i)}
+			}
+			hooks := 0
+			out := &fakeSink{}
+			core := newCore(out, Config{BatchFlushSize: tt.size, PreFlushHook: func() error {
+				hooks++
+				return nil
+			}})
+
+			if err := core.WriteBatch(entries); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(out.Entries()); got != tt.entries {
+				t.Errorf("got %d entries, want %d", got, tt.entries)
+			}
+			if got := out.Flushes(); got != tt.wantFlushes {
+				t.Errorf("got %d flushes, want %d", got, tt.wantFlushes)
+			}
+			// The Core itself is synced once per batch.
+			if hooks != 1 {
+				t.Errorf("pre-flush hook ran %d times, want 1", hooks)
+			}
+		})
+	}
+}
+
+func TestBatchFlushSizeRoutes(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	severities := []logging.Severity{logging.Info, logging.Info, logging.Error, logging.Info, logging.Info, logging.Info}
+	entries := make([]logging.Entry, len(severities))
+	for i, severity := range severities {
+		entries[i] = logging.Entry{Timestamp: base.Add(time.Duration(i) * time.Second), Severity: severity}
+	}
+
+	out := &fakeSink{}
+	errOut := &fakeSink{}
+	core := newCore(out, Config{BatchFlushSize: 3})
+	core.routes = map[logging.Severity]sink{logging.Error: errOut}
+	if err := core.WriteBatch(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the sinks written to in a chunk are flushed after it, all sinks at the end.
+	if got := out.Flushes(); got != 2 {
+		t.Errorf("got %d flushes of the default sink, want 2", got)
+	}
+	if got := errOut.Flushes(); got != 2 {
+		t.Errorf("got %d flushes of the routed sink, want 2", got)
+	}
+	if got := len(errOut.Entries()); got != 1 {
+		t.Errorf("got %d routed entries, want 1", got)
+	}
+}
+
+func TestMinSeverity(t *testing.T) {
+	tests := []struct {
+		name      string
+		floor     logging.Severity
+		elevate   bool
+		level     zapcore.Level
+		fields    []zapcore.Field
+		wantWrite bool
+	}{
+		{name: "no floor", level: zapcore.DebugLevel, wantWrite: true},
+		{name: "debug below notice", floor: logging.Notice, level: zapcore.DebugLevel},
+		{name: "info below notice", floor: logging.Notice, level: zapcore.InfoLevel},
+		{name: "warning above notice", floor: logging.Notice, level: zapcore.WarnLevel, wantWrite: true},
+		{name: "at the floor", floor: logging.Warning, level: zapcore.WarnLevel, wantWrite: true},
+		{
+			name:      "elevated above the floor",
+			floor:     logging.Notice,
+			elevate:   true,
+			level:     zapcore.DebugLevel,
+			fields:    []zapcore.Field{zap.Int(grpcCodeKey, 13)},
+			wantWrite: true,
+		},
+		{
+			name:   "not elevated without the option",
+			floor:  logging.Notice,
+			level:  zapcore.DebugLevel,
+			fields: []zapcore.Field{zap.Int(grpcCodeKey, 13)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{Level: zapcore.DebugLevel, MinSeverity: tt.floor, ElevateGRPCSeverity: tt.elevate})
+			if err := core.Write(zapcore.Entry{Level: tt.level, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			if written := len(out.Entries()) > 0; written != tt.wantWrite {
+				t.Errorf("written = %v, want %v", written, tt.wantWrite)
+			}
+			// The level filter is independent of the floor.
+			if !core.Enabled(tt.level) {
+				t.Errorf("level %v disabled by the severity floor", tt.level)
+			}
+		})
+	}
+}
+
+func TestMaxFields(t *testing.T) {
+	fields := func(prefix string, n int) []zapcore.Field {
+		fs := make([]zapcore.Field, n)
+		for i := range fs {
+			fs[i] = zap.Int(prefix+strconv.Itoa(i), i)
+		}
+		return fs
+	}
+
+	tests := []struct {
+		name          string
+		max           int
+		with          []zapcore.Field
+		fields        []zapcore.Field
+		wantKeys      []string
+		wantTruncated interface{}
+	}{
+		{name: "no limit", fields: fields("f", 3), wantKeys: []string{"f0", "f1", "f2"}},
+		{name: "within the limit", max: 3, fields: fields("f", 3), wantKeys: []string{"f0", "f1", "f2"}},
+		{name: "first fields kept", max: 2, fields: fields("f", 5), wantKeys: []string{"f0", "f1"}, wantTruncated: float64(3)},
+		{name: "With fields counted", max: 3, with: fields("w", 2), fields: fields("f", 3), wantKeys: []string{"w0", "w1", "f0"}, wantTruncated: float64(2)},
+		{name: "With fields exceeding the limit", max: 1, with: fields("w", 2), fields: fields("f", 2), wantKeys: []string{"w0", "w1"}, wantTruncated: float64(2)},
+		{
+			name:     "special fields not counted",
+			max:      1,
+			fields:   []zapcore.Field{Label("tenant", "acme"), zap.Int("f0", 0)},
+			wantKeys: []string{"f0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{MaxFields: tt.max}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			payload := payloadOf(t, out.Entries()[0])
+			if got := payload["fields_truncated"]; got != tt.wantTruncated {
+				t.Errorf("fields_truncated = %v, want %v", got, tt.wantTruncated)
+			}
+			for _, key := range []string{"fields_truncated", "message", "severity", "time"} {
+				delete(payload, key)
+			}
+			if len(payload) != len(tt.wantKeys) {
+				t.Errorf("payload = %v, want the keys %v", payload, tt.wantKeys)
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := payload[key]; !ok {
+					t.Errorf("key %q missing from the payload %v", key, payload)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxMessageBytes(t *testing.T) {
+	long := strings.Repeat("a", 32)
+
+	tests := []struct {
+		name    string
+		max     int
+		message string
+		want    string
+	}{
+		{name: "disabled", message: long, want: long},
+		{name: "short message", max: 64, message: "hello", want: "hello"},
+		{name: "exact length", max: 32, message: long, want: long},
+		{name: "truncated", max: 10, message: long, want: strings.Repeat("a", 10-len(ellipsis)) + ellipsis},
+		{name: "not cut within a rune", max: 7, message: "ab€€€", want: "ab" + ellipsis},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{MaxMessageBytes: tt.max})
+			fields := []zapcore.Field{zap.String("detail", long)}
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: tt.message}, fields); err != nil {
+				t.Fatal(err)
+			}
+
+			payload := payloadOf(t, out.Entries()[0])
+			if got := payload["message"]; got != tt.want {
+				t.Errorf("message = %q, want %q", got, tt.want)
+			}
+			if got := payload["detail"]; got != long {
+				t.Errorf("detail = %q, want %q", got, long)
+			}
+		})
+	}
+}
+
+func TestWithOptions(t *testing.T) {
+	res := &mrpb.MonitoredResource{Type: "cloud_run_revision", Labels: map[string]string{"service_name": "orders"}}
+
+	tests := []struct {
+		name       string
+		fields     []zapcore.Field
+		labels     map[string]string
+		res        *mrpb.MonitoredResource
+		wantFields map[string]interface{}
+		wantLabels map[string]string
+		wantRes    *mrpb.MonitoredResource
+	}{
+		{name: "nothing"},
+		{
+			name:       "all three",
+			fields:     []zapcore.Field{zap.String("request_id", "r-1")},
+			labels:     map[string]string{"tenant": "acme", "region": "eu"},
+			res:        res,
+			wantFields: map[string]interface{}{"request_id": "r-1"},
+			wantLabels: map[string]string{"tenant": "acme", "region": "eu"},
+			wantRes:    res,
+		},
+		{
+			name:       "labels only",
+			labels:     map[string]string{"tenant": "acme"},
+			wantLabels: map[string]string{"tenant": "acme"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			scoped := newCore(out, Config{}).WithOptions(tt.fields, tt.labels, tt.res)
+			derived := scoped.With([]zapcore.Field{zap.String("step", "derived")})
+			if err := derived.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			payload := payloadOf(t, entry)
+			for k, v := range tt.wantFields {
+				if payload[k] != v {
+					t.Errorf("%s = %#v, want %#v", k, payload[k], v)
+				}
+			}
+			if payload["step"] != "derived" {
+				t.Errorf("step = %#v, want the derived field", payload["step"])
+			}
+			if len(entry.Labels) != len(tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", entry.Labels, tt.wantLabels)
+			}
+			for k, v := range tt.wantLabels {
+				if entry.Labels[k] != v {
+					t.Errorf("label %q = %q, want %q", k, entry.Labels[k], v)
+				}
+			}
+			if !proto.Equal(entry.Resource, tt.wantRes) {
+				t.Errorf("resource = %v, want %v", entry.Resource, tt.wantRes)
+			}
+		})
+	}
+}
+
+// BenchmarkCaller compares logging with caller capture to logging with Config.DisableCaller.
+func BenchmarkCaller(b *testing.B) {
+	benchmarks := []struct {
+		name          string
+		disableCaller bool
+	}{
+		{name: "AddCaller"},
+		{name: "DisableCaller", disableCaller: true},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			config := Config{EncoderConfig: DefaultEncoderConfig(), DisableCaller: bm.disableCaller}
+			logger := zap.New(newCore(discardSink{}, config), append([]zap.Option{zap.AddCaller()}, config.Options()...)...)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				logger.Info("request served")
+			}
+		})
+	}
+}
+
+func TestWriteBatchPartialSuccess(t *testing.T) {
+	valid := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tooEarly := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		entries    []logging.Entry
+		want       []string
+		wantFailed []string
+	}{
+		{
+			name: "all valid",
+			entries: []logging.Entry{
+				{Timestamp: valid, Payload: "a"},
+				{Payload: "zero timestamp"},
+			},
+			want: []string{"zero timestamp", "a"},
+		},
+		{
+			name: "mixed",
+			entries: []logging.Entry{
+				{Timestamp: valid, Payload: "a"},
+				{Timestamp: tooEarly, Payload: "bad timestamp"},
+				{Timestamp: valid, Payload: "b", Labels: map[string]string{"": "x"}},
+				{Timestamp: valid, Payload: "c", Labels: map[string]string{strings.Repeat("k", maxLabelKeyBytes+1): "x"}},
+				{Timestamp: valid, Payload: "d", Labels: map[string]string{"k": strings.Repeat("v", maxLabelValueBytes+1)}},
+				{Timestamp: valid, Payload: "e", Labels: map[string]string{"k": "v"}},
+			},
+			want:       []string{"a", "e"},
+			wantFailed: []string{"entry 1: invalid timestamp", "entry 2: empty label key", "entry 3: label key", "entry 4: value of label"},
+		},
+		{
+			name:       "all invalid",
+			entries:    []logging.Entry{{Timestamp: tooEarly, Payload: "bad"}},
+			wantFailed: []string{"entry 0: invalid timestamp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			err := core.WriteBatch(tt.entries)
+
+			entries := out.Entries()
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(entries), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if entries[i].Payload != want {
+					t.Errorf("entry %d = %v, want %q", i, entries[i].Payload, want)
+				}
+			}
+			if len(tt.wantFailed) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error listing the skipped entries")
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.wantFailed) {
+				t.Fatalf("got %d failures, want %d: %v", len(lines), len(tt.wantFailed), err)
+			}
+			for i, want := range tt.wantFailed {
+				if !strings.Contains(lines[i], want) {
+					t.Errorf("failure %d = %q, want it to contain %q", i, lines[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPreFlushHook(t *testing.T) {
+	hookErr := errors.New("spans not exported")
+	flushErr := errors.New("flush failed")
+
+	tests := []struct {
+		name     string
+		hookErr  error
+		flushErr error
+		wantErrs []error
+	}{
+		{name: "success"},
+		{name: "hook error propagates", hookErr: hookErr, wantErrs: []error{hookErr}},
+		{name: "errors are joined", hookErr: hookErr, flushErr: flushErr, wantErrs: []error{hookErr, flushErr}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{flushErr: tt.flushErr}
+			flushesBeforeHook := -1
+			core := newCore(out, Config{PreFlushHook: func() error {
+				flushesBeforeHook = out.Flushes()
+				return tt.hookErr
+			}})
+
+			err := core.Sync()
+			if flushesBeforeHook != 0 {
+				t.Errorf("hook ran after %d flushes, want it to run before the sink flush", flushesBeforeHook)
+			}
+			if out.Flushes() != 1 {
+				t.Errorf("got %d flushes, want the sink to be flushed despite the hook", out.Flushes())
+			}
+			if (err != nil) != (len(tt.wantErrs) > 0) {
+				t.Fatalf("Sync() error = %v, want %v", err, tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !errors.Is(err, want) {
+					t.Errorf("Sync() error = %v, want it to wrap %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIncludeSequence(t *testing.T) {
+	tests := []struct {
+		name            string
+		includeSequence bool
+		writes          int
+	}{
+		{name: "disabled", writes: 3},
+		{name: "increasing across clones", includeSequence: true, writes: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{IncludeSequence: tt.includeSequence})
+			clone := core.With([]zapcore.Field{zap.String("component", "clone")})
+			for i := 0; i < tt.writes; i++ {
+				c := zapcore.Core(core)
+				if i%2 == 1 {
+					c = clone
+				}
+				if err := c.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for i, entry := range out.Entries() {
+				seq, ok := payloadOf(t, entry)["seq"]
+				if !tt.includeSequence {
+					if ok {
+						t.Errorf("entry %d has seq %v, want none", i, seq)
+					}
+					continue
+				}
+				if seq != float64(i+1) {
+					t.Errorf("entry %d seq = %v, want %d", i, seq, i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestIncludeSequenceConcurrent(t *testing.T) {
+	const goroutines, writes = 8, 50
+	out := &fakeSink{}
+	core := newCore(out, Config{IncludeSequence: true})
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				_ = core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[float64]bool)
+	for _, entry := range out.Entries() {
+		seen[payloadOf(t, entry)["seq"].(float64)] = true
+	}
+	if len(seen) != goroutines*writes {
+		t.Errorf("got %d distinct sequence numbers, want %d", len(seen), goroutines*writes)
+	}
+}
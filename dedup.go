@@ -0,0 +1,167 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// dedupRun describes a run of identical consecutive entries.
+type dedupRun struct {
+	core  *Core
+	ent   zapcore.Entry
+	count int
+}
+
+// write writes the summary entry for the run.
+//
+// Returns:
+// - An error if the summary entry could not be written, nil otherwise.
+func (r *dedupRun) write() error {
+	ent := r.ent
+	ent.Time = r.core.now()
+
+	return r.core.write(ent, []zapcore.Field{zap.Int("repeated", r.count)})
+}
+
+// deduper suppresses identical consecutive entries within a time window.
+// It is shared between a Core and all of its clones.
+// The summary of a run is written by a timer once the window closes,
+// or earlier if a different entry is written or the Core is synced.
+type deduper struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	last  zapcore.Entry
+	core  *Core
+	start time.Time
+	count int
+	timer *time.Timer
+}
+
+// newDeduper creates a new deduper with the given window.
+//
+// Parameters:
+// - window: The window in which identical consecutive entries are suppressed.
+//
+// Returns:
+// - A new deduper.
+func newDeduper(window time.Duration) *deduper {
+	return &deduper{window: window}
+}
+
+// observe records the given entry and reports whether it should be suppressed.
+// If the entry ends a run of suppressed entries, the run is returned
+// so that its summary can be written.
+//
+// Parameters:
+// - core: The Core writing the entry.
+// - ent: The entry to observe.
+//
+// Returns:
+// - Whether the entry should be suppressed.
+// - The run that has ended, or nil if there is none.
+func (d *deduper) observe(core *Core, ent zapcore.Entry) (bool, *dedupRun) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.core != nil && d.last.Message == ent.Message && d.last.Level == ent.Level && ent.Time.Sub(d.start) < d.window {
+		d.count++
+		if d.count == 1 {
+			// The timer is only started once an entry is suppressed,
+			// so that entries without repetitions do not allocate a timer.
+			start := d.start
+			d.timer = time.AfterFunc(d.window-ent.Time.Sub(start), func() { d.expire(start) })
+		}
+		return true, nil
+	}
+
+	run := d.reset()
+	d.last = ent
+	d.core = core
+	d.start = ent.Time
+
+	return false, run
+}
+
+// drain ends the current run, if any.
+//
+// Returns:
+// - The run that has ended, or nil if no entries were suppressed.
+func (d *deduper) drain() *dedupRun {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	run := d.reset()
+	d.core = nil
+
+	return run
+}
+
+// expire ends the run started at the given time when its window closes and writes its summary.
+// Errors are reported to the error handler of the Core, as there is no caller to return them to.
+//
+// Parameters:
+// - start: The start of the run whose window has closed.
+func (d *deduper) expire(start time.Time) {
+	d.mu.Lock()
+	if d.core == nil || !d.start.Equal(start) {
+		// The run has already ended.
+		d.mu.Unlock()
+		return
+	}
+	run := d.reset()
+	d.core = nil
+	d.mu.Unlock()
+
+	if run == nil {
+		return
+	}
+	if err := run.write(); err != nil {
+		run.core.reportError(fmt.Errorf("gclzap: failed to write deduplication summary: %w", err))
+	}
+}
+
+// reset resets the suppression counter and stops the timer of the current run.
+// The caller must hold the lock.
+//
+// Returns:
+// - The run that has ended, or nil if no entries were suppressed.
+func (d *deduper) reset() *dedupRun {
+	if d.count == 0 {
+		return nil
+	}
+
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	run := &dedupRun{core: d.core, ent: d.last, count: d.count}
+	d.count = 0
+
+	return run
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestDedup(t *testing.T) {
+	type write struct {
+		level   zapcore.Level
+		message string
+		times   int
+	}
+	tests := []struct {
+		name   string
+		writes []write
+		// want holds the message and the "repeated" count of each written entry, zero for none.
+		want []struct {
+			message  string
+			repeated float64
+		}
+	}{
+		{
+			name:   "identical entries are summarized",
+			writes: []write{{zapcore.InfoLevel, "flap", 1000}},
+			want: []struct {
+				message  string
+				repeated float64
+			}{{"flap", 0}, {"flap", 999}},
+		},
+		{
+			name:   "different message ends the run",
+			writes: []write{{zapcore.InfoLevel, "a", 3}, {zapcore.InfoLevel, "b", 1}},
+			want: []struct {
+				message  string
+				repeated float64
+			}{{"a", 0}, {"a", 2}, {"b", 0}},
+		},
+		{
+			name:   "different severity is not suppressed",
+			writes: []write{{zapcore.InfoLevel, "a", 1}, {zapcore.WarnLevel, "a", 1}},
+			want: []struct {
+				message  string
+				repeated float64
+			}{{"a", 0}, {"a", 0}},
+		},
+		{
+			name:   "single entry has no summary",
+			writes: []write{{zapcore.InfoLevel, "a", 1}},
+			want: []struct {
+				message  string
+				repeated float64
+			}{{"a", 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{DedupWindow: time.Hour})
+			for _, w := range tt.writes {
+				for i := 0; i < w.times; i++ {
+					if err := core.Write(zapcore.Entry{Level: w.level, Message: w.message}, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := core.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries := out.Entries()
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(entries), len(tt.want))
+			}
+			for i, want := range tt.want {
+				payload := payloadOf(t, entries[i])
+				if payload["message"] != want.message {
+					t.Errorf("entry %d: message = %v, want %q", i, payload["message"], want.message)
+				}
+				repeated, _ := payload["repeated"].(float64)
+				if repeated != want.repeated {
+					t.Errorf("entry %d: repeated = %v, want %v", i, repeated, want.repeated)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupWindowCloses(t *testing.T) {
+	out := &fakeSink{}
+	core := newCore(out, Config{DedupWindow: 20 * time.Millisecond})
+	for i := 0; i < 5; i++ {
+		if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "flap"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The summary is written by the timer, without further writes or syncs.
+	entries := waitEntries(t, out, 2)
+	if got := payloadOf(t, entries[1])["repeated"]; got != float64(4) {
+		t.Errorf("repeated = %v, want 4", got)
+	}
+
+	// A new run starts after the window has closed.
+	if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "flap"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(out.Entries()); got != 3 {
+		t.Errorf("got %d entries, want 3", got)
+	}
+}
+
+func TestDedupSummaryErrorStillFlushes(t *testing.T) {
+	out := &fakeSink{}
+	// The summary fails to be written to a file in a missing directory.
+	path := filepath.Join(t.TempDir(), "missing", "app.log")
+	core := newCore(out, Config{DedupWindow: time.Hour, FilePath: path})
+	for i := 0; i < 3; i++ {
+		_ = core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "flap"}, nil)
+	}
+
+	if err := core.Sync(); err == nil {
+		t.Error("Sync() = nil, want the summary error")
+	}
+	if got := out.Flushes(); got == 0 {
+		t.Error("sink was not flushed, want the flush to continue after the summary error")
+	}
+	if got := len(out.Entries()); got != 2 {
+		t.Errorf("got %d entries, want the entry and its summary", got)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// deferredSink is a sink that queues entries until its destination is set,
+// e.g. while the Google Cloud Logging client is created during startup.
+type deferredSink struct {
+	mu       sync.Mutex
+	out      sink
+	queue    []logging.Entry
+	capacity int
+	dropped  uint64
+}
+
+// Log writes the given entry to the destination, or queues it if the destination is not set.
+// Entries are dropped and counted if the queue is full.
+//
+// Parameters:
+// - e: The entry to write.
+func (s *deferredSink) Log(e logging.Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.out != nil {
+		s.out.Log(e)
+		return
+	}
+	if len(s.queue) >= s.capacity {
+		s.dropped++
+		return
+	}
+	s.queue = append(s.queue, e)
+}
+
+// Flush flushes the destination. Queued entries are kept until the destination is set.
+//
+// Returns:
+// - An error if the destination could not be flushed, nil otherwise.
+func (s *deferredSink) Flush() error {
+	s.mu.Lock()
+	out := s.out
+	s.mu.Unlock()
+	if out == nil {
+		return nil
+	}
+	return out.Flush()
+}
+
+// setOut sets the destination and replays the queued entries to it in order,
+// followed by an entry reporting the number of dropped entries, if any.
+//
+// Parameters:
+// - out: The destination.
+func (s *deferredSink) setOut(out sink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.queue {
+		out.Log(e)
+	}
+	if s.dropped > 0 {
+		out.Log(dropReport(s.dropped, time.Now()))
+	}
+	s.out = out
+	s.queue = nil
+}
+
+// DeferredCore is a Core that queues entries until the Google Cloud Logging logger
+// is set with SetLogger, so that entries logged during startup are not lost.
+// Clones created with With share the queue and the logger.
+type DeferredCore struct {
+	*Core
+	sink *deferredSink
+}
+
+// NewDeferredCore creates a new DeferredCore queueing at most capacity entries.
+// Entries logged while the queue is full are dropped, and their number is reported
+// by an entry at WARNING severity once the logger is set.
+//
+// Parameters:
+// - config: The configuration for the Core.
+// - capacity: The maximum number of queued entries.
+//
+// Returns:
+// - A new DeferredCore.
+func NewDeferredCore(config Config, capacity int) *DeferredCore {
+	s := &deferredSink{capacity: capacity}
+	return &DeferredCore{Core: newCore(s, config), sink: s}
+}
+
+// SetLogger sets the Google Cloud Logging logger and replays the queued entries to it
+// in the order they were logged. Subsequent entries are written to the logger directly.
+// It must be called at most once.
+//
+// Parameters:
+// - out: The Google Cloud Logging logger to write logs to.
+func (c *DeferredCore) SetLogger(out *logging.Logger) {
+	c.sink.setOut(out)
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestDeferredCore(t *testing.T) {
+	tests := []struct {
+		name         string
+		capacity     int
+		before       []string
+		after        []string
+		want         []string
+		wantReplayed int
+		wantDropped  uint64
+	}{
+		{name: "nothing queued", capacity: 4, after: []string{"c"}, want: []string{"c"}},
+		{
+			name:         "replayed in order",
+			capacity:     4,
+			before:       []string{"a", "b", "c"},
+			after:        []string{"d"},
+			want:         []string{"a", "b", "c", "d"},
+			wantReplayed: 3,
+		},
+		{
+			name:         "overflow dropped and counted",
+			capacity:     2,
+			before:       []string{"a", "b", "c", "d", "e"},
+			after:        []string{"f"},
+			want:         []string{"a", "b", "f"},
+			wantReplayed: 3,
+			wantDropped:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core := NewDeferredCore(Config{}, tt.capacity)
+			logger := zap.New(core)
+			for _, msg := range tt.before {
+				logger.Info(msg)
+			}
+
+			out := &fakeSink{}
+			core.sink.setOut(out)
+			// The queued entries and the drop report are replayed when the logger is set.
+			if got := len(out.Entries()); got != tt.wantReplayed {
+				t.Fatalf("got %d entries after the logger was set, want %d", got, tt.wantReplayed)
+			}
+			for _, msg := range tt.after {
+				logger.Info(msg)
+			}
+
+			var got []string
+			var dropped uint64
+			for _, e := range out.Entries() {
+				if payload, ok := e.Payload.(map[string]interface{}); ok {
+					if e.Severity != logging.Warning {
+						t.Errorf("drop report severity = %v, want %v", e.Severity, logging.Warning)
+					}
+					dropped += payload["dropped"].(uint64)
+					continue
+				}
+				got = append(got, payloadOf(t, e)["message"].(string))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("messages = %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("messages = %v, want %v", got, tt.want)
+					break
+				}
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestDeferredCoreFlush(t *testing.T) {
+	core := NewDeferredCore(Config{}, 4)
+	if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "queued"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queued entries are kept by a flush before the logger is set.
+	if err := core.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	out := &fakeSink{}
+	core.sink.setOut(out)
+	if got := len(out.Entries()); got != 1 {
+		t.Fatalf("got %d entries, want the queued entry", got)
+	}
+	if err := core.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Flushes(); got != 1 {
+		t.Errorf("got %d flushes, want 1", got)
+	}
+}
+
+func TestDeferredCoreClones(t *testing.T) {
+	core := NewDeferredCore(Config{}, 4)
+	clone := core.With([]zapcore.Field{zap.String("component", "payments")})
+	if err := clone.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "from clone"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &fakeSink{}
+	core.sink.setOut(out)
+	if err := clone.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "after"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := out.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if payload := payloadOf(t, entries[0]); payload["message"] != "from clone" || payload["component"] != "payments" {
+		t.Errorf("payload = %v, want the queued entry of the clone", payload)
+	}
+}
+
+func TestDeferredCoreConcurrent(t *testing.T) {
+	core := NewDeferredCore(Config{}, 1000)
+	logger := zap.New(core)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				logger.Info("entry")
+			}
+		}()
+	}
+	out := &fakeSink{}
+	core.sink.setOut(out)
+	wg.Wait()
+
+	// No entry is lost or written twice while the logger is set.
+	if got := len(out.Entries()); got != 400 {
+		t.Errorf("got %d entries, want 400", got)
+	}
+}
+
+func TestDeferredCoreSetLogger(t *testing.T) {
+	core := NewDeferredCore(Config{}, 4)
+	logger := zap.New(core)
+	logger.Info("before")
+
+	out, server := newFakeLogger(t)
+	core.SetLogger(out)
+	logger.Info("after")
+	if err := logger.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := server.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for i, want := range []string{"before", "after"} {
+		if got := entries[i].GetJsonPayload().GetFields()["message"].GetStringValue(); got != want {
+			t.Errorf("entry %d message = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"sort"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// effectiveConfigMessage is the message of the entry describing the effective configuration.
+const effectiveConfigMessage = "effective logging configuration"
+
+// MarshalLogObject adds the configuration to the given encoder, keyed by field name.
+// Functions and other values that cannot be represented are reduced to whether they are set.
+//
+// Parameters:
+// - enc: The encoder to add the configuration to.
+//
+// Returns:
+// - An error if the configuration could not be added, nil otherwise.
+func (c Config) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if err := enc.AddObject("EncoderConfig", c.EncoderConfig); err != nil {
+		return err
+	}
+	enc.AddString("Level", c.Level.String())
+	enc.AddBool("LevelToSeverity", c.LevelToSeverity != nil)
+	enc.AddDuration("DedupWindow", c.DedupWindow)
+	enc.AddBool("IncludeHostInfo", c.IncludeHostInfo)
+	enc.AddString("LabelPrefix", c.LabelPrefix)
+	enc.AddBool("IncludeSeverityNumber", c.IncludeSeverityNumber)
+	enc.AddDuration("WriteTimeout", c.WriteTimeout)
+	enc.AddBool("Fallback", c.Fallback != nil)
+	enc.AddString("FilePath", c.FilePath)
+	enc.AddBool("DisableFatalExit", c.DisableFatalExit)
+	enc.AddBool("IncludePayloadSize", c.IncludePayloadSize)
+	if c.Resource != nil {
+		enc.AddString("Resource", c.Resource.GetType())
+	}
+	if err := enc.AddObject("FieldMapping", stringMap(c.FieldMapping)); err != nil {
+		return err
+	}
+	enc.AddInt("MaxLabels", c.MaxLabels)
+	enc.AddBool("OnError", c.OnError != nil)
+	enc.AddBool("EnableContextObject", c.EnableContextObject)
+	severities := make([]string, 0, len(c.SeverityClients))
+	for s := range c.SeverityClients {
+		severities = append(severities, severityName(s))
+	}
+	if err := enc.AddArray("SeverityClients", stringArray(sortedStrings(severities))); err != nil {
+		return err
+	}
+	enc.AddBool("Clock", c.Clock != nil)
+	enc.AddBool("Synchronous", c.Synchronous)
+	enc.AddBool("ElevateGRPCSeverity", c.ElevateGRPCSeverity)
+	enc.AddBool("PreferTextPayload", c.PreferTextPayload)
+	enc.AddBool("EmitSummaryOnClose", c.EmitSummaryOnClose)
+	enc.AddInt("LevelSchedule", len(c.LevelSchedule))
+	enc.AddBool("MDC", c.MDC != nil)
+	enc.AddInt("MaxMessageBytes", c.MaxMessageBytes)
+	enc.AddInt("MaxSQLQueryBytes", c.MaxSQLQueryBytes)
+	enc.AddBool("Development", c.Development)
+	enc.AddBool("PayloadSchema", c.PayloadSchema != nil)
+	enc.AddBool("DisableCaller", c.DisableCaller)
+	if err := enc.AddArray("Encoders", stringArray(mapKeys(c.Encoders))); err != nil {
+		return err
+	}
+	enc.AddString("DeployLabelEnv", c.DeployLabelEnv)
+	enc.AddBool("UserIDLabel", c.UserIDLabel)
+	enc.AddBool("PreFlushHook", c.PreFlushHook != nil)
+	enc.AddBool("IncludeSequence", c.IncludeSequence)
+	enc.AddBool("PayloadMarshaler", c.PayloadMarshaler != nil)
+	enc.AddBool("KeyNormalizer", c.KeyNormalizer != nil)
+	enc.AddBool("FieldsAsLabels", c.FieldsAsLabels)
+	enc.AddBool("DropNonStringLabels", c.DropNonStringLabels)
+	enc.AddBool("OmitNilFields", c.OmitNilFields)
+	enc.AddString("ProjectID", c.ProjectID)
+	enc.AddString("OperationProducer", c.OperationProducer)
+	if err := enc.AddArray("BaggageLabels", stringArray(c.BaggageLabels)); err != nil {
+		return err
+	}
+	enc.AddBool("KeepZeroTime", c.KeepZeroTime)
+	enc.AddInt("AsyncBufferSize", c.AsyncBufferSize)
+	enc.AddDuration("DropReportInterval", c.DropReportInterval)
+	enc.AddBool("DynamicLabels", c.DynamicLabels != nil)
+	enc.AddDuration("DynamicLabelsTTL", c.DynamicLabelsTTL)
+	enc.AddInt("BatchFlushSize", c.BatchFlushSize)
+	enc.AddBool("DeduplicateFields", c.DeduplicateFields)
+	enc.AddString("LogName", c.LogName)
+	enc.AddString("TraceURLTemplate", c.TraceURLTemplate)
+	if err := enc.AddArray("FieldEncoders", stringArray(mapKeys(c.FieldEncoders))); err != nil {
+		return err
+	}
+	enc.AddBool("LogEffectiveConfig", c.LogEffectiveConfig)
+	if err := enc.AddArray("ResourceLabelFields", stringArray(c.ResourceLabelFields)); err != nil {
+		return err
+	}
+	enc.AddString("MinSeverity", severityName(c.MinSeverity))
+	enc.AddString("NameAsLabel", c.NameAsLabel)
+	enc.AddInt("OTelBatchSize", c.OTelBatchSize)
+	enc.AddInt("OTelMaxQueueSize", c.OTelMaxQueueSize)
+	enc.AddDuration("OTelExportInterval", c.OTelExportInterval)
+	enc.AddInt("MaxFields", c.MaxFields)
+	return nil
+}
+
+// MarshalLogObject adds the encoder configuration to the given encoder, keyed by field name.
+// Functions are reduced to whether they are set.
+//
+// Parameters:
+// - enc: The encoder to add the configuration to.
+//
+// Returns:
+// - An error if the configuration could not be added, nil otherwise.
+func (c EncoderConfig) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("LineEnding", c.LineEnding)
+	enc.AddBool("EncodeTime", c.EncodeTime != nil)
+	enc.AddBool("EncodeDuration", c.EncodeDuration != nil)
+	enc.AddBool("EncodeCaller", c.EncodeCaller != nil)
+	levelStrings := make(stringMap, len(c.LevelStrings))
+	for l, s := range c.LevelStrings {
+		levelStrings[l.String()] = s
+	}
+	if err := enc.AddObject("LevelStrings", levelStrings); err != nil {
+		return err
+	}
+	enc.AddString("DefaultSeverity", c.DefaultSeverity)
+	enc.AddBool("CloudRunKeys", c.CloudRunKeys)
+	if c.TimeZone != nil {
+		enc.AddString("TimeZone", c.TimeZone.String())
+	}
+	return nil
+}
+
+// stringArray is a zapcore.ArrayMarshaler for a slice of strings.
+type stringArray []string
+
+// MarshalLogArray adds the strings to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the strings to.
+//
+// Returns:
+// - Always nil.
+func (a stringArray) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, s := range a {
+		enc.AppendString(s)
+	}
+	return nil
+}
+
+// stringMap is a zapcore.ObjectMarshaler for a map of strings, encoded in key order.
+type stringMap map[string]string
+
+// MarshalLogObject adds the map to the given encoder in key order.
+//
+// Parameters:
+// - enc: The encoder to add the map to.
+//
+// Returns:
+// - Always nil.
+func (m stringMap) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, k := range mapKeys(m) {
+		enc.AddString(k, m[k])
+	}
+	return nil
+}
+
+// mapKeys returns the keys of the given map in sorted order.
+//
+// Parameters:
+// - m: The map.
+//
+// Returns:
+// - The sorted keys.
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return sortedStrings(keys)
+}
+
+// sortedStrings sorts the given strings in place.
+//
+// Parameters:
+// - s: The strings to sort.
+//
+// Returns:
+// - The sorted strings.
+func sortedStrings(s []string) []string {
+	sort.Strings(s)
+	return s
+}
+
+// logEffectiveConfig logs the given configuration with the given logger,
+// if the configuration asks for it.
+//
+// Parameters:
+// - logger: The logger built from the configuration.
+// - config: The configuration.
+func logEffectiveConfig(logger *zap.Logger, config Config) {
+	if config.LogEffectiveConfig {
+		logger.Info(effectiveConfigMessage, zap.Object("config", config))
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+func TestLogEffectiveConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   map[string]interface{}
+	}{
+		{name: "disabled", config: Config{Level: zapcore.DebugLevel}},
+		{
+			name: "level and flags",
+			config: Config{
+				Level:              zapcore.DebugLevel,
+				LogEffectiveConfig: true,
+				DisableCaller:      true,
+				LabelPrefix:        "app_",
+				MaxLabels:          16,
+			},
+			want: map[string]interface{}{
+				"Level":              "debug",
+				"LogEffectiveConfig": true,
+				"DisableCaller":      true,
+				"LabelPrefix":        "app_",
+				"MaxLabels":          float64(16),
+			},
+		},
+		{
+			name: "functions redacted",
+			config: Config{
+				Level:              zapcore.DebugLevel,
+				LogEffectiveConfig: true,
+				OnError:            func(error) {},
+				MDC:                func() map[string]string { return map[string]string{"secret": "value"} },
+			},
+			want: map[string]interface{}{"OnError": true, "MDC": true, "PreFlushHook": false},
+		},
+		{
+			name: "mappings",
+			config: Config{
+				Level:              zapcore.DebugLevel,
+				LogEffectiveConfig: true,
+				FieldMapping:       map[string]string{"msg": "message"},
+				EncoderConfig:      EncoderConfig{LevelStrings: map[zapcore.Level]string{zapcore.InfoLevel: "info"}},
+			},
+			want: map[string]interface{}{
+				"FieldMapping": map[string]interface{}{"msg": "message"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			logEffectiveConfig(zap.New(newCore(out, tt.config)), tt.config)
+
+			entries := out.Entries()
+			if tt.want == nil {
+				if len(entries) != 0 {
+					t.Fatalf("got %d entries, want none", len(entries))
+				}
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			payload := payloadOf(t, entries[0])
+			if payload["message"] != effectiveConfigMessage {
+				t.Errorf("message = %v, want %q", payload["message"], effectiveConfigMessage)
+			}
+			config, _ := payload["config"].(map[string]interface{})
+			for key, want := range tt.want {
+				if got := config[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %#v, want %#v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEffectiveConfigCoversAllFields(t *testing.T) {
+	// Optional values are set, so that they are present in the output.
+	config := Config{
+		Resource:      &mrpb.MonitoredResource{Type: "global"},
+		EncoderConfig: EncoderConfig{TimeZone: time.UTC},
+	}
+
+	tests := []struct {
+		name    string
+		typ     reflect.Type
+		marshal zapcore.ObjectMarshaler
+	}{
+		{name: "Config", typ: reflect.TypeOf(config), marshal: config},
+		{name: "EncoderConfig", typ: reflect.TypeOf(config.EncoderConfig), marshal: config.EncoderConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := zapcore.NewMapObjectEncoder()
+			if err := tt.marshal.MarshalLogObject(enc); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < tt.typ.NumField(); i++ {
+				if field := tt.typ.Field(i); field.IsExported() {
+					if _, ok := enc.Fields[field.Name]; !ok {
+						t.Errorf("field %s is missing from the effective configuration", field.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewLogsEffectiveConfig(t *testing.T) {
+	out, server := newFakeLogger(t)
+	logger := New(out, Config{Level: zapcore.InfoLevel, LogEffectiveConfig: true})
+	if err := logger.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := server.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want the startup entry", len(entries))
+	}
+	fields := entries[0].GetJsonPayload().GetFields()
+	if got := fields["message"].GetStringValue(); got != effectiveConfigMessage {
+		t.Errorf("message = %q, want %q", got, effectiveConfigMessage)
+	}
+	if got := fields["config"].GetStructValue().GetFields()["Level"].GetStringValue(); got != "info" {
+		t.Errorf("Level = %q, want %q", got, "info")
+	}
+}
@@ -21,15 +21,52 @@
 
 package gclzap
 
-import "go.uber.org/zap/zapcore"
+import (
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
 
 // EncoderConfig is a configuration struct for the Encoder
 // used by the custom Core implementation.
 type EncoderConfig struct {
-	LineEnding     string
-	EncodeTime     zapcore.TimeEncoder
+	LineEnding string
+
+	// EncodeTime encodes the human-readable "time" key of the payload.
+	// It may format the time in any zone or layout, as the timestamp of the entry
+	// is always set from the entry time in UTC, independently of the payload.
+	EncodeTime zapcore.TimeEncoder
+
 	EncodeDuration zapcore.DurationEncoder
 	EncodeCaller   zapcore.CallerEncoder
+
+	// LevelStrings overrides the "severity" strings of the payload for the given levels,
+	// e.g. for pipelines expecting lower case severities.
+	// It does not affect the severity of the entry itself.
+	LevelStrings map[zapcore.Level]string
+
+	// DefaultSeverity is the "severity" string of the payload for levels outside the range
+	// of zap's levels and for levels converted to a severity that has no name.
+	// If empty, "DEFAULT" is used, which is a valid severity of Google Cloud Logging.
+	DefaultSeverity string
+
+	// CloudRunKeys makes the encoder emit the special keys recognized by the logging agent,
+	// e.g. on Cloud Run, so that the encoder can be used with a plain zapcore.Core writing
+	// to standard error. The caller is emitted as "logging.googleapis.com/sourceLocation",
+	// and the Trace, SpanID, TraceSampled, InsertID, Operation, HTTPRequest and Label fields
+	// of an entry are emitted as "logging.googleapis.com/trace" and so on.
+	// Special fields added with With are not emitted, as encoders cannot observe them.
+	CloudRunKeys bool
+
+	// TimeZone is the time zone of the "time" key of the payload, e.g. for ops teams
+	// reading local times. The timestamp of the entry stays in UTC.
+	// If nil, the time is encoded in the zone of the entry time.
+	TimeZone *time.Location
 }
 
 // DefaultEncoderConfig returns the default configuration for the Encoder.
@@ -45,16 +82,119 @@ func DefaultEncoderConfig() EncoderConfig {
 	}
 }
 
+// mergeEncoderConfig merges the given encoder configurations,
+// with the non-zero fields of override taking precedence over the fields of base.
+//
+// Parameters:
+// - base: The base configuration.
+// - override: The configuration whose non-zero fields take precedence.
+//
+// Returns:
+// - The merged configuration.
+func mergeEncoderConfig(base, override EncoderConfig) EncoderConfig {
+	merged := base
+	if override.LineEnding != "" {
+		merged.LineEnding = override.LineEnding
+	}
+	if override.EncodeTime != nil {
+		merged.EncodeTime = override.EncodeTime
+	}
+	if override.EncodeDuration != nil {
+		merged.EncodeDuration = override.EncodeDuration
+	}
+	if override.EncodeCaller != nil {
+		merged.EncodeCaller = override.EncodeCaller
+	}
+	merged.LevelStrings = mergeMaps(base.LevelStrings, override.LevelStrings)
+	if override.DefaultSeverity != "" {
+		merged.DefaultSeverity = override.DefaultSeverity
+	}
+	merged.CloudRunKeys = base.CloudRunKeys || override.CloudRunKeys
+	if override.TimeZone != nil {
+		merged.TimeZone = override.TimeZone
+	}
+
+	return merged
+}
+
+// FullPathCallerEncoder serializes a caller as its package-qualified function,
+// followed by the full path of the file and the line number,
+// e.g. "github.com/user/app/pkg.(*Server).Serve /src/app/pkg/server.go:42".
+// Use it as EncoderConfig.EncodeCaller to disambiguate callers
+// from files with the same name in different packages.
+//
+// Parameters:
+// - caller: The caller to encode.
+// - enc: The encoder to append the caller to.
+func FullPathCallerEncoder(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+	if caller.Function == "" {
+		enc.AppendString(caller.FullPath())
+		return
+	}
+	enc.AppendString(caller.Function + " " + caller.FullPath())
+}
+
+// SecondsDurationEncoder serializes a time.Duration to a floating-point number of seconds,
+// the unit Cloud Logging uses for latencies, e.g. 1500ms is encoded as 1.5.
+//
+// Parameters:
+// - d: The duration to encode.
+// - enc: The encoder to append the duration to.
+func SecondsDurationEncoder(d time.Duration, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendFloat64(d.Seconds())
+}
+
+// isLatencyKey returns whether the given field key names a latency,
+// i.e. is "latency" or ends with "latency" or "Latency".
+//
+// Parameters:
+// - key: The key to check.
+//
+// Returns:
+// - Whether the key names a latency.
+func isLatencyKey(key string) bool {
+	return strings.HasSuffix(key, "latency") || strings.HasSuffix(key, "Latency")
+}
+
+// encodeLatencies converts duration fields whose key names a latency
+// to floating-point seconds, independently of the configured duration encoder.
+// The given slice is not modified.
+//
+// Parameters:
+// - fields: The fields to convert.
+//
+// Returns:
+// - The converted fields.
+func encodeLatencies(fields []zapcore.Field) []zapcore.Field {
+	var converted []zapcore.Field
+	for i, f := range fields {
+		if f.Type != zapcore.DurationType || !isLatencyKey(f.Key) {
+			continue
+		}
+		if converted == nil {
+			converted = make([]zapcore.Field, len(fields))
+			copy(converted, fields)
+		}
+		converted[i] = zap.Float64(f.Key, time.Duration(f.Integer).Seconds())
+	}
+
+	if converted == nil {
+		return fields
+	}
+	return converted
+}
+
 // NewEncoder creates a new Encoder based on the given configuration.
 // The Encoder is used by the custom Core implementation,
 // to log messages in the Google Cloud Logging structured logging format.
 //
 // Parameters:
 // - config: The configuration for the Encoder.
+// - levelToSeverity: A function that converts a zapcore level to a Google Cloud Logging severity.
 //
 // Returns:
 // - A new Encoder based on the given configuration.
-func newEncoder(config EncoderConfig) zapcore.Encoder {
+func newEncoder(config EncoderConfig, levelToSeverity func(zapcore.Level) logging.Severity) zapcore.Encoder {
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:        "time",
 		LevelKey:       "severity",
@@ -62,42 +202,174 @@ func newEncoder(config EncoderConfig) zapcore.Encoder {
 		MessageKey:     "message",
 		StacktraceKey:  "stacktrace",
 		LineEnding:     config.LineEnding,
-		EncodeLevel:    encodeLevel(),
+		EncodeLevel:    encodeLevel(levelToSeverity, config.LevelStrings, config.DefaultSeverity),
 		EncodeTime:     config.EncodeTime,
 		EncodeDuration: config.EncodeDuration,
 		EncodeCaller:   config.EncodeCaller,
 	}
+	if config.TimeZone != nil {
+		encoderConfig.EncodeTime = inTimeZone(config.TimeZone, config.EncodeTime)
+	}
+	if config.CloudRunKeys {
+		// The caller is emitted as the source location instead.
+		encoderConfig.CallerKey = zapcore.OmitKey
+		return &cloudRunEncoder{Encoder: zapcore.NewJSONEncoder(encoderConfig)}
+	}
 
 	return zapcore.NewJSONEncoder(encoderConfig)
 }
 
+// inTimeZone returns a time encoder that converts times to the given zone
+// before encoding them with the given encoder.
+//
+// Parameters:
+// - loc: The time zone.
+// - encode: The time encoder, zapcore.ISO8601TimeEncoder if nil.
+//
+// Returns:
+// - The time encoder.
+func inTimeZone(loc *time.Location, encode zapcore.TimeEncoder) zapcore.TimeEncoder {
+	if encode == nil {
+		encode = zapcore.ISO8601TimeEncoder
+	}
+
+	return func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		encode(t.In(loc), enc)
+	}
+}
+
+// NewEncoder creates a new JSON encoder producing the payload format of this package,
+// with the severity names of DefaultLevelToSeverity. Combined with CloudRunKeys,
+// it can be used with a plain zapcore.Core writing to standard error.
+//
+// Parameters:
+// - config: The configuration for the encoder.
+//
+// Returns:
+// - A new encoder.
+func NewEncoder(config EncoderConfig) zapcore.Encoder {
+	return newEncoder(config, DefaultLevelToSeverity)
+}
+
+// cloudRunEncoder is a zapcore.Encoder that emits the special fields of an entry
+// under the keys recognized by the logging agent.
+type cloudRunEncoder struct {
+	zapcore.Encoder
+}
+
+// Clone copies the encoder.
+//
+// Returns:
+// - A copy of the encoder.
+func (e *cloudRunEncoder) Clone() zapcore.Encoder {
+	return &cloudRunEncoder{Encoder: e.Encoder.Clone()}
+}
+
+// EncodeEntry encodes the given entry, emitting its special fields and caller
+// under the keys recognized by the logging agent.
+//
+// Parameters:
+// - ent: The entry to encode.
+// - fields: The fields of the entry.
+//
+// Returns:
+// - The encoded entry.
+// - An error if the entry could not be encoded, nil otherwise.
+func (e *cloudRunEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	regular, special := splitFields(fields)
+
+	var meta entryMeta
+	meta.collect(special)
+	entry := logging.Entry{
+		Trace:        meta.trace,
+		SpanID:       meta.spanID,
+		TraceSampled: meta.sampled,
+		Labels:       meta.labels,
+		InsertID:     meta.insertID,
+		HTTPRequest:  meta.httpRequest,
+	}
+	if meta.operationID != "" {
+		entry.Operation = &logpb.LogEntryOperation{Id: meta.operationID}
+	}
+	if ent.Caller.Defined {
+		entry.SourceLocation = &logpb.LogEntrySourceLocation{
+			File:     ent.Caller.File,
+			Line:     int64(ent.Caller.Line),
+			Function: ent.Caller.Function,
+		}
+	}
+
+	keys := structuredKeys(entry)
+	encoded := make([]zapcore.Field, 0, len(regular)+len(keys))
+	encoded = append(encoded, regular...)
+	for _, k := range keys {
+		encoded = append(encoded, zap.Any(k.key, k.value))
+	}
+
+	return e.Encoder.EncodeEntry(ent, encoded)
+}
+
 // encodeLevel returns a function that encodes the given zapcore level to a string,
 // based on the Google Cloud Logging structured logging format.
+// The string is the name of the severity the level is converted to,
+// so that the payload always agrees with the severity of the entry.
+//
+// Strings in overrides take precedence over the severity names.
+// Levels outside the range of zap's levels and levels converted to a severity
+// without a name are encoded as the default severity.
+//
+// Parameters:
+// - levelToSeverity: A function that converts a zapcore level to a Google Cloud Logging severity.
+// - overrides: The strings to use for specific levels, may be nil.
+// - defaultSeverity: The string to use for unknown levels, "DEFAULT" if empty.
 //
 // Returns:
 // - A function that encodes the given zapcore level to a string.
-func encodeLevel() zapcore.LevelEncoder {
+func encodeLevel(levelToSeverity func(zapcore.Level) logging.Severity, overrides map[zapcore.Level]string, defaultSeverity string) zapcore.LevelEncoder {
+	overrides = mergeMaps(nil, overrides)
+	if defaultSeverity == "" {
+		defaultSeverity = severityName(logging.Default)
+	}
+
 	// https://cloud.google.com/logging/docs/structured-logging
 	return func(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
-		switch l {
-		case zapcore.DebugLevel:
-			enc.AppendString("DEBUG")
-		case zapcore.InfoLevel:
-			enc.AppendString("INFO")
-		case zapcore.WarnLevel:
-			enc.AppendString("WARNING")
-		case zapcore.ErrorLevel:
-			enc.AppendString("ERROR")
-		case zapcore.DPanicLevel:
-			enc.AppendString("CRITICAL")
-		case zapcore.PanicLevel:
-			enc.AppendString("ALERT")
-		case zapcore.FatalLevel:
-			enc.AppendString("EMERGENCY")
-		case zapcore.InvalidLevel:
-			panic("encountered invalid log level")
-		default:
-			enc.AppendString("UNKNOWN")
+		if s, ok := overrides[l]; ok {
+			enc.AppendString(s)
+			return
+		}
+		if l < zapcore.DebugLevel || l > zapcore.FatalLevel {
+			enc.AppendString(defaultSeverity)
+			return
+		}
+		severity := levelToSeverity(l)
+		if !isNamedSeverity(severity) {
+			enc.AppendString(defaultSeverity)
+			return
 		}
+		enc.AppendString(severityName(severity))
 	}
 }
+
+// isNamedSeverity reports whether the given severity is one of the named severities
+// of Google Cloud Logging.
+//
+// Parameters:
+// - s: The severity to check.
+//
+// Returns:
+// - True if the severity has a name, false otherwise.
+func isNamedSeverity(s logging.Severity) bool {
+	return logging.ParseSeverity(s.String()) == s
+}
+
+// severityName returns the name of the given severity
+// as used in the Google Cloud Logging structured logging format.
+//
+// Parameters:
+// - s: The severity to name.
+//
+// Returns:
+// - The upper case name of the severity.
+func severityName(s logging.Severity) string {
+	return strings.ToUpper(s.String())
+}
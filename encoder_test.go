@@ -0,0 +1,401 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestFullPathCallerEncoder(t *testing.T) {
+	const function = "github.com/FelixKahle/gclzap.TestFullPathCallerEncoder.func1"
+
+	tests := []struct {
+		name       string
+		encode     zapcore.CallerEncoder
+		wantPrefix string
+		wantFile   string
+	}{
+		{
+			name:       "full path",
+			encode:     FullPathCallerEncoder,
+			wantPrefix: function + " /",
+			wantFile:   "/encoder_test.go:",
+		},
+		{
+			name:     "short",
+			encode:   zapcore.ShortCallerEncoder,
+			wantFile: "/encoder_test.go:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			config := Config{EncoderConfig: DefaultEncoderConfig()}
+			config.EncoderConfig.EncodeCaller = tt.encode
+			logger := zap.New(newCore(out, config), zap.AddCaller())
+			logger.Info("hello")
+
+			entry := out.Entries()[0]
+			if entry.SourceLocation == nil {
+				t.Fatal("source location not set")
+			}
+			if entry.SourceLocation.Function != function {
+				t.Errorf("function = %q, want %q", entry.SourceLocation.Function, function)
+			}
+			if !strings.HasSuffix(entry.SourceLocation.File, "/encoder_test.go") {
+				t.Errorf("file = %q, want the full path of encoder_test.go", entry.SourceLocation.File)
+			}
+
+			caller, _ := payloadOf(t, entry)["caller"].(string)
+			if !strings.HasPrefix(caller, tt.wantPrefix) {
+				t.Errorf("caller = %q, want prefix %q", caller, tt.wantPrefix)
+			}
+			if !strings.Contains(caller, tt.wantFile) {
+				t.Errorf("caller = %q, want it to contain %q", caller, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestLevelStrings(t *testing.T) {
+	lower := map[zapcore.Level]string{
+		zapcore.DebugLevel: "debug",
+		zapcore.InfoLevel:  "info",
+		zapcore.WarnLevel:  "warning",
+		zapcore.ErrorLevel: "error",
+	}
+
+	tests := []struct {
+		name    string
+		strings map[zapcore.Level]string
+		level   zapcore.Level
+		want    string
+	}{
+		{name: "lowercase debug", strings: lower, level: zapcore.DebugLevel, want: "debug"},
+		{name: "lowercase info", strings: lower, level: zapcore.InfoLevel, want: "info"},
+		{name: "lowercase warning", strings: lower, level: zapcore.WarnLevel, want: "warning"},
+		{name: "lowercase error", strings: lower, level: zapcore.ErrorLevel, want: "error"},
+		{name: "level without override", strings: lower, level: zapcore.DPanicLevel, want: "CRITICAL"},
+		{name: "default", level: zapcore.InfoLevel, want: "INFO"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{Level: zapcore.DebugLevel, EncoderConfig: EncoderConfig{LevelStrings: tt.strings}})
+			if err := core.Write(zapcore.Entry{Level: tt.level, Message: "hello"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if got := payloadOf(t, entry)["severity"]; got != tt.want {
+				t.Errorf("severity = %v, want %q", got, tt.want)
+			}
+			if entry.Severity != DefaultLevelToSeverity(tt.level) {
+				t.Errorf("entry severity = %v, want it unaffected", entry.Severity)
+			}
+		})
+	}
+}
+
+func TestDefaultSeverity(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultSeverity string
+		level           zapcore.Level
+		want            string
+	}{
+		{name: "invalid level", level: zapcore.InvalidLevel, want: "DEFAULT"},
+		{name: "above fatal", level: zapcore.FatalLevel + 10, want: "DEFAULT"},
+		{name: "below debug", level: zapcore.DebugLevel - 10, want: "DEFAULT"},
+		{name: "configured", defaultSeverity: "NOTICE", level: zapcore.InvalidLevel, want: "NOTICE"},
+		{name: "known level", defaultSeverity: "NOTICE", level: zapcore.WarnLevel, want: "WARNING"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := newEncoder(EncoderConfig{DefaultSeverity: tt.defaultSeverity}, DefaultLevelToSeverity)
+			buf, err := enc.EncodeEntry(zapcore.Entry{Level: tt.level, Message: "hello"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer buf.Free()
+
+			var payload map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &payload); err != nil {
+				t.Fatal(err)
+			}
+			if got := payload["severity"]; got != tt.want {
+				t.Errorf("severity = %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloudRunKeys(t *testing.T) {
+	caller := zapcore.NewEntryCaller(0, "/src/main.go", 42, true)
+	caller.Function = "main.run"
+
+	tests := []struct {
+		name         string
+		cloudRunKeys bool
+		caller       zapcore.EntryCaller
+		fields       []zapcore.Field
+		want         map[string]interface{}
+		absent       []string
+	}{
+		{
+			name:         "trace",
+			cloudRunKeys: true,
+			fields:       []zapcore.Field{Trace("projects/p/traces/abc")},
+			want:         map[string]interface{}{"logging.googleapis.com/trace": "projects/p/traces/abc"},
+		},
+		{
+			name:         "span ID and sampled",
+			cloudRunKeys: true,
+			fields:       []zapcore.Field{SpanID("000000000000004a"), TraceSampled(true)},
+			want: map[string]interface{}{
+				"logging.googleapis.com/spanId":        "000000000000004a",
+				"logging.googleapis.com/trace_sampled": true,
+			},
+		},
+		{
+			name:         "labels",
+			cloudRunKeys: true,
+			fields:       []zapcore.Field{Label("user_id", "42")},
+			want:         map[string]interface{}{"logging.googleapis.com/labels": map[string]interface{}{"user_id": "42"}},
+		},
+		{
+			name:         "operation",
+			cloudRunKeys: true,
+			fields:       []zapcore.Field{Operation("op-1")},
+			want:         map[string]interface{}{"logging.googleapis.com/operation": map[string]interface{}{"id": "op-1"}},
+		},
+		{
+			name:         "caller as source location",
+			cloudRunKeys: true,
+			caller:       caller,
+			want: map[string]interface{}{
+				"logging.googleapis.com/sourceLocation": map[string]interface{}{"file": "/src/main.go", "line": "42", "function": "main.run"},
+			},
+			absent: []string{"caller"},
+		},
+		{
+			name:         "regular fields kept",
+			cloudRunKeys: true,
+			fields:       []zapcore.Field{zap.String("user", "alice")},
+			want:         map[string]interface{}{"user": "alice", "severity": "INFO", "message": "hello"},
+		},
+		{
+			name:   "disabled",
+			fields: []zapcore.Field{Trace("projects/p/traces/abc")},
+			absent: []string{"logging.googleapis.com/trace"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultEncoderConfig()
+			config.CloudRunKeys = tt.cloudRunKeys
+			buf, err := NewEncoder(config).EncodeEntry(zapcore.Entry{Level: zapcore.InfoLevel, Caller: tt.caller, Message: "hello"}, tt.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer buf.Free()
+
+			var payload map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &payload); err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tt.want {
+				if got := payload[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %#v, want %#v", key, got, want)
+				}
+			}
+			for _, key := range tt.absent {
+				if got, ok := payload[key]; ok {
+					t.Errorf("%s = %#v, want it absent", key, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCloudRunKeysWithPlainCore(t *testing.T) {
+	var buf bytes.Buffer
+	config := DefaultEncoderConfig()
+	config.CloudRunKeys = true
+	logger := zap.New(zapcore.NewCore(NewEncoder(config), zapcore.AddSync(&buf), zapcore.DebugLevel))
+
+	logger.Warn("hello", Trace("projects/p/traces/abc"))
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["severity"] != "WARNING" || payload["logging.googleapis.com/trace"] != "projects/p/traces/abc" {
+		t.Errorf("payload = %v, want the severity and the trace under the agent keys", payload)
+	}
+}
+
+func TestEncodeTimeIndependentOfTimestamp(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		encodeTime zapcore.TimeEncoder
+		time       time.Time
+		want       string
+	}{
+		{
+			name: "localized formatter",
+			encodeTime: func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+				enc.AppendString(t.In(berlin).Format(time.RFC1123Z))
+			},
+			time: ts,
+			want: "Wed, 01 May 2024 14:00:00 +0200",
+		},
+		{
+			name:       "non-UTC entry time",
+			encodeTime: zapcore.RFC3339TimeEncoder,
+			time:       ts.In(berlin),
+			want:       "2024-05-01T14:00:00+02:00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{EncoderConfig: EncoderConfig{EncodeTime: tt.encodeTime}})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Time: tt.time, Message: "hello"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if got := payloadOf(t, entry)["time"]; got != tt.want {
+				t.Errorf("payload time = %v, want %q", got, tt.want)
+			}
+			if !entry.Timestamp.Equal(ts) || entry.Timestamp.Location() != time.UTC {
+				t.Errorf("timestamp = %v, want %v in UTC", entry.Timestamp, ts)
+			}
+		})
+	}
+}
+
+func TestTimeZone(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tokyo := time.FixedZone("JST", 9*60*60)
+	newYork := time.FixedZone("EDT", -4*60*60)
+
+	tests := []struct {
+		name       string
+		zone       *time.Location
+		encodeTime zapcore.TimeEncoder
+		want       string
+	}{
+		{name: "utc by default", encodeTime: zapcore.RFC3339TimeEncoder, want: "2024-05-01T12:00:00Z"},
+		{name: "ahead of utc", zone: tokyo, encodeTime: zapcore.RFC3339TimeEncoder, want: "2024-05-01T21:00:00+09:00"},
+		{name: "behind utc", zone: newYork, encodeTime: zapcore.RFC3339TimeEncoder, want: "2024-05-01T08:00:00-04:00"},
+		{name: "default encoder", zone: tokyo, want: "2024-05-01T21:00:00.000+0900"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{EncoderConfig: EncoderConfig{TimeZone: tt.zone, EncodeTime: tt.encodeTime}})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Time: ts, Message: "hello"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if got := payloadOf(t, entry)["time"]; got != tt.want {
+				t.Errorf("payload time = %v, want %q", got, tt.want)
+			}
+			if !entry.Timestamp.Equal(ts) || entry.Timestamp.Location() != time.UTC {
+				t.Errorf("timestamp = %v, want %v in UTC", entry.Timestamp, ts)
+			}
+		})
+	}
+}
+
+func TestSecondsDurationEncoder(t *testing.T) {
+	tests := []struct {
+		name           string
+		encodeDuration zapcore.DurationEncoder
+		with           []zapcore.Field
+		fields         []zapcore.Field
+		want           map[string]interface{}
+	}{
+		{
+			name:           "encoder",
+			encodeDuration: SecondsDurationEncoder,
+			fields:         []zapcore.Field{zap.Duration("elapsed", 1500*time.Millisecond)},
+			want:           map[string]interface{}{"elapsed": 1.5},
+		},
+		{
+			name:   "latency fields default to seconds",
+			fields: []zapcore.Field{zap.Duration("latency", 1500*time.Millisecond), zap.Duration("dbLatency", 250*time.Millisecond)},
+			want:   map[string]interface{}{"latency": 1.5, "dbLatency": 0.25},
+		},
+		{
+			name: "inherited latency field",
+			with: []zapcore.Field{zap.Duration("upstream_latency", 1500*time.Millisecond)},
+			want: map[string]interface{}{"upstream_latency": 1.5},
+		},
+		{
+			name:   "other durations keep the configured encoder",
+			fields: []zapcore.Field{zap.Duration("elapsed", 1500*time.Millisecond)},
+			want:   map[string]interface{}{"elapsed": float64(1500)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultEncoderConfig()
+			if tt.encodeDuration != nil {
+				config.EncodeDuration = tt.encodeDuration
+			}
+			out := &fakeSink{}
+			core := newCore(out, Config{EncoderConfig: config}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "done"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			payload := payloadOf(t, out.Entries()[0])
+			for k, v := range tt.want {
+				if payload[k] != v {
+					t.Errorf("%s = %#v, want %#v", k, payload[k], v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxErrorChainDepth is the maximum number of layers recorded for an error chain.
+// It bounds the work done for pathological or cyclic error chains.
+const maxErrorChainDepth = 32
+
+// errorChain walks the given error using errors.Unwrap
+// and returns the message of every layer.
+// The walk stops when an error is encountered twice.
+//
+// Parameters:
+// - err: The error to walk.
+//
+// Returns:
+// - The messages of all layers, starting with the outermost error.
+func errorChain(err error) []string {
+	var chain []string
+	var seen []error
+	for err != nil && len(chain) < maxErrorChainDepth {
+		// Only comparable errors can be checked for cycles,
+		// comparing other errors panics.
+		if reflect.TypeOf(err).Comparable() {
+			for _, s := range seen {
+				if s == err {
+					return chain
+				}
+			}
+			seen = append(seen, err)
+		}
+
+		chain = append(chain, err.Error())
+		err = errors.Unwrap(err)
+	}
+
+	return chain
+}
+
+// expandErrors adds a "<key>_chain" field for every error field
+// whose error wraps other errors.
+// The chain field holds the messages of all layers of the error.
+//
+// Parameters:
+// - fields: The fields to expand.
+//
+// Returns:
+// - The fields with the chain fields added.
+func expandErrors(fields []zapcore.Field) []zapcore.Field {
+	var expanded []zapcore.Field
+	for i, f := range fields {
+		var chain []string
+		if err, ok := f.Interface.(error); ok && f.Type == zapcore.ErrorType {
+			chain = errorChain(err)
+		}
+		if len(chain) < 2 {
+			if expanded != nil {
+				expanded = append(expanded, f)
+			}
+			continue
+		}
+
+		if expanded == nil {
+			expanded = make([]zapcore.Field, i, len(fields)+1)
+			copy(expanded, fields[:i])
+		}
+		expanded = append(expanded, f, zap.Strings(f.Key+"_chain", chain))
+	}
+
+	if expanded == nil {
+		return fields
+	}
+	return expanded
+}
+
+// errorOutput is a zapcore.WriteSyncer that reports zap's internal errors to an error handler.
+type errorOutput struct {
+	onError func(error)
+}
+
+// Write reports the given error message to the error handler.
+//
+// Parameters:
+// - p: The error message written by zap.
+//
+// Returns:
+// - The number of bytes written, always len(p).
+// - Always nil.
+func (o errorOutput) Write(p []byte) (int, error) {
+	o.onError(errors.New(strings.TrimSpace(string(p))))
+	return len(p), nil
+}
+
+// Sync does nothing.
+//
+// Returns:
+// - Always nil.
+func (errorOutput) Sync() error {
+	return nil
+}
+
+// errorDetails is a zapcore.ArrayMarshaler for the details of an error.
+type errorDetails []interface{}
+
+// MarshalLogArray adds the details to the given encoder.
+// Protocol buffer messages are encoded with protojson, other values with encoding/json.
+// Values that cannot be encoded are replaced by an object noting why they were skipped.
+//
+// Parameters:
+// - enc: The encoder to add the details to.
+//
+// Returns:
+// - An error if a detail could not be added, nil otherwise.
+func (ds errorDetails) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, d := range ds {
+		encoded, err := marshalDetail(d)
+		if err != nil {
+			if err := enc.AppendObject(zapcore.ObjectMarshalerFunc(func(obj zapcore.ObjectEncoder) error {
+				obj.AddString("skipped", fmt.Sprintf("%T", d))
+				obj.AddString("reason", err.Error())
+				return nil
+			})); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := enc.AppendReflected(encoded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalDetail encodes the given error detail as JSON.
+//
+// Parameters:
+// - d: The detail to encode.
+//
+// Returns:
+// - The encoded detail.
+// - An error if the detail could not be encoded, nil otherwise.
+func marshalDetail(d interface{}) (json.RawMessage, error) {
+	if m, ok := d.(proto.Message); ok {
+		return protojson.Marshal(m)
+	}
+
+	return json.Marshal(d)
+}
+
+// ErrorDetails returns a zap.Field that attaches the given details of an error,
+// e.g. the details of a gRPC status, as an "error_details" array to the payload.
+// Protocol buffer messages are encoded with protojson, other values with encoding/json.
+// Details that cannot be encoded are replaced by an object with the keys "skipped",
+// holding the type of the detail, and "reason".
+//
+// Parameters:
+// - details: The details to attach.
+//
+// Returns:
+// - A zap.Field that attaches the details to the payload.
+func ErrorDetails(details ...interface{}) zap.Field {
+	return zap.Array("error_details", errorDetails(details))
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// loopError is an error wrapping itself.
+type loopError struct{}
+
+// Error returns the error message.
+//
+// Returns:
+// - The error message.
+func (e *loopError) Error() string { return "loop" }
+
+// Unwrap returns the error itself.
+//
+// Returns:
+// - The error itself.
+func (e *loopError) Unwrap() error { return e }
+
+func TestErrorChain(t *testing.T) {
+	root := errors.New("connection refused")
+	tests := []struct {
+		name string
+		err  error
+		want []interface{}
+	}{
+		{
+			name: "three layers",
+			err:  fmt.Errorf("load user: %w", fmt.Errorf("query: %w", root)),
+			want: []interface{}{"load user: query: connection refused", "query: connection refused", "connection refused"},
+		},
+		{
+			name: "single layer has no chain",
+			err:  root,
+		},
+		{
+			name: "cycle is recorded once",
+			err:  fmt.Errorf("outer: %w", &loopError{}),
+			want: []interface{}{"outer: loop", "loop"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "failed"}, []zapcore.Field{zap.Error(tt.err)}); err != nil {
+				t.Fatal(err)
+			}
+
+			payload := payloadOf(t, out.Entries()[0])
+			chain, ok := payload["error_chain"]
+			if tt.want == nil {
+				if ok {
+					t.Errorf("error_chain = %v, want none", chain)
+				}
+				return
+			}
+			if !reflect.DeepEqual(chain, tt.want) {
+				t.Errorf("error_chain = %v, want %v", chain, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorOutput(t *testing.T) {
+	flushErr := errors.New("flush failed")
+
+	tests := []struct {
+		name     string
+		flushErr error
+		want     int
+	}{
+		{name: "no error", want: 0},
+		{name: "write error", flushErr: flushErr, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported []error
+			config := Config{OnError: func(err error) { reported = append(reported, err) }}
+			logger := zap.New(newCore(&fakeSink{flushErr: tt.flushErr}, config), config.Options()...)
+
+			// Entries at Error level are flushed immediately.
+			logger.Error("hello")
+
+			if len(reported) != tt.want {
+				t.Fatalf("got %d reported errors, want %d: %v", len(reported), tt.want, reported)
+			}
+			for _, err := range reported {
+				if !strings.Contains(err.Error(), flushErr.Error()) {
+					t.Errorf("reported error = %v, want it to describe %v", err, flushErr)
+				}
+				if strings.HasSuffix(err.Error(), "\n") {
+					t.Errorf("reported error %q ends with a newline", err)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorDetails(t *testing.T) {
+	tests := []struct {
+		name    string
+		details []interface{}
+		want    []interface{}
+	}{
+		{name: "none", want: []interface{}{}},
+		{
+			name: "proto and plain values",
+			details: []interface{}{
+				&errdetails.ErrorInfo{Reason: "QUOTA_EXCEEDED", Domain: "example.com", Metadata: map[string]string{"limit": "10"}},
+				map[string]int{"retry_after_s": 30},
+			},
+			want: []interface{}{
+				map[string]interface{}{"reason": "QUOTA_EXCEEDED", "domain": "example.com", "metadata": map[string]interface{}{"limit": "10"}},
+				map[string]interface{}{"retry_after_s": float64(30)},
+			},
+		},
+		{
+			name:    "non-serializable detail is skipped",
+			details: []interface{}{func() {}, "plain"},
+			want: []interface{}{
+				map[string]interface{}{"skipped": "func()", "reason": "json: unsupported type: func()"},
+				"plain",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			if err := core.Write(zapcore.Entry{Level: zapcore.ErrorLevel, Message: "rpc failed"}, []zapcore.Field{ErrorDetails(tt.details...)}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := payloadOf(t, out.Entries()[0])["error_details"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("error_details = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,509 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// milliseconds returns the given duration in fractional milliseconds.
+//
+// Parameters:
+// - d: The duration to convert.
+//
+// Returns:
+// - The duration in milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// retryEvent is a zapcore.ObjectMarshaler for a retry attempt.
+type retryEvent struct {
+	attempt     int
+	err         error
+	nextBackoff time.Duration
+}
+
+// MarshalLogObject adds the retry attempt to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the retry attempt to.
+//
+// Returns:
+// - An error if the retry attempt could not be encoded, nil otherwise.
+func (r retryEvent) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("attempt", r.attempt)
+	enc.AddFloat64("backoff_ms", milliseconds(r.nextBackoff))
+	if r.err == nil {
+		return nil
+	}
+
+	enc.AddString("error", r.err.Error())
+	return enc.AddArray("error_chain", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		for _, msg := range errorChain(r.err) {
+			arr.AppendString(msg)
+		}
+		return nil
+	}))
+}
+
+// RetryEvent returns a zap.Field that describes a retry attempt
+// as a nested "retry" object with the keys "attempt", "backoff_ms",
+// "error" and "error_chain".
+//
+// Parameters:
+// - attempt: The number of the attempt that failed.
+// - err: The error of the failed attempt, may be nil.
+// - nextBackoff: The time to wait before the next attempt.
+//
+// Returns:
+// - A zap.Field that describes the retry attempt.
+func RetryEvent(attempt int, err error, nextBackoff time.Duration) zap.Field {
+	return zap.Object("retry", retryEvent{attempt: attempt, err: err, nextBackoff: nextBackoff})
+}
+
+// leaseEvent is a zapcore.ObjectMarshaler for a lease event.
+type leaseEvent struct {
+	holder   string
+	acquired bool
+	ttl      time.Duration
+}
+
+// MarshalLogObject adds the lease event to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the lease event to.
+//
+// Returns:
+// - Always nil.
+func (l leaseEvent) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("holder", l.holder)
+	enc.AddBool("acquired", l.acquired)
+	enc.AddFloat64("ttl_ms", milliseconds(l.ttl))
+	return nil
+}
+
+// LeaseEvent returns a zap.Field that describes the acquisition or release
+// of a distributed lock or lease as a nested "lease" object
+// with the keys "holder", "acquired" and "ttl_ms".
+//
+// Parameters:
+// - holder: The identity of the lease holder.
+// - acquired: Whether the lease was acquired, false if it was released or lost.
+// - ttl: The time to live of the lease.
+//
+// Returns:
+// - A zap.Field that describes the lease event.
+func LeaseEvent(holder string, acquired bool, ttl time.Duration) zap.Field {
+	return zap.Object("lease", leaseEvent{holder: holder, acquired: acquired, ttl: ttl})
+}
+
+// flagEval is the value of a field created by FlagEval.
+type flagEval struct {
+	flag   string
+	value  interface{}
+	reason string
+}
+
+// apply adds the flag evaluation to the entry metadata.
+// A later evaluation of the same flag replaces an earlier one.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (f flagEval) apply(_ string, meta *entryMeta) {
+	for i := range meta.flags {
+		if meta.flags[i].flag == f.flag {
+			meta.flags[i] = f
+			return
+		}
+	}
+	meta.flags = append(meta.flags, f)
+}
+
+// MarshalLogObject adds the flag evaluation to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the flag evaluation to.
+//
+// Returns:
+// - An error if the value could not be encoded, nil otherwise.
+func (f flagEval) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if err := enc.AddReflected("value", f.value); err != nil {
+		return err
+	}
+	if f.reason != "" {
+		enc.AddString("reason", f.reason)
+	}
+	return nil
+}
+
+// flagEvals is a zapcore.ObjectMarshaler for the flag evaluations of an entry.
+type flagEvals []flagEval
+
+// MarshalLogObject adds the flag evaluations to the given encoder, keyed by flag.
+//
+// Parameters:
+// - enc: The encoder to add the flag evaluations to.
+//
+// Returns:
+// - An error if a flag evaluation could not be encoded, nil otherwise.
+func (fs flagEvals) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, f := range fs {
+		if err := enc.AddObject(f.flag, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FlagEval returns a zap.Field that records the evaluation of a feature flag.
+// All flag evaluations of an entry are collected in a nested "feature_flag" object,
+// keyed by flag, each with the keys "value" and "reason".
+//
+// Parameters:
+// - flag: The name of the flag.
+// - value: The value the flag evaluated to.
+// - reason: The reason for the value, e.g. "targeting_match", may be empty.
+//
+// Returns:
+// - A zap.Field that records the flag evaluation.
+func FlagEval(flag string, value interface{}, reason string) zap.Field {
+	return special("feature_flag", flagEval{flag: flag, value: value, reason: reason})
+}
+
+// metric is the value of a field created by Metric.
+type metric struct {
+	name  string
+	value float64
+}
+
+// apply adds the metric to the entry metadata.
+// A later value of the same metric replaces an earlier one.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (m metric) apply(_ string, meta *entryMeta) {
+	for i := range meta.metrics {
+		if meta.metrics[i].name == m.name {
+			meta.metrics[i] = m
+			return
+		}
+	}
+	meta.metrics = append(meta.metrics, m)
+}
+
+// metrics is a zapcore.ObjectMarshaler for the metrics of an entry.
+type metrics []metric
+
+// MarshalLogObject adds the metrics to the given encoder, keyed by name.
+//
+// Parameters:
+// - enc: The encoder to add the metrics to.
+//
+// Returns:
+// - Always nil.
+func (ms metrics) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, m := range ms {
+		enc.AddFloat64(m.name, m.value)
+	}
+	return nil
+}
+
+// Metric returns a zap.Field that attaches a numeric metric to the entry.
+// All metrics of an entry are collected in a nested "metrics" object, keyed by name,
+// so that log-based metrics can reliably extract them from "jsonPayload.metrics.<name>".
+// The values are always encoded as numbers.
+//
+// Parameters:
+// - name: The name of the metric.
+// - value: The value of the metric.
+//
+// Returns:
+// - A zap.Field that attaches the metric to the entry.
+func Metric(name string, value float64) zap.Field {
+	return special("metrics", metric{name: name, value: value})
+}
+
+// DefaultMaxSQLQueryBytes is the default maximum length of queries described by SQLEvent in bytes.
+const DefaultMaxSQLQueryBytes = 1024
+
+// sqlEvent is the value of a field created by SQLEvent.
+type sqlEvent struct {
+	query    string
+	args     int
+	duration time.Duration
+	rows     int64
+	limit    int
+}
+
+// apply sets the SQL query on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (s *sqlEvent) apply(_ string, meta *entryMeta) {
+	meta.sql = s
+}
+
+// withLimit returns a copy of the SQL query truncated to the given configured maximum length.
+//
+// Parameters:
+// - limit: The configured maximum length, DefaultMaxSQLQueryBytes if zero, unlimited if negative.
+//
+// Returns:
+// - A copy of the SQL query with the limit applied.
+func (s sqlEvent) withLimit(limit int) sqlEvent {
+	if limit == 0 {
+		limit = DefaultMaxSQLQueryBytes
+	}
+	s.limit = limit
+	return s
+}
+
+// MarshalLogObject adds the SQL query to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the SQL query to.
+//
+// Returns:
+// - Always nil.
+func (s sqlEvent) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	query := s.query
+	if s.limit > 0 {
+		query = truncate(query, s.limit)
+	}
+	enc.AddString("query", query)
+	enc.AddInt("args", s.args)
+	enc.AddFloat64("duration_ms", milliseconds(s.duration))
+	enc.AddInt64("rows", s.rows)
+	return nil
+}
+
+// SQLEvent returns a zap.Field that describes an executed SQL query
+// as a nested "sql" object with the keys "query", "args", "duration_ms" and "rows".
+// Queries longer than Config.MaxSQLQueryBytes are truncated.
+//
+// Parameters:
+// - query: The executed query. It should not contain the argument values.
+// - args: The number of arguments of the query.
+// - duration: The time it took to execute the query.
+// - rows: The number of rows returned or affected by the query.
+//
+// Returns:
+// - A zap.Field that describes the SQL query.
+func SQLEvent(query string, args int, duration time.Duration, rows int64) zap.Field {
+	return special("sql", &sqlEvent{query: query, args: args, duration: duration, rows: rows})
+}
+
+// cacheEvent is a zapcore.ObjectMarshaler for a cache lookup.
+type cacheEvent struct {
+	name    string
+	hit     bool
+	latency time.Duration
+}
+
+// MarshalLogObject adds the cache lookup to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the cache lookup to.
+//
+// Returns:
+// - Always nil.
+func (c cacheEvent) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", c.name)
+	enc.AddBool("hit", c.hit)
+	enc.AddFloat64("latency_ms", milliseconds(c.latency))
+	return nil
+}
+
+// CacheEvent returns a zap.Field that describes a cache lookup
+// as a nested "cache" object with the keys "name", "hit" and "latency_ms".
+//
+// Parameters:
+// - name: The name of the cache.
+// - hit: Whether the lookup was a hit.
+// - latency: The time the lookup took.
+//
+// Returns:
+// - A zap.Field that describes the cache lookup.
+func CacheEvent(name string, hit bool, latency time.Duration) zap.Field {
+	return zap.Object("cache", cacheEvent{name: name, hit: hit, latency: latency})
+}
+
+// progressEvent is a zapcore.ObjectMarshaler for the progress of an operation.
+type progressEvent struct {
+	done  int64
+	total int64
+}
+
+// MarshalLogObject adds the progress to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the progress to.
+//
+// Returns:
+// - Always nil.
+func (p progressEvent) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt64("done", p.done)
+	enc.AddInt64("total", p.total)
+	percent := 0.0
+	if p.total > 0 {
+		percent = float64(p.done) * 100 / float64(p.total)
+	}
+	enc.AddFloat64("percent", percent)
+	return nil
+}
+
+// ProgressEvent returns a zap.Field that describes the progress of a long operation
+// as a nested "progress" object with the keys "done", "total" and "percent".
+// The percentage is zero if total is not positive.
+//
+// Parameters:
+// - done: The number of units done.
+// - total: The total number of units.
+//
+// Returns:
+// - A zap.Field that describes the progress.
+func ProgressEvent(done, total int64) zap.Field {
+	return zap.Object("progress", progressEvent{done: done, total: total})
+}
+
+// Progress logs the progress of a long operation, e.g. a batch job, at Info level.
+// The entries carry a ProgressEvent and the operation ID, so that the progress
+// updates of an operation are grouped in Google Cloud Logging.
+// The operation ID must be unique per run of the operation, e.g. the ID of the job,
+// as Google Cloud Logging groups all entries with the same ID into one operation.
+//
+// Parameters:
+// - logger: The logger to log the progress with.
+// - name: The name of the operation, used in the message, e.g. "import".
+// - operationID: The unique ID of the operation.
+// - done: The number of units done.
+// - total: The total number of units.
+func Progress(logger *zap.Logger, name, operationID string, done, total int64) {
+	logger.WithOptions(zap.AddCallerSkip(1)).Info(name+" progress", Operation(operationID), ProgressEvent(done, total))
+}
+
+// money is a zapcore.ObjectMarshaler for an amount of money.
+type money struct {
+	units    int64
+	nanos    int32
+	currency string
+}
+
+// MarshalLogObject adds the amount of money to the given encoder
+// in the JSON representation of google.type.Money.
+//
+// Parameters:
+// - enc: The encoder to add the amount of money to.
+//
+// Returns:
+// - Always nil.
+func (m money) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("currencyCode", m.currency)
+	// 64-bit integers are encoded as strings, as in the JSON mapping of protocol buffers,
+	// so that consumers parsing numbers as floats do not lose precision.
+	enc.AddString("units", strconv.FormatInt(m.units, 10))
+	enc.AddInt32("nanos", m.nanos)
+	return nil
+}
+
+// Money returns a zap.Field that holds an exact amount of money as a nested object
+// matching the JSON representation of google.type.Money, with the keys
+// "currencyCode", "units" and "nanos". Unlike a float, it preserves the exact value.
+// For negative amounts, units and nanos must both be negative or zero.
+//
+// Parameters:
+// - key: The key of the field.
+// - units: The whole units of the amount, e.g. 12 for 12.50 USD.
+// - nanos: The nano units of the amount, e.g. 500000000 for 12.50 USD.
+// - currency: The ISO 4217 currency code, e.g. "USD".
+//
+// Returns:
+// - A zap.Field that holds the amount of money.
+func Money(key string, units int64, nanos int32, currency string) zap.Field {
+	return zap.Object(key, money{units: units, nanos: nanos, currency: currency})
+}
+
+// deprecation is a zapcore.ObjectMarshaler for the deprecation of a feature.
+type deprecation struct {
+	feature     string
+	sunset      time.Time
+	replacement string
+}
+
+// MarshalLogObject adds the deprecation to the given encoder.
+// The sunset date and the replacement are omitted if they are unset.
+//
+// Parameters:
+// - enc: The encoder to add the deprecation to.
+//
+// Returns:
+// - Always nil.
+func (d deprecation) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("feature", d.feature)
+	if !d.sunset.IsZero() {
+		enc.AddString("sunset", d.sunset.Format(time.DateOnly))
+	}
+	if d.replacement != "" {
+		enc.AddString("replacement", d.replacement)
+	}
+	return nil
+}
+
+// Deprecation returns a zap.Field that describes the use of a deprecated feature
+// as a nested "deprecation" object with the keys "feature", "sunset", holding the
+// date the feature is removed formatted as "2006-01-02", and "replacement".
+//
+// Parameters:
+// - feature: The deprecated feature.
+// - sunset: The time the feature is removed, may be zero.
+// - replacement: The feature to use instead, may be empty.
+//
+// Returns:
+// - A zap.Field that describes the deprecation.
+func Deprecation(feature string, sunset time.Time, replacement string) zap.Field {
+	return zap.Object("deprecation", deprecation{feature: feature, sunset: sunset, replacement: replacement})
+}
+
+// LogDeprecation logs the use of a deprecated feature at Warn level with a Deprecation field.
+// If once is set, every feature is logged at most once per process and call site, see Once.
+//
+// Parameters:
+// - logger: The logger to log the deprecation with.
+// - once: Whether to log every feature only once per call site.
+// - feature: The deprecated feature.
+// - sunset: The time the feature is removed, may be zero.
+// - replacement: The feature to use instead, may be empty.
+func LogDeprecation(logger *zap.Logger, once bool, feature string, sunset time.Time, replacement string) {
+	logger = logger.WithOptions(zap.AddCallerSkip(1))
+	if once {
+		logger = Once(logger)
+	}
+	logger.Warn(feature+" is deprecated", Deprecation(feature, sunset, replacement))
+}
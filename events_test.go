@@ -0,0 +1,493 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRetryEvent(t *testing.T) {
+	root := errors.New("unavailable")
+
+	tests := []struct {
+		name        string
+		attempt     int
+		err         error
+		nextBackoff time.Duration
+		want        map[string]interface{}
+	}{
+		{
+			name:        "without error",
+			attempt:     1,
+			nextBackoff: 250 * time.Millisecond,
+			want:        map[string]interface{}{"attempt": 1, "backoff_ms": 250.0},
+		},
+		{
+			name:        "with wrapped error",
+			attempt:     3,
+			err:         fmt.Errorf("call: %w", root),
+			nextBackoff: 1500 * time.Microsecond,
+			want: map[string]interface{}{
+				"attempt":     3,
+				"backoff_ms":  1.5,
+				"error":       "call: unavailable",
+				"error_chain": []interface{}{"call: unavailable", "unavailable"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodeField(RetryEvent(tt.attempt, tt.err, tt.nextBackoff))["retry"]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("retry = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeaseEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		holder   string
+		acquired bool
+		ttl      time.Duration
+		want     map[string]interface{}
+	}{
+		{
+			name:     "acquired",
+			holder:   "worker-1",
+			acquired: true,
+			ttl:      30 * time.Second,
+			want:     map[string]interface{}{"holder": "worker-1", "acquired": true, "ttl_ms": 30000.0},
+		},
+		{
+			name:     "released",
+			holder:   "worker-2",
+			acquired: false,
+			ttl:      1500 * time.Microsecond,
+			want:     map[string]interface{}{"holder": "worker-2", "acquired": false, "ttl_ms": 1.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodeField(LeaseEvent(tt.holder, tt.acquired, tt.ttl))["lease"]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lease = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagEval(t *testing.T) {
+	tests := []struct {
+		name   string
+		with   []zapcore.Field
+		fields []zapcore.Field
+		want   interface{}
+	}{
+		{name: "none"},
+		{
+			name:   "single flag",
+			fields: []zapcore.Field{FlagEval("new-checkout", true, "targeting_match")},
+			want: map[string]interface{}{
+				"new-checkout": map[string]interface{}{"value": true, "reason": "targeting_match"},
+			},
+		},
+		{
+			name: "multiple flags coexist",
+			with: []zapcore.Field{FlagEval("dark-mode", "blue", "")},
+			fields: []zapcore.Field{
+				FlagEval("new-checkout", false, "default"),
+				FlagEval("rollout", 25, "split"),
+			},
+			want: map[string]interface{}{
+				"dark-mode":    map[string]interface{}{"value": "blue"},
+				"new-checkout": map[string]interface{}{"value": false, "reason": "default"},
+				"rollout":      map[string]interface{}{"value": float64(25), "reason": "split"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "checkout"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			got := payloadOf(t, out.Entries()[0])["feature_flag"]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("feature_flag = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetric(t *testing.T) {
+	tests := []struct {
+		name   string
+		with   []zapcore.Field
+		fields []zapcore.Field
+		want   interface{}
+	}{
+		{name: "none"},
+		{
+			name:   "numeric encoding",
+			fields: []zapcore.Field{Metric("duration_ms", 12.5)},
+			want:   map[string]interface{}{"duration_ms": 12.5},
+		},
+		{
+			name:   "integral value",
+			fields: []zapcore.Field{Metric("items", 3)},
+			want:   map[string]interface{}{"items": float64(3)},
+		},
+		{
+			name:   "collected from clones and entries",
+			with:   []zapcore.Field{Metric("queue_depth", 7)},
+			fields: []zapcore.Field{Metric("duration_ms", 1.5)},
+			want:   map[string]interface{}{"queue_depth": float64(7), "duration_ms": 1.5},
+		},
+		{
+			name:   "later value replaces earlier",
+			with:   []zapcore.Field{Metric("duration_ms", 1)},
+			fields: []zapcore.Field{Metric("duration_ms", 2)},
+			want:   map[string]interface{}{"duration_ms": float64(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "processed"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			got := payloadOf(t, out.Entries()[0])["metrics"]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("metrics = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   zapcore.Field
+		want    map[string]interface{}
+		wantRaw string
+	}{
+		{
+			name:    "hit",
+			field:   CacheEvent("sessions", true, 1500*time.Microsecond),
+			want:    map[string]interface{}{"name": "sessions", "hit": true, "latency_ms": 1.5},
+			wantRaw: `"hit":true`,
+		},
+		{
+			name:    "miss",
+			field:   CacheEvent("sessions", false, 20*time.Millisecond),
+			want:    map[string]interface{}{"name": "sessions", "hit": false, "latency_ms": float64(20)},
+			wantRaw: `"hit":false`,
+		},
+		{
+			name:  "zero latency",
+			field: CacheEvent("users", true, 0),
+			want:  map[string]interface{}{"name": "users", "hit": true, "latency_ms": float64(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "lookup"}, []zapcore.Field{tt.field}); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if got := payloadOf(t, entry)["cache"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cache = %#v, want %#v", got, tt.want)
+			}
+			// The hit flag is a JSON boolean, not a string.
+			if raw := string(entry.Payload.(json.RawMessage)); !strings.Contains(raw, tt.wantRaw) {
+				t.Errorf("payload %s does not contain %s", raw, tt.wantRaw)
+			}
+		})
+	}
+}
+
+func TestMoney(t *testing.T) {
+	tests := []struct {
+		name     string
+		units    int64
+		nanos    int32
+		currency string
+		want     map[string]interface{}
+	}{
+		{
+			name: "positive", units: 12, nanos: 500000000, currency: "USD",
+			want: map[string]interface{}{"currencyCode": "USD", "units": "12", "nanos": float64(500000000)},
+		},
+		{
+			name: "negative", units: -1, nanos: -750000000, currency: "EUR",
+			want: map[string]interface{}{"currencyCode": "EUR", "units": "-1", "nanos": float64(-750000000)},
+		},
+		{
+			name: "beyond float precision", units: 9007199254740993, nanos: 1, currency: "JPY",
+			want: map[string]interface{}{"currencyCode": "JPY", "units": "9007199254740993", "nanos": float64(1)},
+		},
+		{
+			name: "zero", currency: "USD",
+			want: map[string]interface{}{"currencyCode": "USD", "units": "0", "nanos": float64(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			fields := []zapcore.Field{Money("price", tt.units, tt.nanos, tt.currency)}
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "charged"}, fields); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := payloadOf(t, out.Entries()[0])["price"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("price = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeprecation(t *testing.T) {
+	sunset := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		field zapcore.Field
+		want  map[string]interface{}
+	}{
+		{
+			name:  "complete",
+			field: Deprecation("v1 API", sunset, "v2 API"),
+			want:  map[string]interface{}{"feature": "v1 API", "sunset": "2025-03-31", "replacement": "v2 API"},
+		},
+		{
+			name:  "sunset in its own zone",
+			field: Deprecation("v1 API", time.Date(2025, 3, 31, 23, 30, 0, 0, time.FixedZone("PDT", -7*60*60)), ""),
+			want:  map[string]interface{}{"feature": "v1 API", "sunset": "2025-03-31"},
+		},
+		{
+			name:  "no sunset",
+			field: Deprecation("legacy flag", time.Time{}, "new flag"),
+			want:  map[string]interface{}{"feature": "legacy flag", "replacement": "new flag"},
+		},
+		{
+			name:  "feature only",
+			field: Deprecation("legacy flag", time.Time{}, ""),
+			want:  map[string]interface{}{"feature": "legacy flag"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			if err := core.Write(zapcore.Entry{Level: zapcore.WarnLevel, Message: "deprecated"}, []zapcore.Field{tt.field}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := payloadOf(t, out.Entries()[0])["deprecation"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deprecation = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogDeprecation(t *testing.T) {
+	tests := []struct {
+		name     string
+		once     bool
+		wantLogs int
+	}{
+		{name: "every call", wantLogs: 3},
+		{name: "once", once: true, wantLogs: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetOnce(t)
+			out := &fakeSink{}
+			logger := zap.New(newCore(out, Config{EncoderConfig: DefaultEncoderConfig()}), zap.AddCaller())
+			for i := 0; i < 3; i++ {
+				LogDeprecation(logger, tt.once, "v1 API", time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC), "v2 API")
+			}
+
+			entries := out.Entries()
+			if len(entries) != tt.wantLogs {
+				t.Fatalf("got %d entries, want %d", len(entries), tt.wantLogs)
+			}
+			entry := entries[0]
+			if entry.Severity != logging.Warning {
+				t.Errorf("severity = %v, want %v", entry.Severity, logging.Warning)
+			}
+			payload := payloadOf(t, entry)
+			if payload["message"] != "v1 API is deprecated" {
+				t.Errorf("message = %v, want %q", payload["message"], "v1 API is deprecated")
+			}
+			// The caller is the call site of LogDeprecation.
+			if caller, _ := payload["caller"].(string); !strings.Contains(caller, "events_test.go") {
+				t.Errorf("caller = %q, want the test file", caller)
+			}
+		})
+	}
+}
+
+func TestLogDeprecationOncePerFeature(t *testing.T) {
+	resetOnce(t)
+	out := &fakeSink{}
+	logger := zap.New(newCore(out, Config{EncoderConfig: DefaultEncoderConfig()}))
+	// warn logs every deprecation from the same call site.
+	warn := func(feature string) {
+		LogDeprecation(logger, true, feature, time.Time{}, "")
+	}
+	for _, feature := range []string{"v1 API", "legacy flag", "v1 API", "legacy flag"} {
+		warn(feature)
+	}
+
+	entries := out.Entries()
+	want := []string{"v1 API is deprecated", "legacy flag is deprecated"}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, msg := range want {
+		if got := payloadOf(t, entries[i])["message"]; got != msg {
+			t.Errorf("entry %d = %v, want %q", i, got, msg)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		name        string
+		done        int64
+		total       int64
+		wantPercent float64
+	}{
+		{name: "started", done: 0, total: 200, wantPercent: 0},
+		{name: "partial", done: 50, total: 200, wantPercent: 25},
+		{name: "fractional", done: 1, total: 3, wantPercent: 100.0 / 3},
+		{name: "complete", done: 200, total: 200, wantPercent: 100},
+		{name: "unknown total", done: 10, total: 0, wantPercent: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			Progress(zap.New(newCore(out, Config{})), "import", "import-42", tt.done, tt.total)
+
+			entry := out.Entries()[0]
+			payload := payloadOf(t, entry)
+			if payload["message"] != "import progress" {
+				t.Errorf("message = %v, want %q", payload["message"], "import progress")
+			}
+			want := map[string]interface{}{"done": float64(tt.done), "total": float64(tt.total), "percent": tt.wantPercent}
+			if got := payload["progress"]; !reflect.DeepEqual(got, want) {
+				t.Errorf("progress = %#v, want %#v", got, want)
+			}
+			if entry.Operation.GetId() != "import-42" {
+				t.Errorf("operation = %v, want the ID %q", entry.Operation, "import-42")
+			}
+		})
+	}
+}
+
+func TestProgressGroupsByOperationID(t *testing.T) {
+	out := &fakeSink{}
+	logger := zap.New(newCore(out, Config{}))
+
+	// Two runs of the same operation are grouped separately.
+	Progress(logger, "import", "run-1", 1, 2)
+	Progress(logger, "import", "run-2", 1, 2)
+	Progress(logger, "import", "run-1", 2, 2)
+
+	var got []string
+	for _, e := range out.Entries() {
+		got = append(got, e.Operation.GetId())
+	}
+	if want := []string{"run-1", "run-2", "run-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("operation IDs = %v, want %v", got, want)
+	}
+}
+
+func TestSQLEvent(t *testing.T) {
+	long := "SELECT * FROM orders WHERE " + strings.Repeat("id = ? OR ", 200) + "1 = 1"
+
+	tests := []struct {
+		name      string
+		maxBytes  int
+		query     string
+		wantQuery string
+	}{
+		{name: "short query", query: "SELECT 1", wantQuery: "SELECT 1"},
+		{name: "default limit", query: long, wantQuery: truncate(long, DefaultMaxSQLQueryBytes)},
+		{name: "configured limit", maxBytes: 16, query: long, wantQuery: truncate(long, 16)},
+		{name: "unlimited", maxBytes: -1, query: long, wantQuery: long},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{MaxSQLQueryBytes: tt.maxBytes})
+			fields := []zapcore.Field{SQLEvent(tt.query, 2, 1500*time.Microsecond, 7)}
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "query"}, fields); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]interface{}{
+				"query":       tt.wantQuery,
+				"args":        float64(2),
+				"duration_ms": 1.5,
+				"rows":        float64(7),
+			}
+			if got := payloadOf(t, out.Entries()[0])["sql"]; !reflect.DeepEqual(got, want) {
+				t.Errorf("sql = %#v, want %#v", got, want)
+			}
+			if len(tt.wantQuery) < len(tt.query) && !strings.HasSuffix(tt.wantQuery, ellipsis) {
+				t.Errorf("truncated query %q is not marked with an ellipsis", tt.wantQuery)
+			}
+		})
+	}
+}
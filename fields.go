@@ -0,0 +1,548 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+// specialField is implemented by the values of fields that are not encoded
+// into the payload, but applied to the logging.Entry instead.
+// Special fields are of type zapcore.SkipType, so other cores ignore them.
+type specialField interface {
+	// apply applies the field with the given key to the entry metadata.
+	apply(key string, meta *entryMeta)
+}
+
+// entryMeta collects the values of special fields for a single entry.
+type entryMeta struct {
+	labels      map[string]string
+	resource    *mrpb.MonitoredResource
+	trace       string
+	spanID      string
+	sampled     bool
+	operationID string
+	insertID    string
+	httpRequest *logging.HTTPRequest
+	user        string
+	payloadType string
+	flags       flagEvals
+	metrics     metrics
+	encoder     string
+	identity    *userIdentity
+	sql         *sqlEvent
+}
+
+// setLabel sets the given user label.
+//
+// Parameters:
+// - key: The key of the label.
+// - value: The value of the label.
+func (m *entryMeta) setLabel(key, value string) {
+	if m.labels == nil {
+		m.labels = make(map[string]string)
+	}
+	m.labels[key] = value
+}
+
+// collect applies the given special fields to the metadata.
+//
+// Parameters:
+// - fields: The special fields to apply.
+func (m *entryMeta) collect(fields []zapcore.Field) {
+	for _, f := range fields {
+		f.Interface.(specialField).apply(f.Key, m)
+	}
+}
+
+// isSpecial returns whether the given field is a special field.
+//
+// Parameters:
+// - f: The field to check.
+//
+// Returns:
+// - Whether the given field is a special field.
+func isSpecial(f zapcore.Field) bool {
+	if f.Type != zapcore.SkipType {
+		return false
+	}
+	_, ok := f.Interface.(specialField)
+	return ok
+}
+
+// splitFields splits the given fields into regular fields,
+// which are encoded into the payload, and special fields.
+//
+// Parameters:
+// - fields: The fields to split.
+//
+// Returns:
+// - The regular fields.
+// - The special fields.
+func splitFields(fields []zapcore.Field) ([]zapcore.Field, []zapcore.Field) {
+	n := 0
+	for _, f := range fields {
+		if isSpecial(f) {
+			n++
+		}
+	}
+	if n == 0 {
+		return fields, nil
+	}
+
+	regular := make([]zapcore.Field, 0, len(fields)-n)
+	special := make([]zapcore.Field, 0, n)
+	for _, f := range fields {
+		if isSpecial(f) {
+			special = append(special, f)
+		} else {
+			regular = append(regular, f)
+		}
+	}
+
+	return regular, special
+}
+
+// special returns a special field with the given key and value.
+//
+// Parameters:
+// - key: The key of the field.
+// - value: The value of the field.
+//
+// Returns:
+// - A special field with the given key and value.
+func special(key string, value specialField) zap.Field {
+	return zap.Field{Key: key, Type: zapcore.SkipType, Interface: value}
+}
+
+// fieldString returns the value of the given field as a string.
+//
+// Parameters:
+// - f: The field whose value to return.
+//
+// Returns:
+// - The value of the field as a string.
+func fieldString(f zapcore.Field) string {
+	if f.Type == zapcore.StringType {
+		return f.String
+	}
+
+	return fmt.Sprint(fieldValue(f))
+}
+
+// fieldValue returns the value of the given field.
+//
+// Parameters:
+// - f: The field whose value to return.
+//
+// Returns:
+// - The value of the field.
+func fieldValue(f zapcore.Field) interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+
+	return enc.Fields[f.Key]
+}
+
+// encodeFields replaces the fields whose key has a registered encoder by a field
+// holding the encoded value. The given slice is not modified.
+//
+// Parameters:
+// - encoders: The encoders by field key.
+// - fields: The fields to encode.
+//
+// Returns:
+// - The encoded fields.
+func encodeFields(encoders map[string]func(interface{}) interface{}, fields []zapcore.Field) []zapcore.Field {
+	if len(encoders) == 0 {
+		return fields
+	}
+
+	var encoded []zapcore.Field
+	for i, f := range fields {
+		encode, ok := encoders[f.Key]
+		if !ok {
+			continue
+		}
+		if encoded == nil {
+			encoded = append([]zapcore.Field(nil), fields...)
+		}
+		encoded[i] = zap.Any(f.Key, encode(fieldValue(f)))
+	}
+	if encoded == nil {
+		return fields
+	}
+
+	return encoded
+}
+
+// isNilField reports whether the value of the given field is encoded as null,
+// e.g. zap.Any with a nil value or a nil pointer, map or slice.
+//
+// Parameters:
+// - f: The field to check.
+//
+// Returns:
+// - True if the value of the field is nil, false otherwise.
+func isNilField(f zapcore.Field) bool {
+	switch f.Type {
+	case zapcore.ReflectType:
+		if f.Interface == nil {
+			return true
+		}
+		switch v := reflect.ValueOf(f.Interface); v.Kind() {
+		case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+			return v.IsNil()
+		}
+		return false
+	case zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType, zapcore.StringerType:
+		return f.Interface == nil
+	default:
+		return false
+	}
+}
+
+// omitNilFields returns the given fields without the fields whose value is nil.
+// The given slice is not modified.
+//
+// Parameters:
+// - fields: The fields to filter.
+//
+// Returns:
+// - The fields without nil values.
+func omitNilFields(fields []zapcore.Field) []zapcore.Field {
+	var kept []zapcore.Field
+	for i, f := range fields {
+		if !isNilField(f) {
+			if kept != nil {
+				kept = append(kept, f)
+			}
+			continue
+		}
+		if kept == nil {
+			kept = append(make([]zapcore.Field, 0, len(fields)-1), fields[:i]...)
+		}
+	}
+	if kept == nil {
+		return fields
+	}
+
+	return kept
+}
+
+// dedupFields returns the given fields with only the last field of every key.
+// The remaining fields keep their relative order. The given slice is not modified.
+//
+// Parameters:
+// - fields: The fields to deduplicate.
+//
+// Returns:
+// - The deduplicated fields.
+func dedupFields(fields []zapcore.Field) []zapcore.Field {
+	last := make(map[string]int, len(fields))
+	for i, f := range fields {
+		last[f.Key] = i
+	}
+	if len(last) == len(fields) {
+		return fields
+	}
+
+	deduped := make([]zapcore.Field, 0, len(last))
+	for i, f := range fields {
+		if last[f.Key] == i {
+			deduped = append(deduped, f)
+		}
+	}
+
+	return deduped
+}
+
+// ellipsis marks truncated strings.
+const ellipsis = "…"
+
+// truncate truncates the given string to at most limit bytes, marking the truncation
+// with an ellipsis. The string is never cut within a UTF-8 encoded rune.
+//
+// Parameters:
+// - s: The string to truncate.
+// - limit: The maximum length of the result in bytes.
+//
+// Returns:
+// - The truncated string, or s if it is not longer than limit.
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+
+	suffix := ellipsis
+	if limit < len(suffix) {
+		suffix = ""
+	}
+	cut := limit - len(suffix)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+
+	return s[:cut] + suffix
+}
+
+// labelField is the value of a field created by Label.
+type labelField string
+
+// apply sets the label on the entry metadata.
+//
+// Parameters:
+// - key: The key of the label.
+// - meta: The entry metadata.
+func (l labelField) apply(key string, meta *entryMeta) {
+	meta.setLabel(key, string(l))
+}
+
+// Label returns a zap.Field that attaches the given label to the log entry.
+// The label is not part of the payload.
+//
+// Parameters:
+// - key: The key of the label.
+// - value: The value of the label.
+//
+// Returns:
+// - A zap.Field that attaches the given label to the log entry.
+func Label(key, value string) zap.Field {
+	return special(key, labelField(value))
+}
+
+// resourceField is the value of a field created by Resource.
+type resourceField struct {
+	resource *mrpb.MonitoredResource
+}
+
+// apply sets the resource on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (r resourceField) apply(_ string, meta *entryMeta) {
+	meta.resource = r.resource
+}
+
+// Resource returns a zap.Field that sets the monitored resource of the log entry,
+// overriding the resource of the configuration and of the Google Cloud Logging logger.
+//
+// Parameters:
+// - res: The monitored resource the entry belongs to.
+//
+// Returns:
+// - A zap.Field that sets the monitored resource of the log entry.
+func Resource(res *mrpb.MonitoredResource) zap.Field {
+	return special("resource", resourceField{resource: res})
+}
+
+// traceField is the value of a field that sets the trace of the entry.
+type traceField string
+
+// apply sets the trace on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (t traceField) apply(_ string, meta *entryMeta) {
+	meta.trace = string(t)
+}
+
+// Trace returns a zap.Field that sets the trace of the log entry,
+// correlating it with Cloud Trace. The trace should be the full resource name,
+// e.g. "projects/my-project/traces/06796866738c859f2f19b7cfb3214824".
+// A bare trace ID is qualified with Config.ProjectID, if set.
+//
+// Parameters:
+// - trace: The trace of the entry.
+//
+// Returns:
+// - A zap.Field that sets the trace of the log entry.
+func Trace(trace string) zap.Field {
+	return special("trace", traceField(trace))
+}
+
+// traceSampledField is the value of a field created by TraceSampled.
+type traceSampledField bool
+
+// apply sets whether the trace is sampled on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (t traceSampledField) apply(_ string, meta *entryMeta) {
+	meta.sampled = bool(t)
+}
+
+// TraceSampled returns a zap.Field that sets whether the trace of the log entry is sampled.
+//
+// Parameters:
+// - sampled: Whether the trace is sampled.
+//
+// Returns:
+// - A zap.Field that sets whether the trace of the log entry is sampled.
+func TraceSampled(sampled bool) zap.Field {
+	return special("traceSampled", traceSampledField(sampled))
+}
+
+// spanIDField is the value of a field that sets the span ID of the entry.
+type spanIDField string
+
+// apply sets the span ID on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (s spanIDField) apply(_ string, meta *entryMeta) {
+	meta.spanID = string(s)
+}
+
+// SpanID returns a zap.Field that sets the span ID of the log entry within its trace.
+//
+// Parameters:
+// - id: The span ID of the entry.
+//
+// Returns:
+// - A zap.Field that sets the span ID of the log entry.
+func SpanID(id string) zap.Field {
+	return special("spanId", spanIDField(id))
+}
+
+// insertIDField is the value of a field that sets the insert ID of the entry.
+type insertIDField string
+
+// apply sets the insert ID on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (i insertIDField) apply(_ string, meta *entryMeta) {
+	meta.insertID = string(i)
+}
+
+// httpRequestField is the value of a field that sets the HTTP request of the entry.
+type httpRequestField struct {
+	request *logging.HTTPRequest
+}
+
+// apply sets the HTTP request on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (h httpRequestField) apply(_ string, meta *entryMeta) {
+	meta.httpRequest = h.request
+}
+
+// HTTPRequest returns a zap.Field that sets the HTTP request of the entry,
+// e.g. one built with NewHTTPRequest.
+//
+// Parameters:
+// - request: The HTTP request.
+//
+// Returns:
+// - A zap.Field that sets the HTTP request of the entry.
+func HTTPRequest(request *logging.HTTPRequest) zap.Field {
+	return special("httpRequest", httpRequestField{request: request})
+}
+
+// operationField is the value of a field created by Operation.
+type operationField string
+
+// apply sets the operation ID on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (o operationField) apply(_ string, meta *entryMeta) {
+	meta.operationID = string(o)
+}
+
+// Operation returns a zap.Field that sets the ID of the operation the entry belongs to.
+// The producer of the operation is taken from Config.OperationProducer.
+//
+// Parameters:
+// - id: The ID of the operation.
+//
+// Returns:
+// - A zap.Field that sets the operation of the entry.
+func Operation(id string) zap.Field {
+	return special("operation", operationField(id))
+}
+
+// typeField is the value of a field created by Type.
+type typeField string
+
+// apply sets the payload type on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (t typeField) apply(_ string, meta *entryMeta) {
+	meta.payloadType = string(t)
+}
+
+// Type returns a zap.Field that sets the "@type" key of the payload,
+// e.g. "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+// for Cloud Error Reporting.
+//
+// Parameters:
+// - t: The type URL of the payload.
+//
+// Returns:
+// - A zap.Field that sets the type of the payload.
+func Type(t string) zap.Field {
+	return special("@type", typeField(t))
+}
+
+// encoderField is the value of a field created by UseEncoder.
+type encoderField string
+
+// apply sets the encoder on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (e encoderField) apply(_ string, meta *entryMeta) {
+	meta.encoder = string(e)
+}
+
+// UseEncoder returns a zap.Field that selects the encoder registered
+// under the given name in Config.Encoders for the entry,
+// e.g. to give audit entries a different payload shape.
+//
+// Parameters:
+// - name: The name of the encoder.
+//
+// Returns:
+// - A zap.Field that selects the encoder of the entry.
+func UseEncoder(name string) zap.Field {
+	return special("encoder", encoderField(name))
+}
@@ -0,0 +1,372 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestResource(t *testing.T) {
+	configured := &mrpb.MonitoredResource{Type: "k8s_container", Labels: map[string]string{"cluster_name": "prod"}}
+	instance := &mrpb.MonitoredResource{Type: "gce_instance", Labels: map[string]string{"instance_id": "42"}}
+
+	tests := []struct {
+		name     string
+		config   *mrpb.MonitoredResource
+		with     []zapcore.Field
+		fields   []zapcore.Field
+		expected *mrpb.MonitoredResource
+	}{
+		{name: "none", expected: nil},
+		{name: "configured", config: configured, expected: configured},
+		{name: "entry field wins", config: configured, fields: []zapcore.Field{Resource(instance)}, expected: instance},
+		{name: "inherited field wins", config: configured, with: []zapcore.Field{Resource(instance)}, expected: instance},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{Resource: tt.config}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := out.Entries()[0].Resource; !proto.Equal(got, tt.expected) {
+				t.Errorf("resource = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestType(t *testing.T) {
+	const auditType = "type.googleapis.com/google.cloud.audit.AuditLog"
+
+	tests := []struct {
+		name   string
+		with   []zapcore.Field
+		fields []zapcore.Field
+		want   interface{}
+	}{
+		{name: "none", want: nil},
+		{name: "entry field", fields: []zapcore.Field{Type(auditType)}, want: auditType},
+		{name: "inherited field", with: []zapcore.Field{Type(auditType)}, want: auditType},
+		{name: "entry field wins", with: []zapcore.Field{Type("inherited")}, fields: []zapcore.Field{Type(auditType)}, want: auditType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			payload := payloadOf(t, out.Entries()[0])
+			if got := payload["@type"]; got != tt.want {
+				t.Errorf("@type = %v, want %v", got, tt.want)
+			}
+			if _, ok := payload["type"]; ok {
+				t.Error("type field written as a regular field")
+			}
+		})
+	}
+}
+
+func TestUseEncoder(t *testing.T) {
+	audit := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "audit_action"})
+
+	tests := []struct {
+		name       string
+		fields     []zapcore.Field
+		wantKey    string
+		absentKey  string
+		wantErrors int
+	}{
+		{name: "default encoder", wantKey: "message", absentKey: "audit_action"},
+		{name: "audit encoder", fields: []zapcore.Field{UseEncoder("audit")}, wantKey: "audit_action", absentKey: "message"},
+		{name: "unknown encoder falls back", fields: []zapcore.Field{UseEncoder("missing")}, wantKey: "message", absentKey: "audit_action", wantErrors: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []error
+			out := &fakeSink{}
+			core := newCore(out, Config{
+				Encoders: map[string]zapcore.Encoder{"audit": audit},
+				OnError:  func(err error) { errs = append(errs, err) },
+			}).With([]zapcore.Field{zap.String("actor", "alice")})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "grant role"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			payload := payloadOf(t, out.Entries()[0])
+			if payload[tt.wantKey] != "grant role" {
+				t.Errorf("%s = %#v, want %q in %v", tt.wantKey, payload[tt.wantKey], "grant role", payload)
+			}
+			if _, ok := payload[tt.absentKey]; ok {
+				t.Errorf("unexpected key %q in %v", tt.absentKey, payload)
+			}
+			if payload["actor"] != "alice" {
+				t.Errorf("actor = %#v, want the inherited field in every encoder", payload["actor"])
+			}
+			if _, ok := payload["encoder"]; ok {
+				t.Error("encoder field written as a regular field")
+			}
+			if len(errs) != tt.wantErrors {
+				t.Errorf("got %d errors, want %d: %v", len(errs), tt.wantErrors, errs)
+			}
+		})
+	}
+}
+
+func TestOmitNilFields(t *testing.T) {
+	type order struct{ ID string }
+	var (
+		nilOrder *order
+		nilMap   map[string]int
+		nilSlice []string
+	)
+
+	tests := []struct {
+		name  string
+		field zapcore.Field
+		isNil bool
+	}{
+		{name: "nil any", field: zap.Any("x", nil), isNil: true},
+		{name: "nil pointer", field: zap.Any("x", nilOrder), isNil: true},
+		{name: "nil map", field: zap.Reflect("x", nilMap), isNil: true},
+		{name: "nil slice", field: zap.Reflect("x", nilSlice), isNil: true},
+		{name: "value", field: zap.Any("x", &order{ID: "o-1"})},
+		{name: "empty string", field: zap.String("x", "")},
+		{name: "zero int", field: zap.Int("x", 0)},
+	}
+
+	for _, tt := range tests {
+		for _, omit := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/omit=%v", tt.name, omit), func(t *testing.T) {
+				out := &fakeSink{}
+				core := newCore(out, Config{OmitNilFields: omit}).With([]zapcore.Field{tt.field})
+				if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, []zapcore.Field{zap.Any("y", nil)}); err != nil {
+					t.Fatal(err)
+				}
+
+				payload := payloadOf(t, out.Entries()[0])
+				value, present := payload["x"]
+				if wantPresent := !omit || !tt.isNil; present != wantPresent {
+					t.Errorf("x present = %v, want %v in %v", present, wantPresent, payload)
+				}
+				if present && tt.isNil && value != nil {
+					t.Errorf("x = %#v, want null", value)
+				}
+				if _, present := payload["y"]; present == omit {
+					t.Errorf("y present = %v, want %v", present, !omit)
+				}
+			})
+		}
+	}
+}
+
+func TestOperation(t *testing.T) {
+	const producer = "github.com/example/worker"
+
+	tests := []struct {
+		name     string
+		producer string
+		with     []zapcore.Field
+		fields   []zapcore.Field
+		want     *logpb.LogEntryOperation
+	}{
+		{name: "none", producer: producer},
+		{name: "configured producer", producer: producer, fields: []zapcore.Field{Operation("job-1")}, want: &logpb.LogEntryOperation{Id: "job-1", Producer: producer}},
+		{name: "no producer", fields: []zapcore.Field{Operation("job-1")}, want: &logpb.LogEntryOperation{Id: "job-1"}},
+		{name: "inherited", producer: producer, with: []zapcore.Field{Operation("job-2")}, want: &logpb.LogEntryOperation{Id: "job-2", Producer: producer}},
+		{
+			name:     "entry field wins",
+			producer: producer,
+			with:     []zapcore.Field{Operation("job-2")},
+			fields:   []zapcore.Field{Operation("job-3")},
+			want:     &logpb.LogEntryOperation{Id: "job-3", Producer: producer},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{OperationProducer: tt.producer}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := out.Entries()[0].Operation; !proto.Equal(got, tt.want) {
+				t.Errorf("operation = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeduplicateFields(t *testing.T) {
+	tests := []struct {
+		name      string
+		dedup     bool
+		with      []zapcore.Field
+		fields    []zapcore.Field
+		wantCount int
+		wantUser  string
+	}{
+		{
+			name:      "disabled",
+			fields:    []zapcore.Field{zap.String("user", "alice"), zap.String("user", "bob")},
+			wantCount: 2,
+			wantUser:  "bob",
+		},
+		{
+			name:      "entry fields",
+			dedup:     true,
+			fields:    []zapcore.Field{zap.String("user", "alice"), zap.Int("n", 1), zap.String("user", "bob")},
+			wantCount: 1,
+			wantUser:  "bob",
+		},
+		{
+			name:      "With fields",
+			dedup:     true,
+			with:      []zapcore.Field{zap.String("user", "alice"), zap.String("user", "bob")},
+			wantCount: 1,
+			wantUser:  "bob",
+		},
+		{
+			name:      "different types",
+			dedup:     true,
+			fields:    []zapcore.Field{zap.Int("user", 1), zap.String("user", "bob")},
+			wantCount: 1,
+			wantUser:  "bob",
+		},
+		{
+			name:      "With fields are not replaced",
+			dedup:     true,
+			with:      []zapcore.Field{zap.String("user", "alice")},
+			fields:    []zapcore.Field{zap.String("user", "bob")},
+			wantCount: 2,
+			wantUser:  "bob",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{DeduplicateFields: tt.dedup}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if got := strings.Count(string(entry.Payload.(json.RawMessage)), `"user":`); got != tt.wantCount {
+				t.Errorf("got %d user keys, want %d", got, tt.wantCount)
+			}
+			if got := payloadOf(t, entry)["user"]; got != tt.wantUser {
+				t.Errorf("user = %v, want %q", got, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestFieldEncoders(t *testing.T) {
+	cents := func(v interface{}) interface{} {
+		c := v.(int64)
+		return fmt.Sprintf("%d.%02d", c/100, c%100)
+	}
+	upper := func(v interface{}) interface{} {
+		return strings.ToUpper(v.(string))
+	}
+
+	tests := []struct {
+		name     string
+		encoders map[string]func(interface{}) interface{}
+		with     []zapcore.Field
+		fields   []zapcore.Field
+		want     map[string]interface{}
+	}{
+		{
+			name:   "no encoders",
+			fields: []zapcore.Field{zap.Int64("price", 1250)},
+			want:   map[string]interface{}{"price": float64(1250)},
+		},
+		{
+			name:     "fixed-point price",
+			encoders: map[string]func(interface{}) interface{}{"price": cents},
+			fields:   []zapcore.Field{zap.Int64("price", 1250), zap.Int64("quantity", 3)},
+			want:     map[string]interface{}{"price": "12.50", "quantity": float64(3)},
+		},
+		{
+			name:     "With fields",
+			encoders: map[string]func(interface{}) interface{}{"price": cents},
+			with:     []zapcore.Field{zap.Int64("price", 99)},
+			want:     map[string]interface{}{"price": "0.99"},
+		},
+		{
+			name:     "several encoders",
+			encoders: map[string]func(interface{}) interface{}{"price": cents, "currency": upper},
+			fields:   []zapcore.Field{zap.Int64("price", 100), zap.String("currency", "eur")},
+			want:     map[string]interface{}{"price": "1.00", "currency": "EUR"},
+		},
+		{
+			name: "structured result",
+			encoders: map[string]func(interface{}) interface{}{"price": func(v interface{}) interface{} {
+				return map[string]interface{}{"cents": v}
+			}},
+			fields: []zapcore.Field{zap.Int64("price", 5)},
+			want:   map[string]interface{}{"price": map[string]interface{}{"cents": float64(5)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{FieldEncoders: tt.encoders}).With(tt.with)
+			given := append([]zapcore.Field(nil), tt.fields...)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			payload := payloadOf(t, out.Entries()[0])
+			for key, want := range tt.want {
+				if got := payload[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %#v, want %#v", key, got, want)
+				}
+			}
+			for i := range given {
+				if !given[i].Equals(tt.fields[i]) {
+					t.Fatal("the given fields have been modified")
+				}
+			}
+		})
+	}
+}
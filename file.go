@@ -0,0 +1,193 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fileRotationCheckInterval is the interval in which a fileSyncer checks
+// whether its file has been rotated.
+const fileRotationCheckInterval = time.Second
+
+// NewFile creates a new zap.Logger that writes logs to the file at the given path
+// in the Google Cloud Logging structured logging format, instead of calling the API,
+// e.g. for the Ops Agent to tail. Special fields, such as the trace, are inlined
+// into the JSON using the keys recognized by the agent.
+// No Google Cloud Logging client is required.
+// To write to a file alongside Google Cloud Logging, set Config.FilePath instead.
+//
+// Parameters:
+// - path: The path of the file to write to.
+// - config: The configuration for the zap.Logger.
+//
+// Returns:
+// - A new zap.Logger that writes structured logs to the file.
+func NewFile(path string, config Config) *zap.Logger {
+	core := newCore(newStructuredSink(newFileSyncer(path)), config)
+	logger := zap.New(core, config.Options()...)
+	logEffectiveConfig(logger, config)
+
+	return logger
+}
+
+// ReopenFile closes the file the Core writes to, if any, so that it is reopened
+// at its path on the next write. Call it after rotating the file, e.g. on SIGHUP,
+// to pick up the new file immediately instead of within a second.
+//
+// Returns:
+// - An error if the file could not be closed, nil otherwise.
+func (c *Core) ReopenFile() error {
+	if c.file != nil {
+		return c.file.reopen()
+	}
+	if s, ok := c.out.(*structuredSink); ok {
+		if file, ok := s.out.(*fileSyncer); ok {
+			return file.reopen()
+		}
+	}
+	return nil
+}
+
+// fileSyncer is a zapcore.WriteSyncer that appends to the file at a path.
+// The file is reopened if it has been renamed or removed,
+// so that external log rotation is picked up.
+// Rotation is checked at most once per fileRotationCheckInterval,
+// so that writes do not cost additional system calls.
+type fileSyncer struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	checked time.Time
+}
+
+// newFileSyncer creates a new fileSyncer for the given path.
+// The file is opened lazily on the first write.
+//
+// Parameters:
+// - path: The path of the file to write to.
+//
+// Returns:
+// - A new fileSyncer.
+func newFileSyncer(path string) *fileSyncer {
+	return &fileSyncer{path: path}
+}
+
+// Write appends the given bytes to the file.
+//
+// Parameters:
+// - p: The bytes to write.
+//
+// Returns:
+// - The number of bytes written.
+// - An error if the file could not be opened or written, nil otherwise.
+func (s *fileSyncer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return 0, err
+	}
+
+	return s.file.Write(p)
+}
+
+// Sync commits the contents of the file to stable storage.
+//
+// Returns:
+// - An error if the file could not be synced, nil otherwise.
+func (s *fileSyncer) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	return s.file.Sync()
+}
+
+// reopen closes the file, so that it is reopened on the next write.
+//
+// Returns:
+// - An error if the file could not be closed, nil otherwise.
+func (s *fileSyncer) reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// Close closes the file. A later write reopens it.
+//
+// Returns:
+// - An error if the file could not be closed, nil otherwise.
+func (s *fileSyncer) Close() error {
+	return s.reopen()
+}
+
+// open opens the file if it is not open yet, or if the open file
+// no longer is the file at the path, which is checked once per interval.
+// The caller must hold the lock.
+//
+// Returns:
+// - An error if the file could not be opened, nil otherwise.
+func (s *fileSyncer) open() error {
+	now := time.Now()
+	if s.file != nil && now.Sub(s.checked) < fileRotationCheckInterval {
+		return nil
+	}
+	s.checked = now
+
+	if s.file != nil {
+		current, err := os.Stat(s.path)
+		if err == nil {
+			opened, err := s.file.Stat()
+			if err == nil && os.SameFile(current, opened) {
+				return nil
+			}
+		}
+
+		// The file has been rotated.
+		_ = s.file.Close()
+		s.file = nil
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+
+	return nil
+}
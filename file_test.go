@@ -0,0 +1,225 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// readJSONLines decodes the JSON lines of the file at the given path.
+//
+// Parameters:
+// - t: The test.
+// - path: The path of the file.
+//
+// Returns:
+// - The decoded lines.
+func readJSONLines(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid line %s: %v", scanner.Bytes(), err)
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestFilePath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	out := &fakeSink{}
+	core := newCore(out, Config{FilePath: path})
+	for _, msg := range []string{"first", "second"} {
+		if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: msg}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := core.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readJSONLines(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	for i, want := range []string{"first", "second"} {
+		if lines[i]["message"] != want {
+			t.Errorf("line %d: message = %v, want %q", i, lines[i]["message"], want)
+		}
+	}
+	if got := len(out.Entries()); got != 2 {
+		t.Errorf("got %d entries, want the file to be written alongside the sink", got)
+	}
+}
+
+func TestFilePathStructured(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	logger := zap.New(newCore(&fakeSink{}, Config{FilePath: path, EncoderConfig: DefaultEncoderConfig()}), zap.AddCaller())
+	logger.Info("hello", Trace("projects/p/traces/abc"), SpanID("0123456789abcdef"), Label("team", "core"), zap.String("tenant", "acme"))
+	if err := logger.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readJSONLines(t, path)
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1", len(lines))
+	}
+	line := lines[0]
+	if line["message"] != "hello" || line["tenant"] != "acme" {
+		t.Errorf("line = %v, want the payload", line)
+	}
+	if line[structuredTraceKey] != "projects/p/traces/abc" {
+		t.Errorf("trace = %v, want it inlined", line[structuredTraceKey])
+	}
+	if line[structuredSpanIDKey] != "0123456789abcdef" {
+		t.Errorf("span ID = %v, want it inlined", line[structuredSpanIDKey])
+	}
+	labels, _ := line[structuredLabelsKey].(map[string]interface{})
+	if labels["team"] != "core" {
+		t.Errorf("labels = %v, want the team label", labels)
+	}
+	location, _ := line[structuredSourceLocationKey].(map[string]interface{})
+	if file, _ := location["file"].(string); !strings.HasSuffix(file, "file_test.go") {
+		t.Errorf("source location = %v, want the test file", location)
+	}
+}
+
+func TestCloseClosesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	core := newCore(&fakeSink{}, Config{FilePath: path})
+	if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "before close"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	core.file.mu.Lock()
+	closed := core.file.file == nil
+	core.file.mu.Unlock()
+	if !closed {
+		t.Error("file is open after Close, want it closed")
+	}
+	if lines := readJSONLines(t, path); len(lines) != 1 || lines[0]["message"] != "before close" {
+		t.Errorf("lines = %v, want the entry written before Close", lines)
+	}
+}
+
+func TestFileRotation(t *testing.T) {
+	tests := []struct {
+		name   string
+		rotate func(core *Core, s *fileSyncer) error
+	}{
+		{
+			name: "reopen",
+			rotate: func(core *Core, s *fileSyncer) error {
+				return core.ReopenFile()
+			},
+		},
+		{
+			name: "rotation check",
+			rotate: func(core *Core, s *fileSyncer) error {
+				// Let the interval elapse.
+				s.mu.Lock()
+				s.checked = s.checked.Add(-fileRotationCheckInterval)
+				s.mu.Unlock()
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log")
+			core := newCore(&fakeSink{}, Config{FilePath: path})
+			write := func(msg string) {
+				t.Helper()
+				if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: msg}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			write("before")
+			if err := os.Rename(path, filepath.Join(dir, "app.log.1")); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.rotate(core, core.file); err != nil {
+				t.Fatal(err)
+			}
+			write("after")
+
+			lines := readJSONLines(t, path)
+			if len(lines) != 1 || lines[0]["message"] != "after" {
+				t.Errorf("lines = %v, want only the entry written after the rotation", lines)
+			}
+			rotated := readJSONLines(t, filepath.Join(dir, "app.log.1"))
+			if len(rotated) != 1 || rotated[0]["message"] != "before" {
+				t.Errorf("rotated lines = %v, want only the entry written before the rotation", rotated)
+			}
+		})
+	}
+}
+
+func TestNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	logger := NewFile(path, Config{})
+	logger.Info("hello", Trace("projects/p/traces/abc"), Label("team", "core"))
+	if err := logger.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readJSONLines(t, path)
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1", len(lines))
+	}
+	if lines[0]["message"] != "hello" {
+		t.Errorf("message = %v, want %q", lines[0]["message"], "hello")
+	}
+	if lines[0][structuredTraceKey] != "projects/p/traces/abc" {
+		t.Errorf("trace = %v, want it inlined", lines[0][structuredTraceKey])
+	}
+	labels, _ := lines[0][structuredLabelsKey].(map[string]interface{})
+	if labels["team"] != "core" {
+		t.Errorf("labels = %v, want the team label", labels)
+	}
+}
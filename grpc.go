@@ -0,0 +1,182 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcCodeKey is the key of the field holding the gRPC status code of an entry.
+const grpcCodeKey = "grpcCode"
+
+// GRPCStatusSeverity returns the severity appropriate for an RPC
+// that finished with the given gRPC status code.
+// Client errors map to INFO or WARNING. Server errors, such as Unknown, Unimplemented,
+// Internal and DataLoss, and codes unknown to this package map to ERROR.
+//
+// Parameters:
+// - code: The gRPC status code.
+//
+// Returns:
+// - The severity for the status code.
+func GRPCStatusSeverity(code codes.Code) logging.Severity {
+	switch code {
+	case codes.OK, codes.Canceled, codes.InvalidArgument, codes.AlreadyExists, codes.Unauthenticated:
+		return logging.Info
+	case codes.NotFound, codes.DeadlineExceeded, codes.PermissionDenied, codes.ResourceExhausted,
+		codes.FailedPrecondition, codes.Aborted, codes.OutOfRange, codes.Unavailable:
+		return logging.Warning
+	default:
+		return logging.Error
+	}
+}
+
+// grpcCode returns the gRPC status code held by the given field.
+// The code may be held as a codes.Code or as an integer.
+//
+// Parameters:
+// - f: The field holding the code.
+//
+// Returns:
+// - The gRPC status code.
+// - Whether the field holds a gRPC status code.
+func grpcCode(f zapcore.Field) (codes.Code, bool) {
+	switch f.Type {
+	case zapcore.StringerType, zapcore.ReflectType:
+		code, ok := f.Interface.(codes.Code)
+		return code, ok
+	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type,
+		zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type:
+		return codes.Code(f.Integer), true
+	default:
+		return 0, false
+	}
+}
+
+// elevateGRPCSeverity raises the given severity to the severity of the gRPC status code
+// held by the "grpcCode" field, if any and if it is higher.
+//
+// Parameters:
+// - severity: The severity of the entry.
+// - fields: The fields of the entry.
+//
+// Returns:
+// - The possibly elevated severity.
+func elevateGRPCSeverity(severity logging.Severity, fields []zapcore.Field) logging.Severity {
+	for _, f := range fields {
+		if f.Key != grpcCodeKey {
+			continue
+		}
+		if code, ok := grpcCode(f); ok {
+			if s := GRPCStatusSeverity(code); s > severity {
+				severity = s
+			}
+		}
+	}
+
+	return severity
+}
+
+// logRPC logs a finished RPC with the given logger.
+//
+// Parameters:
+// - ctx: The context of the RPC.
+// - logger: The logger to log the RPC with.
+// - method: The full name of the method.
+// - err: The error returned by the handler, may be nil.
+// - latency: The time it took to handle the RPC.
+func logRPC(ctx context.Context, logger *zap.Logger, method string, err error, latency time.Duration) {
+	code := status.Code(err)
+	fields := []zap.Field{
+		zap.String("grpcMethod", method),
+		zap.Stringer(grpcCodeKey, code),
+		zap.Duration("latency", latency),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		fields = append(fields, zap.String("peer", p.Addr.String()))
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(strings.ToLower(cloudTraceHeader)); len(values) > 0 {
+			if trace, span, sampled, ok := ParseCloudTraceHeader(values[0]); ok {
+				fields = append(fields, Trace(trace), TraceSampled(sampled))
+				if span != "" {
+					fields = append(fields, SpanID(span))
+				}
+			}
+		}
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+
+	if ce := logger.Check(FromSeverity(GRPCStatusSeverity(code)), method); ce != nil {
+		ce.Write(fields...)
+	}
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor that logs every unary RPC
+// with the given logger. Each entry carries the method, the status code as the
+// "grpcCode" field, the latency, the peer and the trace of the x-cloud-trace-context
+// metadata, if present. The level is derived from the status code using GRPCStatusSeverity.
+//
+// Parameters:
+// - logger: The logger to log the RPCs with.
+//
+// Returns:
+// - The interceptor.
+func UnaryServerInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logRPC(ctx, logger, info.FullMethod, err, time.Since(start))
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor that logs every streaming RPC
+// with the given logger once the stream has finished.
+// The entries are built like those of UnaryServerInterceptor.
+//
+// Parameters:
+// - logger: The logger to log the RPCs with.
+//
+// Returns:
+// - The interceptor.
+func StreamServerInterceptor(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logRPC(ss.Context(), logger, info.FullMethod, err, time.Since(start))
+		return err
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCStatusSeverity(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want logging.Severity
+	}{
+		{codes.OK, logging.Info},
+		{codes.InvalidArgument, logging.Info},
+		{codes.NotFound, logging.Warning},
+		{codes.PermissionDenied, logging.Warning},
+		{codes.Unavailable, logging.Warning},
+		{codes.Unknown, logging.Error},
+		{codes.Internal, logging.Error},
+		{codes.DataLoss, logging.Error},
+		{codes.Code(99), logging.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			if got := GRPCStatusSeverity(tt.code); got != tt.want {
+				t.Errorf("GRPCStatusSeverity(%v) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestElevateGRPCSeverity(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		level   zapcore.Level
+		field   zapcore.Field
+		want    logging.Severity
+	}{
+		{name: "elevated", enabled: true, level: zapcore.InfoLevel, field: zap.Stringer(grpcCodeKey, codes.Internal), want: logging.Error},
+		{name: "integer code", enabled: true, level: zapcore.InfoLevel, field: zap.Int(grpcCodeKey, int(codes.NotFound)), want: logging.Warning},
+		{name: "never lowered", enabled: true, level: zapcore.ErrorLevel, field: zap.Stringer(grpcCodeKey, codes.OK), want: logging.Error},
+		{name: "disabled", enabled: false, level: zapcore.InfoLevel, field: zap.Stringer(grpcCodeKey, codes.Internal), want: logging.Info},
+		{name: "other key", enabled: true, level: zapcore.InfoLevel, field: zap.Stringer("code", codes.Internal), want: logging.Info},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{ElevateGRPCSeverity: tt.enabled})
+			if err := core.Write(zapcore.Entry{Level: tt.level, Message: "rpc"}, []zapcore.Field{tt.field}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := out.Entries()[0].Severity; got != tt.want {
+				t.Errorf("severity = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeServerStream is a grpc.ServerStream with a fixed context.
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the stream.
+//
+// Returns:
+// - The context of the stream.
+func (s fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestServerInterceptors(t *testing.T) {
+	const method = "/orders.v1.Orders/Get"
+	peerCtx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4242}})
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		err          error
+		wantSeverity logging.Severity
+		wantCode     string
+		wantPeer     interface{}
+		wantTrace    string
+		wantSpan     string
+	}{
+		{name: "ok", ctx: context.Background(), wantSeverity: logging.Info, wantCode: "OK"},
+		{
+			name:         "not found",
+			ctx:          peerCtx,
+			err:          status.Error(codes.NotFound, "no such order"),
+			wantSeverity: logging.Warning,
+			wantCode:     "NotFound",
+			wantPeer:     "192.0.2.1:4242",
+		},
+		{
+			name:         "plain error",
+			ctx:          context.Background(),
+			err:          errors.New("boom"),
+			wantSeverity: logging.Error,
+			wantCode:     "Unknown",
+		},
+		{
+			name:         "trace correlation",
+			ctx:          metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-cloud-trace-context", testTraceID+"/1;o=1")),
+			wantSeverity: logging.Info,
+			wantCode:     "OK",
+			wantTrace:    testTraceID,
+			wantSpan:     "0000000000000001",
+		},
+	}
+
+	interceptors := []struct {
+		name string
+		call func(logger *zap.Logger, ctx context.Context, err error) error
+	}{
+		{
+			name: "unary",
+			call: func(logger *zap.Logger, ctx context.Context, err error) error {
+				_, got := UnaryServerInterceptor(logger)(ctx, "request", &grpc.UnaryServerInfo{FullMethod: method},
+					func(context.Context, interface{}) (interface{}, error) { return "response", err })
+				return got
+			},
+		},
+		{
+			name: "stream",
+			call: func(logger *zap.Logger, ctx context.Context, err error) error {
+				return StreamServerInterceptor(logger)(nil, fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: method},
+					func(interface{}, grpc.ServerStream) error { return err })
+			},
+		},
+	}
+
+	for _, interceptor := range interceptors {
+		for _, tt := range tests {
+			t.Run(interceptor.name+"/"+tt.name, func(t *testing.T) {
+				out := &fakeSink{}
+				logger := zap.New(newCore(out, Config{}))
+				if err := interceptor.call(logger, tt.ctx, tt.err); err != tt.err {
+					t.Errorf("interceptor returned %v, want the handler error %v", err, tt.err)
+				}
+
+				entries := out.Entries()
+				if len(entries) != 1 {
+					t.Fatalf("got %d entries, want 1", len(entries))
+				}
+				entry := entries[0]
+				if entry.Severity != tt.wantSeverity {
+					t.Errorf("severity = %v, want %v", entry.Severity, tt.wantSeverity)
+				}
+				if entry.Trace != tt.wantTrace || entry.SpanID != tt.wantSpan {
+					t.Errorf("trace = %q, %q, want %q, %q", entry.Trace, entry.SpanID, tt.wantTrace, tt.wantSpan)
+				}
+				payload := payloadOf(t, entry)
+				if payload["message"] != method || payload["grpcMethod"] != method {
+					t.Errorf("message = %v, grpcMethod = %v, want %q", payload["message"], payload["grpcMethod"], method)
+				}
+				if payload[grpcCodeKey] != tt.wantCode {
+					t.Errorf("%s = %v, want %q", grpcCodeKey, payload[grpcCodeKey], tt.wantCode)
+				}
+				if payload["peer"] != tt.wantPeer {
+					t.Errorf("peer = %v, want %v", payload["peer"], tt.wantPeer)
+				}
+				if _, ok := payload["latency"].(float64); !ok {
+					t.Errorf("latency = %#v, want seconds", payload["latency"])
+				}
+				if _, ok := payload["error"]; ok != (tt.err != nil) {
+					t.Errorf("error present = %v, want %v", ok, tt.err != nil)
+				}
+			})
+		}
+	}
+}
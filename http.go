@@ -0,0 +1,202 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// redacted replaces the values of sensitive headers.
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders are the canonical names of headers whose values are never logged.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// header is a single header with its joined values.
+type header struct {
+	name  string
+	value string
+}
+
+// headers is a zapcore.ObjectMarshaler for a list of headers.
+type headers []header
+
+// MarshalLogObject adds the headers to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the headers to.
+//
+// Returns:
+// - Always nil.
+func (hs headers) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, h := range hs {
+		enc.AddString(h.name, h.value)
+	}
+	return nil
+}
+
+// RequestHeaders returns a zap.Field that adds the allowlisted headers
+// as a nested "headers" object to the payload.
+// Headers not present in h are omitted, multiple values are joined with ", ".
+// The values of sensitive headers, such as Authorization and Cookie, are redacted
+// even if they are allowlisted.
+//
+// Parameters:
+// - h: The headers to log.
+// - allow: The names of the headers to log.
+//
+// Returns:
+// - A zap.Field that adds the allowlisted headers to the payload.
+func RequestHeaders(h http.Header, allow []string) zap.Field {
+	hs := make(headers, 0, len(allow))
+	for _, name := range allow {
+		name = http.CanonicalHeaderKey(name)
+		values := h.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		value := strings.Join(values, ", ")
+		if sensitiveHeaders[name] {
+			value = redacted
+		}
+		hs = append(hs, header{name: name, value: value})
+	}
+
+	return zap.Object("headers", hs)
+}
+
+// NewHTTPRequest builds a logging.HTTPRequest from the given request and response metadata.
+// The method, URL, user agent, referer and protocol are taken from r. The remote IP is
+// taken from the first address of the X-Forwarded-For header, falling back to r.RemoteAddr,
+// and the local IP from the address of the server that accepted the request, if known.
+//
+// Parameters:
+// - r: The HTTP request.
+// - status: The status code of the response.
+// - responseSize: The size of the response in bytes.
+// - latency: The time it took to serve the request.
+//
+// Returns:
+// - The HTTP request for the entry.
+func NewHTTPRequest(r *http.Request, status int, responseSize int64, latency time.Duration) *logging.HTTPRequest {
+	request := &logging.HTTPRequest{
+		Request:      r,
+		Status:       status,
+		ResponseSize: responseSize,
+		Latency:      latency,
+		RemoteIP:     remoteIP(r),
+	}
+	if r.ContentLength > 0 {
+		request.RequestSize = r.ContentLength
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		request.LocalIP = hostOnly(addr.String())
+	}
+
+	return request
+}
+
+// remoteIP returns the IP address of the client that sent the given request.
+//
+// Parameters:
+// - r: The HTTP request.
+//
+// Returns:
+// - The IP address of the client, or an empty string if it is unknown.
+func remoteIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		if ip := strings.TrimSpace(first); ip != "" {
+			return ip
+		}
+	}
+
+	return hostOnly(r.RemoteAddr)
+}
+
+// hostOnly strips the port from the given address, if any.
+//
+// Parameters:
+// - addr: The address, e.g. "192.0.2.1:1234".
+//
+// Returns:
+// - The host of the address.
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// responseMeta is a zapcore.ObjectMarshaler for the metadata of a response.
+type responseMeta struct {
+	status      int
+	size        int64
+	contentType string
+}
+
+// MarshalLogObject adds the response metadata to the given encoder.
+// The content type is omitted if it is empty.
+//
+// Parameters:
+// - enc: The encoder to add the response metadata to.
+//
+// Returns:
+// - Always nil.
+func (r responseMeta) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("status", r.status)
+	enc.AddInt64("bytes", r.size)
+	if r.contentType != "" {
+		enc.AddString("content_type", r.contentType)
+	}
+	return nil
+}
+
+// ResponseMeta returns a zap.Field that describes the body of a response
+// as a nested "response" object with the keys "status", "bytes" and "content_type".
+// It complements the HTTPRequest field, which does not capture the content type.
+//
+// Parameters:
+// - status: The status code of the response.
+// - size: The size of the response body in bytes.
+// - contentType: The content type of the response body, may be empty.
+//
+// Returns:
+// - A zap.Field that describes the response.
+func ResponseMeta(status int, size int64, contentType string) zap.Field {
+	return zap.Object("response", responseMeta{status: status, size: size, contentType: contentType})
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// encodeField encodes the given field with a map encoder.
+//
+// Parameters:
+// - f: The field to encode.
+//
+// Returns:
+// - The encoded fields.
+func encodeField(f zap.Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+	return enc.Fields
+}
+
+func TestRequestHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Add("Accept", "text/html")
+	h.Add("Accept", "application/json")
+	h.Set("Authorization", "Bearer secret")
+	h.Set("Cookie", "session=secret")
+	h.Set("X-Request-Id", "abc")
+
+	tests := []struct {
+		name  string
+		allow []string
+		want  map[string]interface{}
+	}{
+		{
+			name:  "only allowlisted headers",
+			allow: []string{"Content-Type", "X-Request-Id"},
+			want:  map[string]interface{}{"Content-Type": "application/json", "X-Request-Id": "abc"},
+		},
+		{
+			name:  "names are canonicalized",
+			allow: []string{"content-type"},
+			want:  map[string]interface{}{"Content-Type": "application/json"},
+		},
+		{
+			name:  "multiple values are joined",
+			allow: []string{"Accept"},
+			want:  map[string]interface{}{"Accept": "text/html, application/json"},
+		},
+		{
+			name:  "sensitive headers are redacted",
+			allow: []string{"Authorization", "cookie"},
+			want:  map[string]interface{}{"Authorization": redacted, "Cookie": redacted},
+		},
+		{
+			name:  "missing headers are omitted",
+			allow: []string{"X-Missing"},
+			want:  map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodeField(RequestHeaders(h, tt.allow))["headers"]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("headers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHTTPRequest(t *testing.T) {
+	newRequest := func(remoteAddr string, header http.Header, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "https://example.com/orders?id=1", strings.NewReader(body))
+		r.RemoteAddr = remoteAddr
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		return r
+	}
+
+	tests := []struct {
+		name        string
+		request     *http.Request
+		wantRemote  string
+		wantLocal   string
+		wantReqSize int64
+	}{
+		{
+			name:        "remote address",
+			request:     newRequest("192.0.2.1:1234", nil, `{"item":1}`),
+			wantRemote:  "192.0.2.1",
+			wantReqSize: 10,
+		},
+		{
+			name:       "forwarded for",
+			request:    newRequest("10.0.0.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.7, 10.0.0.1"}}, ""),
+			wantRemote: "203.0.113.7",
+		},
+		{
+			name: "local address",
+			request: newRequest("192.0.2.1:1234", nil, "").WithContext(context.WithValue(context.Background(),
+				http.LocalAddrContextKey, &net.TCPAddr{IP: net.ParseIP("198.51.100.2"), Port: 8080})),
+			wantRemote: "192.0.2.1",
+			wantLocal:  "198.51.100.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.request.Header.Set("User-Agent", "test-agent")
+			tt.request.Header.Set("Referer", "https://example.com/cart")
+
+			got := NewHTTPRequest(tt.request, http.StatusCreated, 512, 1500*time.Millisecond)
+			want := &logging.HTTPRequest{
+				Request:      tt.request,
+				Status:       http.StatusCreated,
+				ResponseSize: 512,
+				Latency:      1500 * time.Millisecond,
+				RemoteIP:     tt.wantRemote,
+				LocalIP:      tt.wantLocal,
+				RequestSize:  tt.wantReqSize,
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("NewHTTPRequest() = %+v, want %+v", got, want)
+			}
+
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "served"}, []zapcore.Field{HTTPRequest(got)}); err != nil {
+				t.Fatal(err)
+			}
+			entry := out.Entries()[0]
+			if entry.HTTPRequest != got {
+				t.Errorf("entry HTTP request = %+v, want %+v", entry.HTTPRequest, got)
+			}
+			if _, ok := payloadOf(t, entry)["httpRequest"]; ok {
+				t.Error("httpRequest field written to the payload")
+			}
+		})
+	}
+}
+
+func TestResponseMeta(t *testing.T) {
+	tests := []struct {
+		name  string
+		field zapcore.Field
+		want  map[string]interface{}
+	}{
+		{
+			name:  "json response",
+			field: ResponseMeta(http.StatusOK, 512, "application/json"),
+			want:  map[string]interface{}{"status": float64(200), "bytes": float64(512), "content_type": "application/json"},
+		},
+		{
+			name:  "empty content type omitted",
+			field: ResponseMeta(http.StatusNoContent, 0, ""),
+			want:  map[string]interface{}{"status": float64(204), "bytes": float64(0)},
+		},
+		{
+			name:  "large body",
+			field: ResponseMeta(http.StatusOK, 1<<40, "application/octet-stream"),
+			want:  map[string]interface{}{"status": float64(200), "bytes": float64(1 << 40), "content_type": "application/octet-stream"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/orders", nil)
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			fields := []zapcore.Field{HTTPRequest(&logging.HTTPRequest{Request: req, Status: 200}), tt.field}
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "served"}, fields); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if got := payloadOf(t, entry)["response"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("response = %#v, want %#v", got, tt.want)
+			}
+			// The HTTP request is still set on the entry itself.
+			if entry.HTTPRequest == nil || entry.HTTPRequest.Request != req {
+				t.Errorf("HTTPRequest = %v, want the request", entry.HTTPRequest)
+			}
+		})
+	}
+}
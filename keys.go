@@ -0,0 +1,86 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"strings"
+	"unicode"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// SnakeCaseKeys converts the given key to snake_case, e.g. "userID" to "user_id"
+// and "HTTPStatus" to "http_status". Hyphens, dots and spaces are replaced by underscores.
+// It is meant to be used as Config.KeyNormalizer.
+//
+// Parameters:
+// - key: The key to convert.
+//
+// Returns:
+// - The key in snake_case.
+func SnakeCaseKeys(key string) string {
+	runes := []rune(key)
+	var b strings.Builder
+	b.Grow(len(key) + 4)
+	for i, r := range runes {
+		switch {
+		case r == '-' || r == '.' || r == ' ':
+			b.WriteByte('_')
+		case unicode.IsUpper(r):
+			if i > 0 {
+				prev := runes[i-1]
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+					b.WriteByte('_')
+				}
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// normalizeKeys applies the given normalizer to the keys of the given fields.
+// Nested keys are left untouched. The given slice is not modified.
+//
+// Parameters:
+// - normalize: The key normalizer, may be nil.
+// - fields: The fields to normalize.
+//
+// Returns:
+// - The normalized fields.
+func normalizeKeys(normalize func(string) string, fields []zapcore.Field) []zapcore.Field {
+	if normalize == nil || len(fields) == 0 {
+		return fields
+	}
+
+	normalized := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		f.Key = normalize(f.Key)
+		normalized[i] = f
+	}
+
+	return normalized
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSnakeCaseKeys(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "", want: ""},
+		{key: "user", want: "user"},
+		{key: "already_snake", want: "already_snake"},
+		{key: "userID", want: "user_id"},
+		{key: "requestCount", want: "request_count"},
+		{key: "HTTPStatus", want: "http_status"},
+		{key: "statusCode2xx", want: "status_code2xx"},
+		{key: "v2Api", want: "v2_api"},
+		{key: "kebab-case.dotted key", want: "kebab_case_dotted_key"},
+		{key: "ÄrgerWert", want: "ärger_wert"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := SnakeCaseKeys(tt.key); got != tt.want {
+				t.Errorf("SnakeCaseKeys(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyNormalizer(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalizer func(string) string
+		want       []string
+		absent     []string
+	}{
+		{name: "identity by default", want: []string{"requestID", "userName"}, absent: []string{"request_id", "user_name"}},
+		{name: "snake case", normalizer: SnakeCaseKeys, want: []string{"request_id", "user_name"}, absent: []string{"requestID", "userName"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			config := Config{EncoderConfig: DefaultEncoderConfig(), KeyNormalizer: tt.normalizer}
+			core := newCore(out, config).With([]zapcore.Field{zap.String("requestID", "r-1")})
+			fields := []zapcore.Field{zap.Object("userName", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+				enc.AddString("firstName", "Ada")
+				return nil
+			}))}
+			if err := core.Write(zapcore.Entry{Level: zapcore.WarnLevel, Time: time.Now(), Message: "hello"}, fields); err != nil {
+				t.Fatal(err)
+			}
+
+			payload := payloadOf(t, out.Entries()[0])
+			for _, k := range tt.want {
+				if _, ok := payload[k]; !ok {
+					t.Errorf("key %q missing from %v", k, payload)
+				}
+			}
+			for _, k := range tt.absent {
+				if _, ok := payload[k]; ok {
+					t.Errorf("unexpected key %q in %v", k, payload)
+				}
+			}
+			for _, k := range []string{"message", "severity", "time"} {
+				if _, ok := payload[k]; !ok {
+					t.Errorf("encoder key %q missing from %v", k, payload)
+				}
+			}
+			for _, user := range []interface{}{payload["userName"], payload["user_name"]} {
+				if nested, ok := user.(map[string]interface{}); ok && nested["firstName"] != "Ada" {
+					t.Errorf("nested keys = %v, want them untouched", nested)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultMaxLabels is the default maximum number of labels per entry.
+const DefaultMaxLabels = 64
+
+// DefaultDynamicLabelsTTL is the default time the labels of Config.DynamicLabels are cached.
+const DefaultDynamicLabelsTTL = 5 * time.Second
+
+// hostLabels returns labels describing the current process and host.
+// The hostname label is omitted if the hostname cannot be determined.
+//
+// Returns:
+// - The labels describing the current process and host.
+func hostLabels() map[string]string {
+	labels := map[string]string{
+		"pid": strconv.Itoa(os.Getpid()),
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		labels["hostname"] = hostname
+	}
+
+	return labels
+}
+
+// deployLabelKey is the key of the label holding the deployment identifier.
+const deployLabelKey = "deploy_sha"
+
+// deployLabels returns a label holding the deployment identifier, e.g. a commit SHA,
+// read from the given environment variable.
+//
+// Parameters:
+// - env: The name of the environment variable.
+//
+// Returns:
+// - The deployment label, or nil if the environment variable is unset or empty.
+func deployLabels(env string) map[string]string {
+	sha := os.Getenv(env)
+	if sha == "" {
+		return nil
+	}
+
+	return map[string]string{deployLabelKey: sha}
+}
+
+// fieldLabels returns the given fields as labels.
+// Fields with non-string values are stringified, or dropped if dropNonString is set.
+//
+// Parameters:
+// - fields: The fields to convert.
+// - dropNonString: Whether to drop fields with non-string values.
+//
+// Returns:
+// - The fields as labels, or nil if there are none.
+func fieldLabels(fields []zapcore.Field, dropNonString bool) map[string]string {
+	var labels map[string]string
+	for _, f := range fields {
+		if f.Type != zapcore.StringType && dropNonString {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string, len(fields))
+		}
+		labels[f.Key] = fieldString(f)
+	}
+
+	return labels
+}
+
+// mergeLabels merges the given label sets into a new map.
+// Labels in later sets take precedence over labels in earlier sets.
+//
+// Parameters:
+// - sets: The label sets to merge.
+//
+// Returns:
+// - The merged labels, or nil if there are none.
+func mergeLabels(sets ...map[string]string) map[string]string {
+	var merged map[string]string
+	for _, set := range sets {
+		for k, v := range set {
+			if merged == nil {
+				merged = make(map[string]string)
+			}
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
+
+// prefixLabels returns a copy of the given labels with the given prefix
+// prepended to every key.
+//
+// Parameters:
+// - prefix: The prefix to prepend.
+// - labels: The labels to prefix.
+//
+// Returns:
+// - The prefixed labels.
+func prefixLabels(prefix string, labels map[string]string) map[string]string {
+	if prefix == "" || len(labels) == 0 {
+		return labels
+	}
+
+	prefixed := make(map[string]string, len(labels))
+	for k, v := range labels {
+		prefixed[prefix+k] = v
+	}
+
+	return prefixed
+}
+
+// capLabels removes labels from the given map until at most limit labels remain.
+// The labels with the lexicographically smallest keys are kept.
+//
+// Parameters:
+// - labels: The labels to cap, modified in place.
+// - limit: The maximum number of labels to keep.
+//
+// Returns:
+// - The number of labels removed.
+func capLabels(labels map[string]string, limit int) int {
+	if limit < 0 {
+		limit = 0
+	}
+	if len(labels) <= limit {
+		return 0
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys[limit:] {
+		delete(labels, k)
+	}
+
+	return len(keys) - limit
+}
+
+// labelCache caches the labels of a source for a fixed time.
+type labelCache struct {
+	source func() map[string]string
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	labels  map[string]string
+	expires time.Time
+}
+
+// newLabelCache creates a new labelCache for the given source.
+//
+// Parameters:
+// - source: The source of the labels.
+// - ttl: The time the labels are cached, DefaultDynamicLabelsTTL if zero.
+//
+// Returns:
+// - A new labelCache.
+func newLabelCache(source func() map[string]string, ttl time.Duration) *labelCache {
+	if ttl <= 0 {
+		ttl = DefaultDynamicLabelsTTL
+	}
+
+	return &labelCache{source: source, ttl: ttl}
+}
+
+// get returns the cached labels, refreshing them from the source if they have expired.
+// The returned map must not be modified.
+//
+// Parameters:
+// - now: The current time.
+//
+// Returns:
+// - The labels.
+func (c *labelCache) get(now time.Time) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expires.IsZero() || !now.Before(c.expires) {
+		c.labels = mergeLabels(c.source())
+		c.expires = now.Add(c.ttl)
+	}
+
+	return c.labels
+}
+
+// liftResourceLabels returns a copy of the given resource with the values of the named fields
+// added to its labels. Later fields take precedence. The resource is returned unchanged
+// if none of the named fields are present.
+//
+// Parameters:
+// - resource: The monitored resource.
+// - keys: The keys of the fields to lift.
+// - sets: The field sets to search, in order of increasing precedence.
+//
+// Returns:
+// - The resource with the lifted labels.
+func liftResourceLabels(resource *mrpb.MonitoredResource, keys []string, sets ...[]zapcore.Field) *mrpb.MonitoredResource {
+	var lifted map[string]string
+	for _, fields := range sets {
+		for _, f := range fields {
+			for _, key := range keys {
+				if f.Key != key {
+					continue
+				}
+				if lifted == nil {
+					lifted = make(map[string]string, len(keys))
+				}
+				lifted[key] = fieldString(f)
+			}
+		}
+	}
+	if lifted == nil {
+		return resource
+	}
+
+	clone := proto.Clone(resource).(*mrpb.MonitoredResource)
+	clone.Labels = mergeLabels(clone.Labels, lifted)
+
+	return clone
+}
@@ -0,0 +1,687 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestIncludeHostInfo(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("hostname unavailable: %v", err)
+	}
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		name   string
+		config Config
+		fields []zapcore.Field
+		want   map[string]string
+	}{
+		{
+			name:   "disabled",
+			config: Config{},
+			want:   map[string]string{},
+		},
+		{
+			name:   "enabled",
+			config: Config{IncludeHostInfo: true},
+			want:   map[string]string{"pid": pid, "hostname": hostname},
+		},
+		{
+			name:   "merged with entry labels",
+			config: Config{IncludeHostInfo: true},
+			fields: []zapcore.Field{Label("team", "core")},
+			want:   map[string]string{"pid": pid, "hostname": hostname, "team": "core"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, tt.config)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			labels := out.Entries()[0].Labels
+			if len(labels) != len(tt.want) {
+				t.Errorf("labels = %v, want %v", labels, tt.want)
+			}
+			for k, v := range tt.want {
+				if labels[k] != v {
+					t.Errorf("label %q = %q, want %q", k, labels[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestLabelPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		fields []zapcore.Field
+		env    string
+		userID bool
+		want   map[string]string
+	}{
+		{
+			name:   "no prefix",
+			fields: []zapcore.Field{Label("team", "core")},
+			want:   map[string]string{"team": "core"},
+		},
+		{
+			name:   "user labels are prefixed",
+			prefix: "app.",
+			fields: []zapcore.Field{Label("team", "core"), Label("tier", "gold")},
+			want:   map[string]string{"app.team": "core", "app.tier": "gold"},
+		},
+		{
+			name:   "package labels are not prefixed",
+			prefix: "app.",
+			fields: []zapcore.Field{Label("team", "core")},
+			env:    "abc123",
+			want:   map[string]string{"app.team": "core", "deploy_sha": "abc123"},
+		},
+		{
+			name:   "user id label is not prefixed",
+			prefix: "app.",
+			fields: []zapcore.Field{Label("team", "core"), User("u-42", nil)},
+			userID: true,
+			want:   map[string]string{"app.team": "core", "user_id": "u-42"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GCLZAP_TEST_SHA", tt.env)
+			out := &fakeSink{}
+			core := newCore(out, Config{LabelPrefix: tt.prefix, DeployLabelEnv: "GCLZAP_TEST_SHA", UserIDLabel: tt.userID})
+			fields := append(tt.fields[:len(tt.fields):len(tt.fields)], Trace("projects/p/traces/abc"))
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, fields); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if entry.Trace != "projects/p/traces/abc" {
+				t.Errorf("trace = %q, want it to be unprefixed", entry.Trace)
+			}
+			if len(entry.Labels) != len(tt.want) {
+				t.Errorf("labels = %v, want %v", entry.Labels, tt.want)
+			}
+			for k, v := range tt.want {
+				if entry.Labels[k] != v {
+					t.Errorf("label %q = %q, want %q", k, entry.Labels[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestDeployLabelEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		envVar string
+		value  string
+		set    bool
+		want   map[string]string
+	}{
+		{name: "not configured", value: "abc123", set: true},
+		{name: "set", envVar: "GCLZAP_TEST_SHA", value: "abc123", set: true, want: map[string]string{"deploy_sha": "abc123"}},
+		{name: "empty", envVar: "GCLZAP_TEST_SHA", value: "", set: true},
+		{name: "unset", envVar: "GCLZAP_TEST_UNSET_SHA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.set {
+				t.Setenv("GCLZAP_TEST_SHA", tt.value)
+			}
+			out := &fakeSink{}
+			core := newCore(out, Config{DeployLabelEnv: tt.envVar})
+
+			// The variable is read once, when the Core is created.
+			t.Setenv("GCLZAP_TEST_SHA", "changed")
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			got := out.Entries()[0].Labels
+			if len(got) != len(tt.want) {
+				t.Errorf("labels = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("label %q = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxLabels(t *testing.T) {
+	labels := func(n int) []zapcore.Field {
+		fields := make([]zapcore.Field, n)
+		for i := range fields {
+			fields[i] = Label("k"+strconv.Itoa(i), "v")
+		}
+		return fields
+	}
+
+	tests := []struct {
+		name       string
+		max        int
+		env        string
+		fields     []zapcore.Field
+		wantLabels []string
+		wantErrors int
+	}{
+		{name: "unlimited", fields: labels(5), wantLabels: []string{"k0", "k1", "k2", "k3", "k4"}},
+		{name: "below the cap", max: 8, fields: labels(5), wantLabels: []string{"k0", "k1", "k2", "k3", "k4"}},
+		{name: "above the cap", max: 3, fields: labels(5), wantLabels: []string{"k0", "k1", "k2"}, wantErrors: 1},
+		{
+			name:       "package labels are kept",
+			max:        3,
+			env:        "abc123",
+			fields:     labels(5),
+			wantLabels: []string{"deploy_sha", "k0", "k1"},
+			wantErrors: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GCLZAP_TEST_SHA", tt.env)
+			var errs []error
+			out := &fakeSink{}
+			core := newCore(out, Config{
+				MaxLabels:      tt.max,
+				DeployLabelEnv: "GCLZAP_TEST_SHA",
+				OnError:        func(err error) { errs = append(errs, err) },
+			})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			got := out.Entries()[0].Labels
+			if len(got) != len(tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", got, tt.wantLabels)
+			}
+			for _, k := range tt.wantLabels {
+				if _, ok := got[k]; !ok {
+					t.Errorf("label %q missing from %v", k, got)
+				}
+			}
+			if len(errs) != tt.wantErrors {
+				t.Errorf("got %d errors, want %d: %v", len(errs), tt.wantErrors, errs)
+			}
+		})
+	}
+}
+
+func TestMDC(t *testing.T) {
+	tests := []struct {
+		name   string
+		mdc    func() map[string]string
+		fields []zapcore.Field
+		want   map[string]string
+	}{
+		{name: "no MDC", fields: []zapcore.Field{Label("user_id", "42")}, want: map[string]string{"user_id": "42"}},
+		{
+			name: "ambient labels",
+			mdc:  func() map[string]string { return map[string]string{"trace_tenant": "acme"} },
+			want: map[string]string{"trace_tenant": "acme"},
+		},
+		{
+			name:   "merged with entry labels",
+			mdc:    func() map[string]string { return map[string]string{"trace_tenant": "acme"} },
+			fields: []zapcore.Field{Label("user_id", "42")},
+			want:   map[string]string{"trace_tenant": "acme", "user_id": "42"},
+		},
+		{
+			name:   "entry labels take precedence",
+			mdc:    func() map[string]string { return map[string]string{"user_id": "ambient"} },
+			fields: []zapcore.Field{Label("user_id", "42")},
+			want:   map[string]string{"user_id": "42"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{MDC: tt.mdc})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			got := out.Entries()[0].Labels
+			if len(got) != len(tt.want) {
+				t.Errorf("labels = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("label %q = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestFieldsAsLabels(t *testing.T) {
+	tests := []struct {
+		name          string
+		dropNonString bool
+		with          []zapcore.Field
+		fields        []zapcore.Field
+		want          map[string]string
+	}{
+		{name: "no fields"},
+		{
+			name:   "string fields",
+			with:   []zapcore.Field{zap.String("service", "orders")},
+			fields: []zapcore.Field{zap.String("user", "alice")},
+			want:   map[string]string{"service": "orders", "user": "alice"},
+		},
+		{
+			name:   "non-string fields are stringified",
+			fields: []zapcore.Field{zap.Int("count", 3), zap.Bool("cached", true), zap.String("user", "alice")},
+			want:   map[string]string{"count": "3", "cached": "true", "user": "alice"},
+		},
+		{
+			name:          "non-string fields are dropped",
+			dropNonString: true,
+			fields:        []zapcore.Field{zap.Int("count", 3), zap.String("user", "alice")},
+			want:          map[string]string{"user": "alice"},
+		},
+		{
+			name:   "explicit labels take precedence",
+			fields: []zapcore.Field{zap.String("user", "promoted"), Label("user", "explicit")},
+			want:   map[string]string{"user": "explicit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{FieldsAsLabels: true, DropNonStringLabels: tt.dropNonString}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "order placed"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if entry.Payload != "order placed" {
+				t.Errorf("payload = %#v, want the message as text payload", entry.Payload)
+			}
+			if len(entry.Labels) != len(tt.want) {
+				t.Errorf("labels = %v, want %v", entry.Labels, tt.want)
+			}
+			for k, v := range tt.want {
+				if entry.Labels[k] != v {
+					t.Errorf("label %q = %q, want %q", k, entry.Labels[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestBaggageLabels(t *testing.T) {
+	member := func(key, value string) baggage.Member {
+		m, err := baggage.NewMember(key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	bag, err := baggage.New(member("tenant", "acme"), member("region", "eu"), member("secret", "s3cr3t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+
+	tests := []struct {
+		name  string
+		names []string
+		ctx   context.Context
+		want  map[string]string
+	}{
+		{name: "not configured", ctx: ctx},
+		{name: "selected members", names: []string{"tenant", "region"}, ctx: ctx, want: map[string]string{"tenant": "acme", "region": "eu"}},
+		{name: "missing members are skipped", names: []string{"tenant", "missing"}, ctx: ctx, want: map[string]string{"tenant": "acme"}},
+		{name: "no baggage", names: []string{"tenant"}, ctx: context.Background()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{BaggageLabels: tt.names})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, []zapcore.Field{Context(tt.ctx)}); err != nil {
+				t.Fatal(err)
+			}
+
+			got := out.Entries()[0].Labels
+			if len(got) != len(tt.want) {
+				t.Errorf("labels = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("label %q = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+// manualClock is a clock that only advances when told to.
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Now returns the current time of the clock.
+//
+// Returns:
+// - The current time of the clock.
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker returns a ticker of the system clock.
+//
+// Parameters:
+// - d: The interval of the ticker.
+//
+// Returns:
+// - A new ticker.
+func (*manualClock) NewTicker(d time.Duration) *time.Ticker {
+	return time.NewTicker(d)
+}
+
+// advance advances the clock by the given duration.
+//
+// Parameters:
+// - d: The duration to advance the clock by.
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestDynamicLabels(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		advance   time.Duration
+		fields    []zapcore.Field
+		wantColor string
+		wantCalls int
+	}{
+		{name: "cached within the TTL", ttl: time.Minute, advance: 30 * time.Second, wantColor: "blue", wantCalls: 1},
+		{name: "refreshed after the TTL", ttl: time.Minute, advance: time.Minute, wantColor: "green", wantCalls: 2},
+		{name: "default TTL", advance: DefaultDynamicLabelsTTL - time.Millisecond, wantColor: "blue", wantCalls: 1},
+		{name: "refreshed after the default TTL", advance: DefaultDynamicLabelsTTL, wantColor: "green", wantCalls: 2},
+		{
+			name:      "entry labels take precedence",
+			ttl:       time.Minute,
+			advance:   time.Minute,
+			fields:    []zapcore.Field{Label("deployment_color", "canary")},
+			wantColor: "canary",
+			wantCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			color := "blue"
+			calls := 0
+			source := func() map[string]string {
+				calls++
+				return map[string]string{"deployment_color": color}
+			}
+			clock := &manualClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+			out := &fakeSink{}
+			core := newCore(out, Config{Clock: clock, DynamicLabels: source, DynamicLabelsTTL: tt.ttl})
+
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "first"}, nil); err != nil {
+				t.Fatal(err)
+			}
+			color = "green"
+			clock.advance(tt.advance)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "second"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			entries := out.Entries()
+			if got := entries[0].Labels["deployment_color"]; got != "blue" {
+				t.Errorf("first deployment_color = %q, want %q", got, "blue")
+			}
+			if got := entries[1].Labels["deployment_color"]; got != tt.wantColor {
+				t.Errorf("second deployment_color = %q, want %q", got, tt.wantColor)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("source called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestResourceLabelFields(t *testing.T) {
+	configured := &mrpb.MonitoredResource{Type: "k8s_container", Labels: map[string]string{"cluster_name": "prod"}}
+
+	tests := []struct {
+		name     string
+		keys     []string
+		resource *mrpb.MonitoredResource
+		with     []zapcore.Field
+		fields   []zapcore.Field
+		want     *mrpb.MonitoredResource
+	}{
+		{
+			name:     "lifted from entry field",
+			keys:     []string{"tenant"},
+			resource: configured,
+			fields:   []zapcore.Field{zap.String("tenant", "acme")},
+			want:     &mrpb.MonitoredResource{Type: "k8s_container", Labels: map[string]string{"cluster_name": "prod", "tenant": "acme"}},
+		},
+		{
+			name:     "lifted from With field",
+			keys:     []string{"tenant"},
+			resource: configured,
+			with:     []zapcore.Field{zap.String("tenant", "acme")},
+			want:     &mrpb.MonitoredResource{Type: "k8s_container", Labels: map[string]string{"cluster_name": "prod", "tenant": "acme"}},
+		},
+		{
+			name:     "entry field takes precedence",
+			keys:     []string{"tenant"},
+			resource: configured,
+			with:     []zapcore.Field{zap.String("tenant", "acme")},
+			fields:   []zapcore.Field{zap.String("tenant", "globex")},
+			want:     &mrpb.MonitoredResource{Type: "k8s_container", Labels: map[string]string{"cluster_name": "prod", "tenant": "globex"}},
+		},
+		{
+			name:     "non-string value",
+			keys:     []string{"shard"},
+			resource: configured,
+			fields:   []zapcore.Field{zap.Int("shard", 7)},
+			want:     &mrpb.MonitoredResource{Type: "k8s_container", Labels: map[string]string{"cluster_name": "prod", "shard": "7"}},
+		},
+		{
+			name:     "field absent",
+			keys:     []string{"tenant"},
+			resource: configured,
+			want:     configured,
+		},
+		{
+			name:   "resource of the entry",
+			keys:   []string{"tenant"},
+			fields: []zapcore.Field{Resource(&mrpb.MonitoredResource{Type: "global"}), zap.String("tenant", "acme")},
+			want:   &mrpb.MonitoredResource{Type: "global", Labels: map[string]string{"tenant": "acme"}},
+		},
+		{
+			name:   "no resource",
+			keys:   []string{"tenant"},
+			fields: []zapcore.Field{zap.String("tenant", "acme")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{Resource: tt.resource, ResourceLabelFields: tt.keys}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if !proto.Equal(entry.Resource, tt.want) {
+				t.Errorf("resource = %v, want %v", entry.Resource, tt.want)
+			}
+			if len(configured.Labels) != 1 {
+				t.Fatalf("configured resource modified: %v", configured)
+			}
+			// The fields are kept in the payload.
+			for _, f := range append(tt.with, tt.fields...) {
+				if _, ok := payloadOf(t, entry)[f.Key]; !ok && f.Key != "resource" {
+					t.Errorf("field %q missing from the payload", f.Key)
+				}
+			}
+		})
+	}
+}
+
+func TestNameAsLabel(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		names  []string
+		with   []zapcore.Field
+		fields []zapcore.Field
+		want   map[string]string
+	}{
+		{name: "named logger", key: "component", names: []string{"payments"}, want: map[string]string{"component": "payments"}},
+		{name: "nested names", key: "component", names: []string{"payments", "refunds"}, want: map[string]string{"component": "payments.refunds"}},
+		{name: "unnamed logger", key: "component"},
+		{name: "disabled", names: []string{"payments"}},
+		{
+			name:   "entry label takes precedence",
+			key:    "component",
+			names:  []string{"payments"},
+			fields: []zapcore.Field{Label("component", "billing")},
+			want:   map[string]string{"component": "billing"},
+		},
+		{
+			name:  "With label takes precedence",
+			key:   "component",
+			names: []string{"payments"},
+			with:  []zapcore.Field{Label("component", "billing")},
+			want:  map[string]string{"component": "billing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			logger := zap.New(newCore(out, Config{NameAsLabel: tt.key})).With(tt.with...)
+			for _, name := range tt.names {
+				logger = logger.Named(name)
+			}
+			logger.Info("hello", tt.fields...)
+
+			got := out.Entries()[0].Labels
+			if len(got) != len(tt.want) {
+				t.Errorf("labels = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("label %q = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestWithLabels(t *testing.T) {
+	tests := []struct {
+		name       string
+		parent     []zapcore.Field
+		labels     map[string]string
+		fields     []zapcore.Field
+		wantChild  map[string]string
+		wantParent map[string]string
+	}{
+		{
+			name:      "child labels",
+			labels:    map[string]string{"tenant": "acme", "region": "eu"},
+			wantChild: map[string]string{"tenant": "acme", "region": "eu"},
+		},
+		{
+			name:       "parent labels inherited",
+			parent:     []zapcore.Field{Label("service", "orders")},
+			labels:     map[string]string{"tenant": "acme"},
+			wantChild:  map[string]string{"service": "orders", "tenant": "acme"},
+			wantParent: map[string]string{"service": "orders"},
+		},
+		{
+			name:      "entry labels take precedence",
+			labels:    map[string]string{"tenant": "acme"},
+			fields:    []zapcore.Field{Label("tenant", "globex")},
+			wantChild: map[string]string{"tenant": "globex"},
+		},
+		{name: "no labels"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			parent := zap.New(newCore(out, Config{})).With(tt.parent...)
+			child := WithLabels(parent, tt.labels)
+			child.Info("child", tt.fields...)
+			parent.Info("parent")
+
+			for i, want := range []map[string]string{tt.wantChild, tt.wantParent} {
+				got := out.Entries()[i].Labels
+				if len(got) != len(want) {
+					t.Errorf("entry %d labels = %v, want %v", i, got, want)
+				}
+				for k, v := range want {
+					if got[k] != v {
+						t.Errorf("entry %d label %q = %q, want %q", i, k, got[k], v)
+					}
+				}
+			}
+		})
+	}
+}
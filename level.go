@@ -0,0 +1,97 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// LevelWindow raises the minimum enabled level during a daily time window.
+// Start and End are offsets from midnight in the time zone of the clock.
+// If End is before Start, the window spans midnight.
+type LevelWindow struct {
+	Start time.Duration
+	End   time.Duration
+	Level zapcore.Level
+}
+
+// contains returns whether the given offset from midnight lies within the window.
+//
+// Parameters:
+// - offset: The offset from midnight.
+//
+// Returns:
+// - Whether the offset lies within the window.
+func (w LevelWindow) contains(offset time.Duration) bool {
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// scheduledLevel is a zapcore.LevelEnabler that raises the level
+// of a base enabler during the windows of a schedule.
+type scheduledLevel struct {
+	base     zapcore.LevelEnabler
+	schedule []LevelWindow
+	now      func() time.Time
+}
+
+// Enabled returns whether the given level is enabled by the base enabler
+// and by all windows of the schedule active at the current time.
+//
+// Parameters:
+// - lvl: The level to check.
+//
+// Returns:
+// - Whether the given level is enabled.
+func (s scheduledLevel) Enabled(lvl zapcore.Level) bool {
+	if !s.base.Enabled(lvl) {
+		return false
+	}
+
+	offset := wallClock(s.now())
+	for _, w := range s.schedule {
+		if w.contains(offset) && lvl < w.Level {
+			return false
+		}
+	}
+	return true
+}
+
+// wallClock returns the wall clock time of day of the given time as an offset from midnight.
+// Unlike the time elapsed since midnight, it is not affected by daylight saving time transitions.
+//
+// Parameters:
+// - t: The time.
+//
+// Returns:
+// - The wall clock time of day.
+func wallClock(t time.Time) time.Duration {
+	hour, min, sec := t.Clock()
+	return time.Duration(hour)*time.Hour +
+		time.Duration(min)*time.Minute +
+		time.Duration(sec)*time.Second +
+		time.Duration(t.Nanosecond())
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLevelSchedule(t *testing.T) {
+	schedule := []LevelWindow{
+		// Quiet hours spanning midnight.
+		{Start: 22 * time.Hour, End: 6 * time.Hour, Level: zapcore.WarnLevel},
+		// Maintenance window.
+		{Start: 12 * time.Hour, End: 13 * time.Hour, Level: zapcore.ErrorLevel},
+	}
+	at := func(hour, min int) time.Time {
+		return time.Date(2024, 5, 1, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		now   time.Time
+		level zapcore.Level
+		want  bool
+	}{
+		{name: "info during the day", now: at(9, 0), level: zapcore.InfoLevel, want: true},
+		{name: "debug below the base level", now: at(9, 0), level: zapcore.DebugLevel, want: false},
+		{name: "info during quiet hours", now: at(23, 0), level: zapcore.InfoLevel, want: false},
+		{name: "warning during quiet hours", now: at(23, 0), level: zapcore.WarnLevel, want: true},
+		{name: "info after midnight", now: at(5, 59), level: zapcore.InfoLevel, want: false},
+		{name: "info at the end of quiet hours", now: at(6, 0), level: zapcore.InfoLevel, want: true},
+		{name: "warning during maintenance", now: at(12, 30), level: zapcore.WarnLevel, want: false},
+		{name: "error during maintenance", now: at(12, 30), level: zapcore.ErrorLevel, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core := newCore(&fakeSink{}, Config{
+				Level:         zapcore.InfoLevel,
+				LevelSchedule: schedule,
+				Clock:         fixedClock{now: tt.now},
+			})
+			if got := core.Enabled(tt.level); got != tt.want {
+				t.Errorf("Enabled(%v) at %v = %v, want %v", tt.level, tt.now.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
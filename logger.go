@@ -22,23 +22,102 @@
 package gclzap
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
 	"cloud.google.com/go/logging"
 	"go.uber.org/zap"
+	"google.golang.org/api/option"
 )
 
+// DefaultLogName is the name of the log written to if Config.LogName is empty.
+const DefaultLogName = "default"
+
+// maxLogNameLength is the maximum length of a log name accepted by Google Cloud Logging.
+const maxLogNameLength = 512
+
 // New creates a new zap.Logger that writes logs to the given Google Cloud Logging logger.
 //
 // Parameters:
 // - out: The Google Cloud Logging logger to write logs to.
 // - config: The configuration for the zap.Logger.
-// - options: Additional options for the zap.Logger.
+// - options: Additional options for the zap.Logger, applied after the options derived from config.
 //
 // Returns:
 // - A new zap.Logger that writes logs to the given Google Cloud Logging logger.
 func New(out *logging.Logger, config Config, options ...zap.Option) *zap.Logger {
-	core := newCore(out, config.EncoderConfig, config.Level, config.LevelToSeverity)
+	core := NewCore(out, config)
+
+	options = append(config.Options(), options...)
+	if config.DisableCaller {
+		// Caller capture must stay disabled, even if the given options enable it.
+		options = append(options, zap.WithCaller(false))
+	}
+
+	logger := zap.New(core, options...)
+	logEffectiveConfig(logger, config)
+
+	return logger
+}
+
+// NewFromProject creates a Google Cloud Logging client for the given project and a new
+// zap.Logger writing to the log named by Config.LogName, or DefaultLogName if it is empty.
+// The caller must close the returned client when done logging, which flushes the logs.
+//
+// Parameters:
+// - ctx: The context used to create the client.
+// - projectID: The ID of the project to write logs to.
+// - config: The configuration for the zap.Logger.
+// - options: Options for the Google Cloud Logging client, e.g. credentials.
+//
+// Returns:
+// - A new zap.Logger.
+// - The created client.
+// - An error if the configuration is invalid or the client could not be created, nil otherwise.
+func NewFromProject(ctx context.Context, projectID string, config Config, options ...option.ClientOption) (*zap.Logger, *logging.Client, error) {
+	if projectID == "" {
+		return nil, nil, errors.New("gclzap: project ID must not be empty")
+	}
+	logName := config.LogName
+	if logName == "" {
+		logName = DefaultLogName
+	}
+	if err := validateLogName(logName); err != nil {
+		return nil, nil, err
+	}
+
+	client, err := logging.NewClient(ctx, projectID, options...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("gclzap: failed to create client: %w", err)
+	}
+
+	return New(client.Logger(logName), config), client, nil
+}
+
+// validateLogName checks that the given log name is accepted by Google Cloud Logging.
+// Log names consist of at most 512 letters, digits, underscores, hyphens, periods
+// and forward slashes.
+//
+// Parameters:
+// - name: The log name to validate.
+//
+// Returns:
+// - An error if the log name is invalid, nil otherwise.
+func validateLogName(name string) error {
+	if len(name) > maxLogNameLength {
+		return fmt.Errorf("gclzap: log name exceeds %d characters", maxLogNameLength)
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_', r == '-', r == '.', r == '/':
+		default:
+			return fmt.Errorf("gclzap: log name %q contains invalid character %q", name, r)
+		}
+	}
 
-	return zap.New(core, options...)
+	return nil
 }
 
 // NewProduction creates a new zap.Logger that writes logs to the given Google Cloud Logging logger.
@@ -64,3 +143,62 @@ func NewProduction(logger *logging.Logger) *zap.Logger {
 func NewDevelopment(logger *logging.Logger) *zap.Logger {
 	return NewProductionConfig().Build(logger)
 }
+
+// NewSugaredProduction creates a new zap.SugaredLogger that writes logs to the given Google Cloud Logging logger.
+// It uses the production configuration for the Core.
+//
+// Parameters:
+// - logger: The Google Cloud Logging logger to write logs to.
+//
+// Returns:
+// - A new zap.SugaredLogger that writes logs to the given Google Cloud Logging logger.
+func NewSugaredProduction(logger *logging.Logger) *zap.SugaredLogger {
+	return NewProduction(logger).Sugar()
+}
+
+// NewSugaredDevelopment creates a new zap.SugaredLogger that writes logs to the given Google Cloud Logging logger.
+// It uses the same configuration as NewDevelopment.
+//
+// Parameters:
+// - logger: The Google Cloud Logging logger to write logs to.
+//
+// Returns:
+// - A new zap.SugaredLogger that writes logs to the given Google Cloud Logging logger.
+func NewSugaredDevelopment(logger *logging.Logger) *zap.SugaredLogger {
+	return NewDevelopment(logger).Sugar()
+}
+
+// WithLabels returns a child of the given logger whose entries carry the given labels,
+// in addition to the labels of the parent. The parent is not affected.
+// The labels are only attached if the logger is backed by a Core.
+//
+// Parameters:
+// - l: The parent logger.
+// - labels: The labels to attach.
+//
+// Returns:
+// - The child logger.
+func WithLabels(l *zap.Logger, labels map[string]string) *zap.Logger {
+	fields := make([]zap.Field, 0, len(labels))
+	for _, k := range mapKeys(labels) {
+		fields = append(fields, Label(k, labels[k]))
+	}
+
+	return l.With(fields...)
+}
+
+// Close closes the given zap.Logger.
+// If the logger is backed by a Core, the Core is closed, which may emit a summary entry.
+// Otherwise, the logger is synced.
+//
+// Parameters:
+// - logger: The logger to close.
+//
+// Returns:
+// - An error if the logger could not be closed, nil otherwise.
+func Close(logger *zap.Logger) error {
+	if closer, ok := logger.Core().(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return logger.Sync()
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/logging"
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
+	"go.uber.org/zap"
+	"google.golang.org/api/option"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// diagnosticKey is the payload key of the instrumentation entries written by the client library.
+const diagnosticKey = "logging.googleapis.com/diagnostic"
+
+// fakeLoggingServer is a Google Cloud Logging API server recording the written entries.
+type fakeLoggingServer struct {
+	logpb.UnimplementedLoggingServiceV2Server
+
+	mu      sync.Mutex
+	entries []*logpb.LogEntry
+}
+
+// WriteLogEntries records the given entries, except for the instrumentation entries.
+// As in the API, entries without a log name take the log name of the request.
+//
+// Parameters:
+// - ctx: The context of the request.
+// - req: The request.
+//
+// Returns:
+// - An empty response.
+// - Always nil.
+func (s *fakeLoggingServer) WriteLogEntries(ctx context.Context, req *logpb.WriteLogEntriesRequest) (*logpb.WriteLogEntriesResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range req.Entries {
+		if e.GetJsonPayload().GetFields()[diagnosticKey] != nil {
+			continue
+		}
+		if e.LogName == "" {
+			e.LogName = req.LogName
+		}
+		s.entries = append(s.entries, e)
+	}
+	return &logpb.WriteLogEntriesResponse{}, nil
+}
+
+// Entries returns a copy of the recorded entries.
+//
+// Returns:
+// - The recorded entries.
+func (s *fakeLoggingServer) Entries() []*logpb.LogEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*logpb.LogEntry(nil), s.entries...)
+}
+
+// startFakeServer starts a fake Google Cloud Logging API server, which is stopped when the test ends.
+//
+// Parameters:
+// - t: The test.
+//
+// Returns:
+// - The client options connecting to the fake server.
+// - The fake server.
+func startFakeServer(t *testing.T) ([]option.ClientOption, *fakeLoggingServer) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeLoggingServer{}
+	server := grpc.NewServer()
+	logpb.RegisterLoggingServiceV2Server(server, fake)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	return []option.ClientOption{
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}, fake
+}
+
+// newFakeLogger starts a fake Google Cloud Logging API server and returns a logger writing to it.
+// The server and the client are stopped when the test ends.
+//
+// Parameters:
+// - t: The test.
+//
+// Returns:
+// - A logger writing to the fake server.
+// - The fake server.
+func newFakeLogger(t *testing.T) (*logging.Logger, *fakeLoggingServer) {
+	t.Helper()
+	options, fake := startFakeServer(t)
+	client, err := logging.NewClient(context.Background(), "projects/test", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	// The resource is set explicitly to skip the detection of the environment.
+	return client.Logger("test", logging.CommonResource(&mrpb.MonitoredResource{Type: "global"})), fake
+}
+
+func TestNewSugared(t *testing.T) {
+	tests := []struct {
+		name        string
+		constructor func(*logging.Logger) *zap.SugaredLogger
+	}{
+		{name: "production", constructor: NewSugaredProduction},
+		{name: "development", constructor: NewSugaredDevelopment},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, server := newFakeLogger(t)
+			logger := tt.constructor(out)
+			if _, ok := logger.Desugar().Core().(*Core); !ok {
+				t.Fatalf("core is %T, want *Core", logger.Desugar().Core())
+			}
+
+			logger.Infow("hello", "user", "alice", "count", 3)
+			if err := logger.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries := server.Entries()
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			if got := entries[0].GetSeverity().String(); got != "INFO" {
+				t.Errorf("severity = %s, want INFO", got)
+			}
+			fields := entries[0].GetJsonPayload().GetFields()
+			if got := fields["message"].GetStringValue(); got != "hello" {
+				t.Errorf("message = %q, want %q", got, "hello")
+			}
+			if got := fields["user"].GetStringValue(); got != "alice" {
+				t.Errorf("user = %q, want %q", got, "alice")
+			}
+			if got := fields["count"].GetNumberValue(); got != 3 {
+				t.Errorf("count = %v, want 3", got)
+			}
+		})
+	}
+}
+
+func TestDisableCaller(t *testing.T) {
+	tests := []struct {
+		name          string
+		disableCaller bool
+		wantCaller    bool
+	}{
+		{name: "enabled", wantCaller: true},
+		{name: "disabled despite AddCaller", disableCaller: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, server := newFakeLogger(t)
+			config := Config{EncoderConfig: DefaultEncoderConfig(), DisableCaller: tt.disableCaller}
+			logger := New(out, config, zap.AddCaller())
+
+			logger.Info("hello")
+			if err := logger.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries := server.Entries()
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			_, hasCaller := entries[0].GetJsonPayload().GetFields()["caller"]
+			if hasCaller != tt.wantCaller {
+				t.Errorf("caller present = %v, want %v", hasCaller, tt.wantCaller)
+			}
+			if hasLocation := entries[0].GetSourceLocation() != nil; hasLocation != tt.wantCaller {
+				t.Errorf("source location present = %v, want %v", hasLocation, tt.wantCaller)
+			}
+		})
+	}
+}
+
+func TestNewFromProject(t *testing.T) {
+	tests := []struct {
+		name        string
+		projectID   string
+		logName     string
+		wantLogName string
+		wantErr     bool
+	}{
+		{name: "default log name", projectID: "test", wantLogName: "projects/test/logs/" + DefaultLogName},
+		{name: "configured log name", projectID: "test", logName: "orders/api", wantLogName: "projects/test/logs/orders%2Fapi"},
+		{name: "empty project ID", wantErr: true},
+		{name: "invalid log name", projectID: "test", logName: "orders api", wantErr: true},
+		{name: "too long log name", projectID: "test", logName: strings.Repeat("a", maxLogNameLength+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, server := startFakeServer(t)
+			logger, client, err := NewFromProject(context.Background(), tt.projectID, Config{LogName: tt.logName}, options...)
+			if tt.wantErr {
+				if err == nil || logger != nil || client != nil {
+					t.Fatalf("NewFromProject() = %v, %v, %v, want only an error", logger, client, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logger.Info("hello")
+			if err := client.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries := server.Entries()
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			if got := entries[0].GetLogName(); got != tt.wantLogName {
+				t.Errorf("log name = %q, want %q", got, tt.wantLogName)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"strings"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap/zapcore"
+)
+
+// Destinations of the field mapping.
+const (
+	mapToTrace       = "trace"
+	mapToSpanID      = "spanId"
+	mapToInsertID    = "insertId"
+	mapToHTTPRequest = "httpRequest"
+	mapToLabelPrefix = "label:"
+)
+
+// mapFields replaces the fields named in the given mapping by special fields
+// that set the mapped destination of the entry.
+// Fields whose value cannot be converted for their destination are left untouched.
+//
+// Parameters:
+// - mapping: The mapping from field keys to destinations.
+// - fields: The fields to map.
+//
+// Returns:
+// - The mapped fields.
+func mapFields(mapping map[string]string, fields []zapcore.Field) []zapcore.Field {
+	if len(mapping) == 0 {
+		return fields
+	}
+
+	var mapped []zapcore.Field
+	for i, f := range fields {
+		var converted zapcore.Field
+		ok := false
+		if destination, found := mapping[f.Key]; found && !isSpecial(f) {
+			converted, ok = mapField(destination, f)
+		}
+		if !ok {
+			if mapped != nil {
+				mapped = append(mapped, f)
+			}
+			continue
+		}
+
+		if mapped == nil {
+			mapped = make([]zapcore.Field, i, len(fields))
+			copy(mapped, fields[:i])
+		}
+		mapped = append(mapped, converted)
+	}
+
+	if mapped == nil {
+		return fields
+	}
+	return mapped
+}
+
+// mapField converts the given field into a special field for the given destination.
+//
+// Parameters:
+// - destination: The destination of the field.
+// - f: The field to convert.
+//
+// Returns:
+// - The special field.
+// - Whether the field could be converted.
+func mapField(destination string, f zapcore.Field) (zapcore.Field, bool) {
+	switch destination {
+	case mapToTrace:
+		return special(f.Key, traceField(fieldString(f))), true
+	case mapToSpanID:
+		return special(f.Key, spanIDField(fieldString(f))), true
+	case mapToInsertID:
+		return special(f.Key, insertIDField(fieldString(f))), true
+	case mapToHTTPRequest:
+		switch request := f.Interface.(type) {
+		case *logging.HTTPRequest:
+			return special(f.Key, httpRequestField{request: request}), true
+		case logging.HTTPRequest:
+			return special(f.Key, httpRequestField{request: &request}), true
+		}
+	default:
+		if key, ok := strings.CutPrefix(destination, mapToLabelPrefix); ok && key != "" {
+			return Label(key, fieldString(f)), true
+		}
+	}
+
+	return f, false
+}
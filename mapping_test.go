@@ -0,0 +1,123 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"testing"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestFieldMapping(t *testing.T) {
+	request := &logging.HTTPRequest{Status: 200}
+
+	tests := []struct {
+		name        string
+		mapping     map[string]string
+		field       zapcore.Field
+		check       func(t *testing.T, e logging.Entry)
+		wantPayload bool
+	}{
+		{
+			name:    "trace",
+			mapping: map[string]string{"trace_id": "trace"},
+			field:   zap.String("trace_id", "projects/p/traces/abc"),
+			check: func(t *testing.T, e logging.Entry) {
+				if e.Trace != "projects/p/traces/abc" {
+					t.Errorf("trace = %q", e.Trace)
+				}
+			},
+		},
+		{
+			name:    "span ID",
+			mapping: map[string]string{"span": "spanId"},
+			field:   zap.String("span", "0000000000000001"),
+			check: func(t *testing.T, e logging.Entry) {
+				if e.SpanID != "0000000000000001" {
+					t.Errorf("span ID = %q", e.SpanID)
+				}
+			},
+		},
+		{
+			name:    "insert ID",
+			mapping: map[string]string{"id": "insertId"},
+			field:   zap.Int("id", 42),
+			check: func(t *testing.T, e logging.Entry) {
+				if e.InsertID != "42" {
+					t.Errorf("insert ID = %q", e.InsertID)
+				}
+			},
+		},
+		{
+			name:    "HTTP request",
+			mapping: map[string]string{"req": "httpRequest"},
+			field:   zap.Any("req", request),
+			check: func(t *testing.T, e logging.Entry) {
+				if e.HTTPRequest != request {
+					t.Errorf("HTTP request = %v", e.HTTPRequest)
+				}
+			},
+		},
+		{
+			name:    "label",
+			mapping: map[string]string{"tenant": "label:tenant_id"},
+			field:   zap.String("tenant", "acme"),
+			check: func(t *testing.T, e logging.Entry) {
+				if e.Labels["tenant_id"] != "acme" {
+					t.Errorf("labels = %v", e.Labels)
+				}
+			},
+		},
+		{
+			name:        "unmapped field stays in the payload",
+			mapping:     map[string]string{"other": "trace"},
+			field:       zap.String("trace_id", "abc"),
+			check:       func(t *testing.T, e logging.Entry) {},
+			wantPayload: true,
+		},
+		{
+			name:        "unconvertible field stays in the payload",
+			mapping:     map[string]string{"req": "httpRequest"},
+			field:       zap.String("req", "GET /"),
+			check:       func(t *testing.T, e logging.Entry) {},
+			wantPayload: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{FieldMapping: tt.mapping})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, []zapcore.Field{tt.field}); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			tt.check(t, entry)
+			if _, ok := payloadOf(t, entry)[tt.field.Key]; ok != tt.wantPayload {
+				t.Errorf("field %q in payload: %v, want %v", tt.field.Key, ok, tt.wantPayload)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// statusRecorder is a http.ResponseWriter that records the status code
+// and the size of the response. It forwards http.Flusher, http.Hijacker and
+// io.ReaderFrom to the underlying writer, so that streaming, WebSockets and
+// sendfile keep working behind the middleware.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+// WriteHeader records the status code and writes it to the underlying writer.
+//
+// Parameters:
+// - status: The status code of the response.
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the size of the written data and writes it to the underlying writer.
+//
+// Parameters:
+// - b: The data to write.
+//
+// Returns:
+// - The number of bytes written.
+// - An error if the data could not be written, nil otherwise.
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush sends the buffered data to the client, if the underlying writer supports flushing.
+func (w *statusRecorder) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection from the underlying writer, e.g. for WebSockets.
+// A hijacked request is recorded with status 101 Switching Protocols unless
+// a status code has been written before.
+//
+// Returns:
+// - The connection.
+// - The buffered reader and writer of the connection.
+// - An error if the underlying writer does not support hijacking or hijacking failed, nil otherwise.
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("gclzap: %T does not support hijacking: %w", w.ResponseWriter, http.ErrNotSupported)
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// ReadFrom copies the data from the given reader to the underlying writer,
+// using its io.ReaderFrom implementation if available, e.g. to send files efficiently.
+// The size of the copied data is recorded.
+//
+// Parameters:
+// - src: The reader to copy the data from.
+//
+// Returns:
+// - The number of bytes copied.
+// - An error if the data could not be copied, nil otherwise.
+func (w *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		// Hide the ReadFrom method of the recorder from io.Copy to avoid recursion.
+		n, err = io.Copy(struct{ io.Writer }{w.ResponseWriter}, src)
+	}
+	w.size += n
+	return n, err
+}
+
+// Unwrap returns the underlying writer, so that http.ResponseController can reach it.
+//
+// Returns:
+// - The underlying writer.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// statusLevel returns the level for a request served with the given status code.
+//
+// Parameters:
+// - status: The status code of the response.
+//
+// Returns:
+// - Error for server errors, Warn for client errors and Info otherwise.
+func statusLevel(status int) zapcore.Level {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return zapcore.ErrorLevel
+	case status >= http.StatusBadRequest:
+		return zapcore.WarnLevel
+	default:
+		return zapcore.InfoLevel
+	}
+}
+
+// Middleware returns net/http middleware that logs every served request with the given logger.
+// Each entry carries the HTTP request, including the status code, response size and latency,
+// and a "latency" field. Entries are correlated with the trace of the X-Cloud-Trace-Context
+// header, if present; set Config.ProjectID to qualify the trace with the project.
+// Server errors are logged at Error level, client errors at Warn level and all other
+// requests at Info level.
+//
+// Parameters:
+// - logger: The logger to log the requests with.
+//
+// Returns:
+// - The middleware.
+func Middleware(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			latency := time.Since(start)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			fields := []zap.Field{
+				HTTPRequest(NewHTTPRequest(r, status, rec.size, latency)),
+				zap.Duration("latency", latency),
+			}
+			if trace, span, sampled, ok := ParseCloudTraceHeader(r.Header.Get(cloudTraceHeader)); ok {
+				fields = append(fields, Trace(trace), TraceSampled(sampled))
+				if span != "" {
+					fields = append(fields, SpanID(span))
+				}
+			}
+
+			if ce := logger.Check(statusLevel(status), r.Method+" "+r.URL.Path); ce != nil {
+				ce.Write(fields...)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		traceHeader  string
+		wantStatus   int
+		wantSeverity logging.Severity
+		wantTrace    string
+		wantSpan     string
+		wantSampled  bool
+	}{
+		{name: "implicit ok", body: "hello", wantStatus: http.StatusOK, wantSeverity: logging.Info},
+		{name: "client error", status: http.StatusNotFound, wantStatus: http.StatusNotFound, wantSeverity: logging.Warning},
+		{name: "server error", status: http.StatusBadGateway, body: "down", wantStatus: http.StatusBadGateway, wantSeverity: logging.Error},
+		{
+			name:         "trace correlation",
+			traceHeader:  testTraceID + "/1;o=1",
+			wantStatus:   http.StatusOK,
+			wantSeverity: logging.Info,
+			wantTrace:    "projects/my-project/traces/" + testTraceID,
+			wantSpan:     "0000000000000001",
+			wantSampled:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			logger := zap.New(newCore(out, Config{ProjectID: "my-project"}))
+			handler := Middleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				_, _ = io.WriteString(w, tt.body)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/orders?id=1", nil)
+			if tt.traceHeader != "" {
+				r.Header.Set("X-Cloud-Trace-Context", tt.traceHeader)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			entries := out.Entries()
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			entry := entries[0]
+			if entry.Severity != tt.wantSeverity {
+				t.Errorf("severity = %v, want %v", entry.Severity, tt.wantSeverity)
+			}
+			if entry.HTTPRequest == nil {
+				t.Fatal("entry has no HTTP request")
+			}
+			if entry.HTTPRequest.Status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", entry.HTTPRequest.Status, tt.wantStatus)
+			}
+			if entry.HTTPRequest.ResponseSize != int64(len(tt.body)) {
+				t.Errorf("response size = %d, want %d", entry.HTTPRequest.ResponseSize, len(tt.body))
+			}
+			if entry.HTTPRequest.Request != r {
+				t.Error("entry does not carry the served request")
+			}
+			if entry.Trace != tt.wantTrace || entry.SpanID != tt.wantSpan || entry.TraceSampled != tt.wantSampled {
+				t.Errorf("trace = %q, %q, %v, want %q, %q, %v",
+					entry.Trace, entry.SpanID, entry.TraceSampled, tt.wantTrace, tt.wantSpan, tt.wantSampled)
+			}
+			payload := payloadOf(t, entry)
+			if payload["message"] != "GET /orders" {
+				t.Errorf("message = %v, want %q", payload["message"], "GET /orders")
+			}
+			if _, ok := payload["latency"].(float64); !ok {
+				t.Errorf("latency = %#v, want seconds", payload["latency"])
+			}
+		})
+	}
+}
+
+// readerFromWriter is a http.ResponseWriter implementing io.ReaderFrom.
+type readerFromWriter struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+// ReadFrom records the call and copies the data to the recorder.
+//
+// Parameters:
+// - src: The reader to copy the data from.
+//
+// Returns:
+// - The number of bytes copied.
+// - An error if the data could not be copied, nil otherwise.
+func (w *readerFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.readFrom = true
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+func TestStatusRecorderReadFrom(t *testing.T) {
+	tests := []struct {
+		name          string
+		writer        http.ResponseWriter
+		wantForwarded bool
+	}{
+		{name: "forwarded", writer: &readerFromWriter{ResponseRecorder: httptest.NewRecorder()}, wantForwarded: true},
+		{name: "copied", writer: httptest.NewRecorder()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &statusRecorder{ResponseWriter: tt.writer}
+			// The limited reader does not implement io.WriterTo, so io.Copy uses ReadFrom.
+			n, err := io.Copy(rec, io.LimitReader(strings.NewReader("file contents"), 1024))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n != 13 || rec.size != 13 {
+				t.Errorf("copied %d bytes, recorded %d, want 13", n, rec.size)
+			}
+			if rec.status != http.StatusOK {
+				t.Errorf("status = %d, want %d", rec.status, http.StatusOK)
+			}
+			if w, ok := tt.writer.(*readerFromWriter); ok && w.readFrom != tt.wantForwarded {
+				t.Errorf("ReadFrom forwarded = %v, want %v", w.readFrom, tt.wantForwarded)
+			}
+		})
+	}
+}
+
+func TestStatusRecorderFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &statusRecorder{ResponseWriter: w}
+	var _ http.Flusher = rec
+
+	rec.Flush()
+	if !w.Flushed {
+		t.Error("flush was not forwarded")
+	}
+	if rec.status != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.status, http.StatusOK)
+	}
+}
+
+func TestStatusRecorderHijack(t *testing.T) {
+	t.Run("unsupported", func(t *testing.T) {
+		rec := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+		if _, _, err := rec.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+			t.Errorf("Hijack() error = %v, want %v", err, http.ErrNotSupported)
+		}
+	})
+
+	t.Run("forwarded", func(t *testing.T) {
+		out := &fakeSink{}
+		logger := zap.New(newCore(out, Config{}))
+		server := httptest.NewServer(Middleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, rw, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: close\r\n\r\n")
+			_ = rw.Flush()
+		})))
+		defer server.Close()
+
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if _, err := io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: example.com\r\n\r\n"); err != nil {
+			t.Fatal(err)
+		}
+		status, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(status, "HTTP/1.1 101") {
+			t.Errorf("status line = %q, want 101", status)
+		}
+
+		entries := waitEntries(t, out, 1)
+		if got := entries[0].HTTPRequest.Status; got != http.StatusSwitchingProtocols {
+			t.Errorf("status = %d, want %d", got, http.StatusSwitchingProtocols)
+		}
+	})
+}
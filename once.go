@@ -0,0 +1,149 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxOnceKeys is the maximum number of keys remembered by OnceCores in this process.
+const maxOnceKeys = 4096
+
+// onceSet is a bounded set of the keys of the entries written by OnceCores.
+type onceSet struct {
+	mu    sync.Mutex
+	keys  map[string]struct{}
+	limit int
+}
+
+// add records the given key.
+// Once the set is full, new keys are not recorded, so that the memory stays bounded
+// at the cost of writing their entries repeatedly.
+//
+// Parameters:
+// - key: The key of the entry.
+//
+// Returns:
+// - True if the key has not been recorded before, false otherwise.
+func (s *onceSet) add(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, seen := s.keys[key]; seen {
+		return false
+	}
+	if len(s.keys) < s.limit {
+		if s.keys == nil {
+			s.keys = make(map[string]struct{})
+		}
+		s.keys[key] = struct{}{}
+	}
+	return true
+}
+
+// onceSeen holds the keys of the entries written by OnceCores in this process.
+var onceSeen = &onceSet{limit: maxOnceKeys}
+
+// OnceCore is a zapcore.Core that writes an entry at most once per process for every
+// call site and message, e.g. for deprecation warnings. Entries are keyed by their call site
+// and message, or by their message only without caller information. At most 4096 keys are
+// remembered per process, entries with new keys beyond that limit are written every time.
+type OnceCore struct {
+	zapcore.Core
+}
+
+// NewOnceCore wraps the given Core in a OnceCore.
+//
+// Parameters:
+// - core: The Core to wrap.
+//
+// Returns:
+// - A new OnceCore.
+func NewOnceCore(core zapcore.Core) *OnceCore {
+	return &OnceCore{Core: core}
+}
+
+// With adds structured context to the wrapped Core.
+//
+// Parameters:
+// - fields: The fields to add.
+//
+// Returns:
+// - A new OnceCore with the given fields added.
+func (c *OnceCore) With(fields []zapcore.Field) zapcore.Core {
+	return &OnceCore{Core: c.Core.With(fields)}
+}
+
+// Check determines whether the given entry should be logged.
+// Entries are deduplicated on write, as the caller is only known then.
+//
+// Parameters:
+// - ent: The entry to check.
+// - ce: The checked entry to add the Core to.
+//
+// Returns:
+// - The checked entry, with the Core added if the entry is enabled.
+func (c *OnceCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write writes the given entry, unless an entry with the same message from the same call site,
+// or with the same message if the caller is unknown, has already been written.
+//
+// Parameters:
+// - ent: The entry to write.
+// - fields: The fields of the entry.
+//
+// Returns:
+// - An error if the entry could not be written, nil otherwise.
+func (c *OnceCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	// The prefixes keep call sites and messages apart.
+	key := "message:" + ent.Message
+	if ent.Caller.Defined {
+		key = "caller:" + ent.Caller.String() + "\x00" + ent.Message
+	}
+	if !onceSeen.add(key) {
+		return nil
+	}
+
+	return c.Core.Write(ent, fields)
+}
+
+// Once returns a logger that writes every message at most once per process and call site,
+// e.g. Once(logger).Warn("deprecated") in a loop writes a single entry.
+// Caller capture is enabled on the returned logger to identify the call site.
+//
+// Parameters:
+// - logger: The logger to write with.
+//
+// Returns:
+// - A logger that writes every message at most once per call site.
+func Once(logger *zap.Logger) *zap.Logger {
+	return logger.WithOptions(zap.AddCaller(), zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return NewOnceCore(core)
+	}))
+}
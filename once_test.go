@@ -0,0 +1,108 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"strconv"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// resetOnce replaces the keys written by OnceCores with an empty set for the duration of the test,
+// so that the test does not depend on the entries written by other tests or earlier runs.
+//
+// Parameters:
+// - t: The test.
+func resetOnce(t *testing.T) {
+	t.Helper()
+	seen := onceSeen
+	onceSeen = &onceSet{limit: maxOnceKeys}
+	t.Cleanup(func() { onceSeen = seen })
+}
+
+func TestOnce(t *testing.T) {
+	resetOnce(t)
+	out := &fakeSink{}
+	logger := Once(zap.New(newCore(out, Config{EncoderConfig: DefaultEncoderConfig()})))
+
+	for i := 0; i < 3; i++ {
+		logger.Warn("deprecated: use NewThing instead")
+	}
+	for i := 0; i < 4; i++ {
+		// Repeated messages from one call site are dropped, different ones are written.
+		logger.Warn("deprecated option " + strconv.Itoa(i%2))
+	}
+	logger.Warn("deprecated: use NewThing instead")
+
+	entries := out.Entries()
+	want := []string{"deprecated: use NewThing instead", "deprecated option 0", "deprecated option 1", "deprecated: use NewThing instead"}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, msg := range want {
+		if got := payloadOf(t, entries[i])["message"]; got != msg {
+			t.Errorf("entry %d = %v, want %q", i, got, msg)
+		}
+	}
+}
+
+func TestOnceCoreWithoutCaller(t *testing.T) {
+	resetOnce(t)
+	out := &fakeSink{}
+	core := NewOnceCore(newCore(out, Config{})).With([]zapcore.Field{zap.String("component", "once")})
+	for _, msg := range []string{"once without caller a", "once without caller b", "once without caller a"} {
+		if err := core.Write(zapcore.Entry{Level: zapcore.WarnLevel, Message: msg}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := len(out.Entries()); got != 2 {
+		t.Errorf("got %d entries, want 2 keyed by message", got)
+	}
+}
+
+func TestOnceSetBounded(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want []bool
+	}{
+		{name: "repeated key", keys: []string{"a", "a", "b"}, want: []bool{true, false, true}},
+		{name: "full set forgets new keys", keys: []string{"a", "b", "c", "c", "a"}, want: []bool{true, true, true, true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := &onceSet{limit: 2}
+			for i, key := range tt.keys {
+				if got := set.add(key); got != tt.want[i] {
+					t.Errorf("add(%q) #%d = %v, want %v", key, i, got, tt.want[i])
+				}
+			}
+			if len(set.keys) > set.limit {
+				t.Errorf("set holds %d keys, want at most %d", len(set.keys), set.limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// OTelSeverityNumber is the severity number of an OpenTelemetry log record.
+// https://opentelemetry.io/docs/specs/otel/logs/data-model/#field-severitynumber
+type OTelSeverityNumber int
+
+// LogRecord is an entry in the OpenTelemetry log data model.
+type LogRecord struct {
+	// Timestamp is the time of the entry.
+	Timestamp time.Time
+	// SeverityNumber is the severity of the entry in the OpenTelemetry scale.
+	SeverityNumber OTelSeverityNumber
+	// SeverityText is the name of the Google Cloud Logging severity of the entry.
+	SeverityText string
+	// Body is the message of the entry.
+	Body string
+	// Attributes are the payload fields and labels of the entry.
+	// Labels are prefixed with "label.".
+	Attributes map[string]interface{}
+	// TraceID is the trace ID of the entry, without the project.
+	TraceID string
+	// SpanID is the span ID of the entry.
+	SpanID string
+	// Sampled reports whether the trace of the entry is sampled.
+	Sampled bool
+}
+
+// Defaults of the batching of NewOTelCore, matching the batch processor of the OpenTelemetry SDK.
+const (
+	// DefaultOTelBatchSize is the default maximum number of records per export.
+	DefaultOTelBatchSize = 512
+	// DefaultOTelMaxQueueSize is the default maximum number of buffered records.
+	DefaultOTelMaxQueueSize = 2048
+	// DefaultOTelExportInterval is the default interval between exports of buffered records.
+	DefaultOTelExportInterval = time.Second
+)
+
+// LogExporter exports OpenTelemetry log records, e.g. by adapting an OTLP exporter.
+// It mirrors the Export method of the exporters of the OpenTelemetry SDK, which are not
+// accepted directly, as go.opentelemetry.io/otel/sdk/log is a separate module that is
+// not yet stable. An adapter converting the records implements this interface.
+type LogExporter interface {
+	// Export exports the given records.
+	Export(ctx context.Context, records []LogRecord) error
+}
+
+// NewOTelCore creates a new Core that converts entries to OpenTelemetry log records
+// and exports them with the given exporter instead of writing them to Google Cloud Logging.
+// The severity of the records is derived from the severity of the entries, so the
+// configured LevelToSeverity is respected.
+//
+// Records are buffered and exported in batches of at most Config.OTelBatchSize records
+// by a background goroutine, whenever a batch is full and every Config.OTelExportInterval.
+// At most Config.OTelMaxQueueSize records are buffered; further records are dropped,
+// and their number is reported by a record at WARNING severity with the next export.
+// Errors of background exports are passed to Config.OnError. Flushing exports the buffered
+// records synchronously, and closing the Core stops the background goroutine.
+//
+// Parameters:
+// - exporter: The exporter to export records with.
+// - config: The configuration for the Core.
+//
+// Returns:
+// - A new Core that exports logs to the given exporter.
+func NewOTelCore(exporter LogExporter, config Config) *Core {
+	return newCore(newOTelSink(exporter, config), config)
+}
+
+// otelSeverityNumber converts the given Google Cloud Logging severity
+// to an OpenTelemetry severity number.
+//
+// Parameters:
+// - s: The severity to convert.
+//
+// Returns:
+// - The severity number, 0 (unspecified) for DEFAULT.
+func otelSeverityNumber(s logging.Severity) OTelSeverityNumber {
+	switch {
+	case s >= logging.Emergency:
+		return 21
+	case s >= logging.Alert:
+		return 19
+	case s >= logging.Critical:
+		return 18
+	case s >= logging.Error:
+		return 17
+	case s >= logging.Warning:
+		return 13
+	case s >= logging.Notice:
+		return 10
+	case s >= logging.Info:
+		return 9
+	case s >= logging.Debug:
+		return 5
+	default:
+		return 0
+	}
+}
+
+// otelSink is a sink that exports entries as OpenTelemetry log records in bounded batches.
+type otelSink struct {
+	exporter  LogExporter
+	batchSize int
+	queueSize int
+	onError   func(error)
+
+	// exportMu serializes exports, so that records are exported in order.
+	exportMu sync.Mutex
+
+	mu      sync.Mutex
+	records []LogRecord
+	dropped uint64
+
+	// full is signaled when a batch is full.
+	full      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newOTelSink creates a new otelSink and starts its goroutine.
+// The goroutine runs until the sink is closed.
+//
+// Parameters:
+// - exporter: The exporter to export records with.
+// - config: The configuration holding the batch size, queue size, export interval and error handler.
+//
+// Returns:
+// - A new otelSink.
+func newOTelSink(exporter LogExporter, config Config) *otelSink {
+	s := &otelSink{
+		exporter:  exporter,
+		batchSize: config.OTelBatchSize,
+		queueSize: config.OTelMaxQueueSize,
+		onError:   config.OnError,
+		full:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = DefaultOTelBatchSize
+	}
+	if s.queueSize <= 0 {
+		s.queueSize = DefaultOTelMaxQueueSize
+	}
+	interval := config.OTelExportInterval
+	if interval <= 0 {
+		interval = DefaultOTelExportInterval
+	}
+	go s.run(interval)
+
+	return s
+}
+
+// run exports the buffered records whenever a batch is full and at the given interval,
+// until the sink is closed.
+//
+// Parameters:
+// - interval: The interval between exports.
+func (s *otelSink) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.full:
+		case <-ticker.C:
+		}
+		if err := s.export(); err != nil && s.onError != nil {
+			s.onError(err)
+		}
+	}
+}
+
+// Log buffers the given entry as a log record, or drops it if the buffer is full. It never blocks.
+//
+// Parameters:
+// - e: The entry to buffer.
+func (s *otelSink) Log(e logging.Entry) {
+	record := newLogRecord(e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.records) >= s.queueSize {
+		s.dropped++
+		return
+	}
+	s.records = append(s.records, record)
+	if len(s.records) >= s.batchSize {
+		select {
+		case s.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush exports the buffered records.
+//
+// Returns:
+// - An error if the records could not be exported, nil otherwise.
+func (s *otelSink) Flush() error {
+	return s.export()
+}
+
+// Close stops the background goroutine and exports the buffered records.
+// Records buffered afterwards are exported on flush. It is safe to call Close multiple times.
+//
+// Returns:
+// - An error if the records could not be exported, nil otherwise.
+func (s *otelSink) Close() error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.done
+	return s.export()
+}
+
+// export exports the buffered records in batches, followed by a record reporting
+// the number of dropped records, if any. Batches that could not be exported are discarded.
+//
+// Returns:
+// - An error if any batch could not be exported, nil otherwise.
+func (s *otelSink) export() error {
+	s.exportMu.Lock()
+	defer s.exportMu.Unlock()
+
+	s.mu.Lock()
+	records := s.records
+	s.records = nil
+	if s.dropped > 0 {
+		records = append(records, newLogRecord(dropReport(s.dropped, time.Now())))
+		s.dropped = 0
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for len(records) > 0 {
+		n := min(len(records), s.batchSize)
+		if err := s.exporter.Export(context.Background(), records[:n]); err != nil {
+			errs = append(errs, err)
+		}
+		records = records[n:]
+	}
+	if len(errs) > 0 {
+		return errors.Join(append([]error{errors.New("gclzap: failed to export log records")}, errs...)...)
+	}
+	return nil
+}
+
+// newLogRecord converts the given entry to a log record.
+// The "message" key of a JSON payload becomes the body, the other keys
+// except "severity" and "time" become attributes.
+//
+// Parameters:
+// - e: The entry to convert.
+//
+// Returns:
+// - The log record.
+func newLogRecord(e logging.Entry) LogRecord {
+	record := LogRecord{
+		Timestamp:      e.Timestamp,
+		SeverityNumber: otelSeverityNumber(e.Severity),
+		SeverityText:   severityName(e.Severity),
+		SpanID:         e.SpanID,
+		Sampled:        e.TraceSampled,
+		Attributes:     make(map[string]interface{}),
+	}
+	if i := strings.LastIndex(e.Trace, "/traces/"); i >= 0 {
+		record.TraceID = e.Trace[i+len("/traces/"):]
+	} else {
+		record.TraceID = e.Trace
+	}
+
+	if text, ok := e.Payload.(string); ok {
+		record.Body = text
+	} else if payload, err := decodePayload(payloadBytes(e.Payload)); err == nil {
+		for k, v := range payload {
+			switch k {
+			case "message":
+				record.Body, _ = v.(string)
+			case "severity", "time":
+			default:
+				record.Attributes[k] = v
+			}
+		}
+	}
+	for k, v := range e.Labels {
+		record.Attributes["label."+k] = v
+	}
+
+	return record
+}
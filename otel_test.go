@@ -0,0 +1,349 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// fakeExporter is a LogExporter recording the exported batches.
+type fakeExporter struct {
+	mu      sync.Mutex
+	batches [][]LogRecord
+	err     error
+}
+
+// Export records the given batch and returns the configured error.
+//
+// Parameters:
+// - ctx: The context of the export.
+// - records: The records to export.
+//
+// Returns:
+// - The configured error.
+func (e *fakeExporter) Export(ctx context.Context, records []LogRecord) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.batches = append(e.batches, append([]LogRecord(nil), records...))
+	return e.err
+}
+
+// Batches returns the sizes of the exported batches.
+//
+// Returns:
+// - The sizes of the exported batches.
+func (e *fakeExporter) Batches() []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sizes := make([]int, len(e.batches))
+	for i, b := range e.batches {
+		sizes[i] = len(b)
+	}
+	return sizes
+}
+
+// Records returns the exported records in order.
+//
+// Returns:
+// - The exported records.
+func (e *fakeExporter) Records() []LogRecord {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var records []LogRecord
+	for _, b := range e.batches {
+		records = append(records, b...)
+	}
+	return records
+}
+
+// waitRecords waits until the given exporter has exported n records.
+//
+// Parameters:
+// - t: The test.
+// - e: The exporter.
+// - n: The number of records to wait for.
+func waitRecords(t *testing.T, e *fakeExporter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(e.Records()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d records, want %d", len(e.Records()), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOTelCore(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		level  zapcore.Level
+		fields []zapcore.Field
+		want   LogRecord
+	}{
+		{
+			name:  "info",
+			level: zapcore.InfoLevel,
+			want:  LogRecord{Timestamp: ts, SeverityNumber: 9, SeverityText: "INFO", Body: "hello", Attributes: map[string]interface{}{}},
+		},
+		{
+			name:  "error",
+			level: zapcore.ErrorLevel,
+			want:  LogRecord{Timestamp: ts, SeverityNumber: 17, SeverityText: "ERROR", Body: "hello", Attributes: map[string]interface{}{}},
+		},
+		{
+			name:   "attributes and labels",
+			level:  zapcore.WarnLevel,
+			fields: []zapcore.Field{zap.String("user", "alice"), Label("tenant", "acme")},
+			want: LogRecord{
+				Timestamp: ts, SeverityNumber: 13, SeverityText: "WARNING", Body: "hello",
+				Attributes: map[string]interface{}{"user": "alice", "label.tenant": "acme"},
+			},
+		},
+		{
+			name:   "trace context",
+			level:  zapcore.DebugLevel,
+			fields: []zapcore.Field{Trace("projects/p/traces/" + testTraceID), SpanID("000000000000004a"), TraceSampled(true)},
+			want: LogRecord{
+				Timestamp: ts, SeverityNumber: 5, SeverityText: "DEBUG", Body: "hello", Attributes: map[string]interface{}{},
+				TraceID: testTraceID, SpanID: "000000000000004a", Sampled: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := &fakeExporter{}
+			core := NewOTelCore(exporter, Config{Level: zapcore.DebugLevel, OTelExportInterval: time.Hour})
+			defer core.Close()
+			if err := core.Write(zapcore.Entry{Level: tt.level, Time: ts, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+			if err := core.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			records := exporter.Records()
+			if len(records) != 1 {
+				t.Fatalf("got %d records, want 1", len(records))
+			}
+			if !reflect.DeepEqual(records[0], tt.want) {
+				t.Errorf("record = %+v, want %+v", records[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestOTelBatchSize(t *testing.T) {
+	tests := []struct {
+		name        string
+		batchSize   int
+		entries     int
+		wantBatches []int
+	}{
+		{name: "single batch", batchSize: 10, entries: 4, wantBatches: []int{4}},
+		{name: "split", batchSize: 3, entries: 7, wantBatches: []int{3, 3, 1}},
+		{name: "default size", entries: DefaultOTelBatchSize + 1, wantBatches: []int{DefaultOTelBatchSize, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := &fakeExporter{}
+			s := newOTelSink(exporter, Config{OTelBatchSize: tt.batchSize, OTelExportInterval: time.Hour})
+			// The background goroutine is stopped, so that only the flush exports.
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			core := newCore(s, Config{})
+			for i := 0; i < tt.entries; i++ {
+				if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := core.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := exporter.Batches(); !reflect.DeepEqual(got, tt.wantBatches) {
+				t.Errorf("batches = %v, want %v", got, tt.wantBatches)
+			}
+		})
+	}
+}
+
+func TestOTelExportTriggers(t *testing.T) {
+	tests := []struct {
+		name      string
+		batchSize int
+		interval  time.Duration
+		entries   int
+	}{
+		{name: "full batch", batchSize: 3, interval: time.Hour, entries: 3},
+		{name: "interval", batchSize: 100, interval: 10 * time.Millisecond, entries: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := &fakeExporter{}
+			core := NewOTelCore(exporter, Config{OTelBatchSize: tt.batchSize, OTelExportInterval: tt.interval})
+			defer core.Close()
+			for i := 0; i < tt.entries; i++ {
+				if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The records are exported without a flush.
+			waitRecords(t, exporter, tt.entries)
+		})
+	}
+}
+
+func TestOTelMaxQueueSize(t *testing.T) {
+	exporter := &fakeExporter{}
+	core := NewOTelCore(exporter, Config{OTelBatchSize: 10, OTelMaxQueueSize: 2, OTelExportInterval: time.Hour})
+	defer core.Close()
+	for i := 0; i < 5; i++ {
+		if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := core.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := exporter.Records()
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want the 2 buffered records and a drop report", len(records))
+	}
+	report := records[2]
+	if report.SeverityNumber != 13 || report.Body != "3 log entries dropped" {
+		t.Errorf("report = %+v, want a WARNING record reporting 3 dropped entries", report)
+	}
+	if got := fmt.Sprint(report.Attributes["dropped"]); got != "3" {
+		t.Errorf("dropped = %v, want 3", got)
+	}
+
+	// The report is exported once.
+	if err := core.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(exporter.Records()); got != 3 {
+		t.Errorf("got %d records after a second flush, want 3", got)
+	}
+}
+
+func TestOTelExportError(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	exporter := &fakeExporter{err: errUnavailable}
+	reported := make(chan error, 1)
+	core := NewOTelCore(exporter, Config{
+		OTelBatchSize:      1,
+		OTelExportInterval: time.Hour,
+		OnError: func(err error) {
+			select {
+			case reported <- err:
+			default:
+			}
+		},
+	})
+	defer core.Close()
+
+	// Errors of background exports are reported.
+	if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-reported:
+		if !errors.Is(err, errUnavailable) {
+			t.Errorf("reported error = %v, want %v", err, errUnavailable)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("background export error not reported")
+	}
+
+	// Errors of flushes are returned.
+	s := newOTelSink(exporter, Config{OTelExportInterval: time.Hour})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s.Log(logging.Entry{Payload: "hello"})
+	if err := s.Flush(); !errors.Is(err, errUnavailable) {
+		t.Errorf("Flush() error = %v, want %v", err, errUnavailable)
+	}
+}
+
+func TestOTelClose(t *testing.T) {
+	exporter := &fakeExporter{}
+	core := NewOTelCore(exporter, Config{OTelExportInterval: time.Hour})
+	if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := core.out.(*otelSink)
+	select {
+	case <-s.done:
+	default:
+		t.Fatal("background goroutine still running after Close")
+	}
+	if got := len(exporter.Records()); got != 1 {
+		t.Errorf("got %d records after Close, want the buffered record", got)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestOTelCloseAsync(t *testing.T) {
+	exporter := &fakeExporter{}
+	core := NewOTelCore(exporter, Config{AsyncBufferSize: 8, OTelExportInterval: time.Hour})
+	if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing the async sink closes the OpenTelemetry sink it writes to.
+	select {
+	case <-core.out.(*asyncSink).out.(*otelSink).done:
+	default:
+		t.Fatal("export goroutine still running after Close")
+	}
+	if got := len(exporter.Records()); got != 1 {
+		t.Errorf("got %d records after Close, want 1", got)
+	}
+}
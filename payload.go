@@ -0,0 +1,135 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// decodePayload decodes the given encoded JSON payload into a map.
+// Numbers are decoded as json.Number to preserve their precision.
+//
+// Parameters:
+// - encoded: The encoded payload.
+//
+// Returns:
+// - The decoded payload.
+// - An error if the payload could not be decoded, nil otherwise.
+func decodePayload(encoded []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	dec.UseNumber()
+
+	var payload map[string]interface{}
+	if err := dec.Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// validatePayload validates the given encoded payload using the given schema.
+//
+// Parameters:
+// - schema: The function validating the decoded payload.
+// - encoded: The encoded payload.
+//
+// Returns:
+// - An error if the payload could not be decoded or does not conform to the schema, nil otherwise.
+func validatePayload(schema func(map[string]interface{}) error, encoded []byte) error {
+	payload, err := decodePayload(encoded)
+	if err != nil {
+		return fmt.Errorf("gclzap: failed to decode payload for validation: %w", err)
+	}
+	if err := schema(payload); err != nil {
+		return fmt.Errorf("gclzap: payload does not conform to schema: %w", err)
+	}
+
+	return nil
+}
+
+// marshalPayload prepares the given encoded payload for the entry using the given marshaler.
+//
+// Parameters:
+// - marshaler: The function preparing the decoded payload.
+// - encoded: The encoded payload.
+//
+// Returns:
+// - The prepared payload.
+// - An error if the payload could not be decoded or prepared, nil otherwise.
+func marshalPayload(marshaler func(map[string]interface{}) (interface{}, error), encoded []byte) (interface{}, error) {
+	payload, err := decodePayload(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("gclzap: failed to decode payload for marshaling: %w", err)
+	}
+	prepared, err := marshaler(payload)
+	if err != nil {
+		return nil, fmt.Errorf("gclzap: failed to marshal payload: %w", err)
+	}
+
+	return prepared, nil
+}
+
+// unserializable is the placeholder for values that cannot be encoded as JSON.
+const unserializable = "<unserializable>"
+
+// Struct returns a zap.Field that adds the JSON encoding of the given value to the payload.
+// Unlike zap.Any, the value is encoded when the field is created, so that values
+// that cannot be encoded, e.g. cyclic structures, or whose encoding panics are replaced
+// by the "<unserializable>" placeholder instead of failing the entry.
+// Unexported struct fields are omitted, as with encoding/json.
+//
+// Parameters:
+// - key: The key of the field.
+// - v: The value to encode.
+//
+// Returns:
+// - A zap.Field holding the encoded value.
+func Struct(key string, v interface{}) zap.Field {
+	encoded, err := safeMarshal(v)
+	if err != nil {
+		return zap.String(key, unserializable)
+	}
+
+	return zap.Reflect(key, json.RawMessage(encoded))
+}
+
+// safeMarshal encodes the given value as JSON, recovering from panics during encoding.
+//
+// Parameters:
+// - v: The value to encode.
+//
+// Returns:
+// - The encoded value.
+// - An error if the value could not be encoded, nil otherwise.
+func safeMarshal(v interface{}) (encoded []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("gclzap: panic while encoding value: %v", r)
+		}
+	}()
+
+	return json.Marshal(v)
+}
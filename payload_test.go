@@ -0,0 +1,208 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestPayloadSchema(t *testing.T) {
+	requireOrderID := func(payload map[string]interface{}) error {
+		if _, ok := payload["order_id"]; !ok {
+			return errors.New("missing required key order_id")
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name        string
+		development bool
+		schema      func(map[string]interface{}) error
+		fields      []zapcore.Field
+		wantErr     bool
+	}{
+		{name: "no schema", development: true},
+		{name: "conforming payload", development: true, schema: requireOrderID, fields: []zapcore.Field{zap.String("order_id", "o-1")}},
+		{name: "missing required key", development: true, schema: requireOrderID, wantErr: true},
+		{name: "production mode skips validation", schema: requireOrderID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{Development: tt.development, PayloadSchema: tt.schema})
+			err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "order placed"}, tt.fields)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(out.Entries()) != 1 {
+				t.Fatalf("got %d entries, want the entry to be written regardless of validation", len(out.Entries()))
+			}
+		})
+	}
+}
+
+func TestValidatePayloadNumbers(t *testing.T) {
+	var got interface{}
+	schema := func(payload map[string]interface{}) error {
+		got = payload["id"]
+		return nil
+	}
+	if err := validatePayload(schema, []byte(`{"id":9007199254740993}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got != json.Number("9007199254740993") {
+		t.Errorf("id = %#v, want the exact json.Number", got)
+	}
+	if err := validatePayload(schema, []byte(`not json`)); err == nil {
+		t.Error("expected an error for an undecodable payload")
+	}
+}
+
+func TestPayloadMarshaler(t *testing.T) {
+	marshalErr := errors.New("unsupported payload")
+	stringifyIDs := func(payload map[string]interface{}) (interface{}, error) {
+		if id, ok := payload["id"].(json.Number); ok {
+			payload["id"] = "id-" + id.String()
+		}
+		return payload, nil
+	}
+
+	tests := []struct {
+		name       string
+		marshaler  func(map[string]interface{}) (interface{}, error)
+		wantID     interface{}
+		wantErrors int
+	}{
+		{name: "identity by default", wantID: float64(9)},
+		{name: "converts a field type", marshaler: stringifyIDs, wantID: "id-9"},
+		{
+			name:       "failure keeps the encoded payload",
+			marshaler:  func(map[string]interface{}) (interface{}, error) { return nil, marshalErr },
+			wantID:     float64(9),
+			wantErrors: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []error
+			out := &fakeSink{}
+			core := newCore(out, Config{PayloadMarshaler: tt.marshaler, OnError: func(err error) { errs = append(errs, err) }})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, []zapcore.Field{zap.Int("id", 9)}); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			var got interface{}
+			if prepared, ok := entry.Payload.(map[string]interface{}); ok {
+				got = prepared["id"]
+			} else {
+				got = payloadOf(t, entry)["id"]
+			}
+			if got != tt.wantID {
+				t.Errorf("id = %#v, want %#v", got, tt.wantID)
+			}
+			if len(errs) != tt.wantErrors {
+				t.Errorf("got %d errors, want %d: %v", len(errs), tt.wantErrors, errs)
+			}
+			for _, err := range errs {
+				if !errors.Is(err, marshalErr) {
+					t.Errorf("error = %v, want it to wrap %v", err, marshalErr)
+				}
+			}
+		})
+	}
+}
+
+// node is a linked structure that may contain cycles.
+type node struct {
+	Name string `json:"name"`
+	Next *node  `json:"next,omitempty"`
+}
+
+// panickingValue is a value whose JSON encoding panics.
+type panickingValue struct{}
+
+// MarshalJSON panics.
+//
+// Returns:
+// - Never returns.
+func (panickingValue) MarshalJSON() ([]byte, error) {
+	panic("broken marshaler")
+}
+
+func TestStruct(t *testing.T) {
+	type order struct {
+		ID     string `json:"id"`
+		Amount int    `json:"amount"`
+		secret string
+	}
+	cyclic := &node{Name: "a"}
+	cyclic.Next = &node{Name: "b", Next: cyclic}
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{
+			name:  "struct",
+			value: order{ID: "o-1", Amount: 3, secret: "hidden"},
+			want:  map[string]interface{}{"id": "o-1", "amount": float64(3)},
+		},
+		{
+			name:  "linked structure",
+			value: &node{Name: "a", Next: &node{Name: "b"}},
+			want:  map[string]interface{}{"name": "a", "next": map[string]interface{}{"name": "b"}},
+		},
+		{name: "nil", value: nil, want: nil},
+		{name: "cycle", value: cyclic, want: unserializable},
+		{name: "unsupported type", value: make(chan int), want: unserializable},
+		{name: "panicking marshaler", value: panickingValue{}, want: unserializable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, []zapcore.Field{Struct("value", tt.value)}); err != nil {
+				t.Fatal(err)
+			}
+
+			payload := payloadOf(t, out.Entries()[0])
+			got, ok := payload["value"]
+			if !ok {
+				t.Fatal("value missing from the payload")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("value = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/logging"
+)
+
+// syncSink is implemented by sinks that can write a single entry synchronously,
+// such as *logging.Logger.
+type syncSink interface {
+	LogSync(ctx context.Context, e logging.Entry) error
+}
+
+// pingPayload is the payload of the entries written by Ping.
+const pingPayload = "gclzap ping"
+
+// Ping verifies that the Core can reach its destination, e.g. for readiness probes,
+// by writing a DEBUG entry and waiting for it to be written.
+// The entry is written synchronously if the destination supports it, e.g. Google Cloud Logging,
+// and by writing and flushing otherwise.
+//
+// Parameters:
+// - ctx: The context bounding the ping.
+//
+// Returns:
+// - An error if the entry could not be written before the context is done, nil otherwise.
+func (c *Core) Ping(ctx context.Context) error {
+	entry := logging.Entry{
+		Timestamp: c.now().UTC(),
+		Severity:  logging.Debug,
+		Payload:   pingPayload,
+	}
+
+	if out, ok := c.out.(syncSink); ok {
+		if err := out.LogSync(ctx, entry); err != nil {
+			return fmt.Errorf("gclzap: ping failed: %w", err)
+		}
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		c.out.Log(entry)
+		done <- c.out.Flush()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("gclzap: ping failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("gclzap: ping failed: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// syncFakeSink is a fake sink that also writes entries synchronously.
+type syncFakeSink struct {
+	fakeSink
+	syncErr error
+}
+
+// LogSync records the given entry and returns the configured error.
+//
+// Parameters:
+// - ctx: The context of the write.
+// - e: The entry to record.
+//
+// Returns:
+// - The configured error.
+func (s *syncFakeSink) LogSync(ctx context.Context, e logging.Entry) error {
+	if s.syncErr != nil {
+		return s.syncErr
+	}
+	s.fakeSink.Log(e)
+	return nil
+}
+
+func TestPing(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		out  interface {
+			sink
+			Entries() []logging.Entry
+		}
+		wantErr     error
+		wantFlushes int
+	}{
+		{name: "flushing sink", out: &fakeSink{}, wantFlushes: 1},
+		{name: "failing flush", out: &fakeSink{flushErr: errUnavailable}, wantErr: errUnavailable, wantFlushes: 1},
+		{name: "sync sink", out: &syncFakeSink{}},
+		{name: "failing sync sink", out: &syncFakeSink{syncErr: errUnavailable}, wantErr: errUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core := newCore(tt.out, Config{Clock: fixedClock{now}})
+			err := core.Ping(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Ping() error = %v, want %v", err, tt.wantErr)
+			}
+
+			entries := tt.out.Entries()
+			if tt.wantErr != nil && len(entries) == 0 {
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			entry := entries[0]
+			if entry.Payload != pingPayload || entry.Severity != logging.Debug || !entry.Timestamp.Equal(now) {
+				t.Errorf("entry = %+v, want a DEBUG ping entry at %v", entry, now)
+			}
+			if f, ok := tt.out.(*fakeSink); ok && f.Flushes() != tt.wantFlushes {
+				t.Errorf("got %d flushes, want %d", f.Flushes(), tt.wantFlushes)
+			}
+		})
+	}
+}
+
+func TestPingContextDone(t *testing.T) {
+	out := &blockingSink{release: make(chan struct{})}
+	t.Cleanup(func() { close(out.release) })
+	core := newCore(out, Config{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := core.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Ping() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestPingLogger(t *testing.T) {
+	logger, server := newFakeLogger(t)
+	core := newCore(logger, Config{})
+
+	if err := core.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The entry is written synchronously, without flushing the logger.
+	entries := server.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if got := entries[0].GetTextPayload(); got != pingPayload {
+		t.Errorf("payload = %q, want %q", got, pingPayload)
+	}
+	if got := logging.Severity(entries[0].GetSeverity()); got != logging.Debug {
+		t.Errorf("severity = %v, want %v", got, logging.Debug)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/pubsub"
+)
+
+// NewPubSubCore creates a new Core that publishes logs to the given Pub/Sub topic
+// instead of writing them to Google Cloud Logging.
+// Each entry is published as a message whose data is the encoded payload.
+// The severity and the labels of the entry are set as message attributes.
+//
+// Parameters:
+// - topic: The Pub/Sub topic to publish logs to.
+// - config: The configuration for the Core.
+//
+// Returns:
+// - A new Core that publishes logs to the given topic.
+func NewPubSubCore(topic *pubsub.Topic, config Config) *Core {
+	return newCore(&pubsubSink{topic: topic}, config)
+}
+
+// Limits of the pending publish results and errors of a pubsubSink.
+const (
+	// minPubSubPrune is the minimum number of pending results before completed results are pruned.
+	minPubSubPrune = 64
+
+	// maxPubSubErrors is the maximum number of publish errors kept until the next flush.
+	maxPubSubErrors = 16
+)
+
+// pubsubSink is a sink that publishes entries to a Pub/Sub topic.
+// Completed publish results are pruned while logging, so that memory is bounded
+// by the messages in flight rather than by the messages published since the last flush.
+type pubsubSink struct {
+	topic *pubsub.Topic
+
+	mu      sync.Mutex
+	results []*pubsub.PublishResult
+	prune   int
+	errs    []error
+	omitted int
+}
+
+// Log publishes the given entry to the topic.
+// Publishing is asynchronous, errors are reported by Flush.
+//
+// Parameters:
+// - e: The entry to publish.
+func (s *pubsubSink) Log(e logging.Entry) {
+	attributes := make(map[string]string, len(e.Labels)+1)
+	for k, v := range e.Labels {
+		attributes[k] = v
+	}
+	attributes["severity"] = severityName(e.Severity)
+
+	result := s.topic.Publish(context.Background(), &pubsub.Message{
+		Data:       payloadBytes(e.Payload),
+		Attributes: attributes,
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, result)
+	if len(s.results) >= max(s.prune, minPubSubPrune) {
+		s.pruneResults()
+		// Pruning again once the pending results have doubled keeps the cost amortized constant.
+		s.prune = 2 * len(s.results)
+	}
+}
+
+// pruneResults removes the completed results and records their errors.
+// The caller must hold the lock.
+func (s *pubsubSink) pruneResults() {
+	pending := s.results[:0]
+	for _, result := range s.results {
+		select {
+		case <-result.Ready():
+			s.record(result)
+		default:
+			pending = append(pending, result)
+		}
+	}
+	clear(s.results[len(pending):])
+	s.results = pending
+}
+
+// record records the error of the given completed result, if any.
+// The caller must hold the lock.
+//
+// Parameters:
+// - result: The completed result.
+func (s *pubsubSink) record(result *pubsub.PublishResult) {
+	if _, err := result.Get(context.Background()); err != nil {
+		s.addError(err)
+	}
+}
+
+// addError records the given publish error.
+// At most maxPubSubErrors errors are kept, further errors are only counted.
+// The caller must hold the lock.
+//
+// Parameters:
+// - err: The publish error.
+func (s *pubsubSink) addError(err error) {
+	if len(s.errs) < maxPubSubErrors {
+		s.errs = append(s.errs, err)
+	} else {
+		s.omitted++
+	}
+}
+
+// Flush waits until all published messages have been sent.
+//
+// Returns:
+// - An error if any message published since the last flush could not be published, nil otherwise.
+func (s *pubsubSink) Flush() error {
+	s.topic.Flush()
+
+	s.mu.Lock()
+	results := s.results
+	s.results, s.prune = nil, 0
+	s.mu.Unlock()
+
+	// The results are awaited without holding the lock, so that concurrent writes do not block.
+	var failed []error
+	for _, result := range results {
+		if _, err := result.Get(context.Background()); err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, err := range failed {
+		s.addError(err)
+	}
+	errs := s.errs
+	if s.omitted > 0 {
+		errs = append(errs, fmt.Errorf("gclzap: %d more messages could not be published", s.omitted))
+	}
+	s.errs, s.omitted = nil, 0
+
+	return errors.Join(errs...)
+}
+
+// payloadBytes returns the raw bytes of the given entry payload.
+//
+// Parameters:
+// - payload: The payload of a logging.Entry.
+//
+// Returns:
+// - The raw bytes of the payload.
+func payloadBytes(payload interface{}) []byte {
+	switch p := payload.(type) {
+	case string:
+		return []byte(p)
+	case []byte:
+		return p
+	case json.RawMessage:
+		return p
+	default:
+		b, err := json.Marshal(p)
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+}
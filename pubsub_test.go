@@ -0,0 +1,173 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// newFakeTopic starts a fake Pub/Sub server and returns a topic on it.
+// The server and the client are stopped when the test ends.
+//
+// Parameters:
+// - t: The test.
+//
+// Returns:
+// - The topic.
+// - The fake server.
+func newFakeTopic(t *testing.T) (*pubsub.Topic, *pstest.Server) {
+	t.Helper()
+	server := pstest.NewServer()
+	t.Cleanup(func() { _ = server.Close() })
+
+	ctx := context.Background()
+	client, err := pubsub.NewClient(ctx, "test",
+		option.WithEndpoint(server.Addr),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	topic, err := client.CreateTopic(ctx, "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(topic.Stop)
+
+	return topic, server
+}
+
+func TestPubSubCore(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     zapcore.Level
+		fields    []zapcore.Field
+		wantAttrs map[string]string
+	}{
+		{
+			name:      "severity attribute",
+			level:     zapcore.WarnLevel,
+			wantAttrs: map[string]string{"severity": "WARNING"},
+		},
+		{
+			name:      "labels as attributes",
+			level:     zapcore.InfoLevel,
+			fields:    []zapcore.Field{Label("team", "core")},
+			wantAttrs: map[string]string{"severity": "INFO", "team": "core"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topic, server := newFakeTopic(t)
+			core := NewPubSubCore(topic, Config{})
+			if err := core.Write(zapcore.Entry{Level: tt.level, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+			if err := core.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			messages := server.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("got %d messages, want 1", len(messages))
+			}
+			if len(messages[0].Attributes) != len(tt.wantAttrs) {
+				t.Errorf("attributes = %v, want %v", messages[0].Attributes, tt.wantAttrs)
+			}
+			for k, v := range tt.wantAttrs {
+				if got := messages[0].Attributes[k]; got != v {
+					t.Errorf("attribute %q = %q, want %q", k, got, v)
+				}
+			}
+			var data map[string]interface{}
+			if err := json.Unmarshal(messages[0].Data, &data); err != nil {
+				t.Fatalf("invalid data %s: %v", messages[0].Data, err)
+			}
+			if data["message"] != "hello" {
+				t.Errorf("message = %v, want %q", data["message"], "hello")
+			}
+		})
+	}
+}
+
+func TestPubSubSinkPrunesResults(t *testing.T) {
+	topic, _ := newFakeTopic(t)
+	s := &pubsubSink{topic: topic}
+	core := newCore(s, Config{})
+
+	const n = 10 * minPubSubPrune
+	for i := 0; i < n; i++ {
+		if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if i%minPubSubPrune == 0 {
+			// Publish the pending messages, without flushing the sink.
+			topic.Flush()
+		}
+	}
+
+	s.mu.Lock()
+	pending := len(s.results)
+	s.mu.Unlock()
+	if pending >= n/2 {
+		t.Errorf("%d results pending after %d writes, want completed results to be pruned", pending, n)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.results) != 0 {
+		t.Errorf("%d results pending after flush, want 0", len(s.results))
+	}
+}
+
+func TestPubSubSinkFlushError(t *testing.T) {
+	topic, _ := newFakeTopic(t)
+	if err := topic.Delete(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	core := NewPubSubCore(topic, Config{})
+
+	for i := 0; i < maxPubSubErrors+2; i++ {
+		if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := core.Sync(); err == nil {
+		t.Fatal("Sync succeeded, want an error for the deleted topic")
+	}
+	if err := core.Sync(); err != nil {
+		t.Errorf("second Sync returned %v, want errors to be reported once", err)
+	}
+}
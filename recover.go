@@ -0,0 +1,108 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// reportedErrorEventType is the payload type that marks an entry for Cloud Error Reporting.
+const reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+// RecoverAndLog recovers a panic, logs it with its stack trace, and panics again
+// with the recovered value. It must be deferred directly:
+//
+//	defer gclzap.RecoverAndLog(logger)
+//
+// The entry is marked for Cloud Error Reporting.
+//
+// Parameters:
+// - logger: The logger to log the panic to.
+func RecoverAndLog(logger *zap.Logger) {
+	// recover only stops a panic if called directly by the deferred function.
+	if r := recover(); r != nil {
+		logPanic(logger, r)
+		panic(r)
+	}
+}
+
+// RecoverAndContinue recovers a panic and logs it with its stack trace,
+// without panicking again. It must be deferred directly:
+//
+//	defer gclzap.RecoverAndContinue(logger)
+//
+// The entry is marked for Cloud Error Reporting.
+//
+// Parameters:
+// - logger: The logger to log the panic to.
+func RecoverAndContinue(logger *zap.Logger) {
+	// recover only stops a panic if called directly by the deferred function.
+	if r := recover(); r != nil {
+		logPanic(logger, r)
+	}
+}
+
+// panicValue is a zapcore.ObjectMarshaler for a value recovered from a panic.
+type panicValue struct {
+	recovered interface{}
+}
+
+// MarshalLogObject adds the Go type and the string representation
+// of the recovered value to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the recovered value to.
+//
+// Returns:
+// - Always nil.
+func (p panicValue) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("type", fmt.Sprintf("%T", p.recovered))
+	switch v := p.recovered.(type) {
+	case error:
+		enc.AddString("value", v.Error())
+	case string:
+		enc.AddString("value", v)
+	default:
+		enc.AddString("value", fmt.Sprint(v))
+	}
+	return nil
+}
+
+// logPanic logs the given recovered value at ErrorLevel,
+// with the stack trace and the Cloud Error Reporting type.
+// The Go type and the value of the panic are recorded separately
+// in a nested "panic" object, so that panics can be grouped by type.
+//
+// Parameters:
+// - logger: The logger to log the panic to.
+// - recovered: The value recovered from the panic.
+func logPanic(logger *zap.Logger, recovered interface{}) {
+	logger.Error(fmt.Sprintf("panic: %v", recovered),
+		Type(reportedErrorEventType),
+		zap.Object("panic", panicValue{recovered: recovered}),
+		zap.String("stack_trace", string(debug.Stack())),
+	)
+}
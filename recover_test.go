@@ -0,0 +1,173 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name      string
+		recover   func(*zap.Logger)
+		value     interface{}
+		repanic   bool
+		wantPanic map[string]interface{}
+		wantLogs  int
+	}{
+		{
+			name:      "string value",
+			recover:   RecoverAndContinue,
+			value:     "boom",
+			wantPanic: map[string]interface{}{"type": "string", "value": "boom"},
+			wantLogs:  1,
+		},
+		{
+			name:      "error value",
+			recover:   RecoverAndContinue,
+			value:     errors.New("bad state"),
+			wantPanic: map[string]interface{}{"type": "*errors.errorString", "value": "bad state"},
+			wantLogs:  1,
+		},
+		{
+			name:      "re-panics",
+			recover:   RecoverAndLog,
+			value:     42,
+			repanic:   true,
+			wantPanic: map[string]interface{}{"type": "int", "value": "42"},
+			wantLogs:  1,
+		},
+		{name: "no panic", recover: RecoverAndLog},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			logger := zap.New(newCore(out, Config{EncoderConfig: DefaultEncoderConfig()}))
+
+			var repanicked interface{}
+			func() {
+				defer func() { repanicked = recover() }()
+				func() {
+					defer tt.recover(logger)
+					if tt.value != nil {
+						panic(tt.value)
+					}
+				}()
+			}()
+
+			if tt.repanic && repanicked != tt.value {
+				t.Errorf("re-panicked with %v, want %v", repanicked, tt.value)
+			}
+			if !tt.repanic && repanicked != nil {
+				t.Errorf("unexpected panic %v", repanicked)
+			}
+			entries := out.Entries()
+			if len(entries) != tt.wantLogs {
+				t.Fatalf("got %d entries, want %d", len(entries), tt.wantLogs)
+			}
+			if tt.wantLogs == 0 {
+				return
+			}
+
+			entry := entries[0]
+			if entry.Severity != logging.Error {
+				t.Errorf("severity = %v, want %v", entry.Severity, logging.Error)
+			}
+			payload := payloadOf(t, entry)
+			if payload["@type"] != reportedErrorEventType {
+				t.Errorf("@type = %v, want %v", payload["@type"], reportedErrorEventType)
+			}
+			if !reflect.DeepEqual(payload["panic"], tt.wantPanic) {
+				t.Errorf("panic = %#v, want %#v", payload["panic"], tt.wantPanic)
+			}
+			if stack, _ := payload["stack_trace"].(string); !strings.Contains(stack, "recover_test.go") {
+				t.Errorf("stack_trace = %q, want the panicking frame", stack)
+			}
+		})
+	}
+}
+
+// codedError is an error type used to check the recorded panic type.
+type codedError struct {
+	code int
+}
+
+// Error returns the message of the error.
+//
+// Returns:
+// - The message of the error.
+func (e *codedError) Error() string {
+	return "code " + strconv.Itoa(e.code)
+}
+
+func TestPanicValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		recovered interface{}
+		wantType  string
+		wantValue string
+	}{
+		{name: "string", recovered: "boom", wantType: "string", wantValue: "boom"},
+		{name: "custom error", recovered: &codedError{code: 7}, wantType: "*gclzap.codedError", wantValue: "code 7"},
+		{name: "wrapped error", recovered: fmt.Errorf("saving: %w", &codedError{code: 7}), wantType: "*fmt.wrapError", wantValue: "saving: code 7"},
+		{name: "struct", recovered: struct{ ID int }{ID: 3}, wantType: "struct { ID int }", wantValue: "{3}"},
+		{name: "runtime error", recovered: runtimePanic(), wantType: "runtime.boundsError", wantValue: "runtime error: index out of range [3] with length 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := zapcore.NewMapObjectEncoder()
+			if err := (panicValue{recovered: tt.recovered}).MarshalLogObject(enc); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := enc.Fields["type"]; got != tt.wantType {
+				t.Errorf("type = %v, want %q", got, tt.wantType)
+			}
+			if got := enc.Fields["value"]; got != tt.wantValue {
+				t.Errorf("value = %v, want %q", got, tt.wantValue)
+			}
+		})
+	}
+}
+
+// runtimePanic returns the value recovered from an index out of range panic.
+//
+// Returns:
+// - The recovered value.
+func runtimePanic() (recovered interface{}) {
+	defer func() { recovered = recover() }()
+	s := []int{1}
+	i := 3
+	_ = s[i]
+	return nil
+}
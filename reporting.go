@@ -0,0 +1,145 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// errorContextField is the value of a field created by ErrorContext.
+type errorContextField struct {
+	user    string
+	request *logging.HTTPRequest
+}
+
+// apply sets the user and the HTTP request on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (e errorContextField) apply(_ string, meta *entryMeta) {
+	if e.user != "" {
+		meta.user = e.user
+	}
+	if e.request != nil {
+		meta.httpRequest = e.request
+	}
+}
+
+// ErrorContext returns a zap.Field that populates the "context" object
+// Cloud Error Reporting expects on error entries.
+// The context object is only written if Config.EnableContextObject is set.
+// The request, if not nil, is also set as the HTTP request of the entry.
+//
+// Parameters:
+// - user: The user who encountered the error, may be empty.
+// - request: The HTTP request that caused the error, may be nil.
+//
+// Returns:
+// - A zap.Field that populates the error context of the entry.
+func ErrorContext(user string, request *logging.HTTPRequest) zap.Field {
+	return special("context", errorContextField{user: user, request: request})
+}
+
+// errorContext is the "context" object of an error entry
+// as expected by Cloud Error Reporting.
+type errorContext struct {
+	user    string
+	request *logging.HTTPRequest
+	caller  zapcore.EntryCaller
+}
+
+// MarshalLogObject adds the error context to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the error context to.
+//
+// Returns:
+// - An error if the error context could not be encoded, nil otherwise.
+func (c errorContext) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if c.request != nil && c.request.Request != nil {
+		if err := enc.AddObject("httpRequest", reportedHTTPRequest{c.request}); err != nil {
+			return err
+		}
+	}
+	if c.user != "" {
+		enc.AddString("user", c.user)
+	}
+	if c.caller.Defined {
+		return enc.AddObject("reportLocation", reportLocation(c.caller))
+	}
+	return nil
+}
+
+// reportedHTTPRequest is the HTTP request of an error context.
+type reportedHTTPRequest struct {
+	request *logging.HTTPRequest
+}
+
+// MarshalLogObject adds the HTTP request to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the HTTP request to.
+//
+// Returns:
+// - Always nil.
+func (r reportedHTTPRequest) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	req := r.request.Request
+	enc.AddString("method", req.Method)
+	if req.URL != nil {
+		enc.AddString("url", req.URL.String())
+	}
+	if ua := req.UserAgent(); ua != "" {
+		enc.AddString("userAgent", ua)
+	}
+	if referrer := req.Referer(); referrer != "" {
+		enc.AddString("referrer", referrer)
+	}
+	if r.request.Status != 0 {
+		enc.AddInt("responseStatusCode", r.request.Status)
+	}
+	if r.request.RemoteIP != "" {
+		enc.AddString("remoteIp", r.request.RemoteIP)
+	}
+	return nil
+}
+
+// reportLocation is the location in the source code where an error was reported.
+type reportLocation zapcore.EntryCaller
+
+// MarshalLogObject adds the report location to the given encoder.
+//
+// Parameters:
+// - enc: The encoder to add the report location to.
+//
+// Returns:
+// - Always nil.
+func (l reportLocation) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("filePath", l.File)
+	enc.AddInt("lineNumber", l.Line)
+	if l.Function != "" {
+		enc.AddString("functionName", l.Function)
+	}
+	return nil
+}
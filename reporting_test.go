@@ -0,0 +1,108 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestErrorContext(t *testing.T) {
+	r := httptest.NewRequest("GET", "https://example.com/users?id=1", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	request := &logging.HTTPRequest{Request: r, Status: 500, RemoteIP: "10.0.0.1"}
+	caller := zapcore.EntryCaller{Defined: true, File: "/src/app/main.go", Line: 42, Function: "main.run"}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		level   zapcore.Level
+		fields  []zapcore.Field
+		want    interface{}
+	}{
+		{
+			name:    "full context",
+			enabled: true,
+			level:   zapcore.ErrorLevel,
+			fields:  []zapcore.Field{ErrorContext("alice", request)},
+			want: map[string]interface{}{
+				"httpRequest": map[string]interface{}{
+					"method":             "GET",
+					"url":                "https://example.com/users?id=1",
+					"userAgent":          "test-agent",
+					"responseStatusCode": float64(500),
+					"remoteIp":           "10.0.0.1",
+				},
+				"user": "alice",
+				"reportLocation": map[string]interface{}{
+					"filePath":     "/src/app/main.go",
+					"lineNumber":   float64(42),
+					"functionName": "main.run",
+				},
+			},
+		},
+		{
+			name:    "report location only",
+			enabled: true,
+			level:   zapcore.ErrorLevel,
+			want: map[string]interface{}{
+				"reportLocation": map[string]interface{}{
+					"filePath":     "/src/app/main.go",
+					"lineNumber":   float64(42),
+					"functionName": "main.run",
+				},
+			},
+		},
+		{
+			name:    "below error level",
+			enabled: true,
+			level:   zapcore.WarnLevel,
+			fields:  []zapcore.Field{ErrorContext("alice", nil)},
+		},
+		{
+			name:    "disabled",
+			enabled: false,
+			level:   zapcore.ErrorLevel,
+			fields:  []zapcore.Field{ErrorContext("alice", nil)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{EncoderConfig: DefaultEncoderConfig(), EnableContextObject: tt.enabled})
+			ent := zapcore.Entry{Level: tt.level, Message: "failed", Caller: caller}
+			if err := core.Write(ent, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			got := payloadOf(t, out.Entries()[0])["context"]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("context = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// InstallSignalFlush flushes the given logger whenever one of the given signals arrives,
+// e.g. on SIGTERM when Cloud Run or GKE shuts the instance down. If no signals are given,
+// SIGTERM is used. After flushing, onSignal is called with the signal, if it is not nil.
+//
+// The signal is not raised again: as with signal.Notify, the default behavior of the signals,
+// e.g. terminating the process, no longer applies while the handler is installed.
+// The application is expected to shut down itself, e.g. from onSignal or from its own
+// signal.NotifyContext, which still receives the signals.
+//
+// Parameters:
+// - logger: The logger to flush.
+// - onSignal: The function called with the signal after flushing, may be nil.
+// - signals: The signals to flush on.
+//
+// Returns:
+// - A function that removes the handler. It is safe to call multiple times, also from onSignal.
+func InstallSignalFlush(logger *zap.Logger, onSignal func(os.Signal), signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	return handleSignals(ch, logger, onSignal, func() { signal.Stop(ch) })
+}
+
+// handleSignals flushes the given logger and calls onSignal for every signal received
+// on the given channel, until the returned function is called.
+//
+// Parameters:
+// - ch: The channel the signals are received on.
+// - logger: The logger to flush.
+// - onSignal: The function called with the signal after flushing, may be nil.
+// - unregister: The function that stops the delivery of signals to ch.
+//
+// Returns:
+// - A function that unregisters the channel and stops handling signals.
+func handleSignals(ch <-chan os.Signal, logger *zap.Logger, onSignal func(os.Signal), unregister func()) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			unregister()
+			close(done)
+		})
+	}
+
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				_ = logger.Sync()
+				if onSignal != nil {
+					onSignal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return stop
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// waitFlushes waits until the given sink has been flushed n times.
+//
+// Parameters:
+// - t: The test.
+// - s: The sink.
+// - n: The number of flushes to wait for.
+func waitFlushes(t *testing.T, s *fakeSink, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for s.Flushes() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d flushes, want %d", s.Flushes(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandleSignals(t *testing.T) {
+	tests := []struct {
+		name     string
+		signals  []os.Signal
+		onSignal bool
+	}{
+		{name: "flush only", signals: []os.Signal{syscall.SIGTERM}},
+		{name: "callback", signals: []os.Signal{syscall.SIGTERM}, onSignal: true},
+		{name: "repeated signals", signals: []os.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGTERM}, onSignal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			var mu sync.Mutex
+			var received []os.Signal
+			var onSignal func(os.Signal)
+			if tt.onSignal {
+				onSignal = func(sig os.Signal) {
+					// The logger is flushed before the callback.
+					if out.Flushes() == len(received) {
+						t.Errorf("callback for %v called before the flush", sig)
+					}
+					mu.Lock()
+					received = append(received, sig)
+					mu.Unlock()
+				}
+			}
+
+			ch := make(chan os.Signal)
+			stop := handleSignals(ch, zap.New(newCore(out, Config{})), onSignal, func() {})
+			defer stop()
+			for _, sig := range tt.signals {
+				ch <- sig
+			}
+			waitFlushes(t, out, len(tt.signals))
+
+			if !tt.onSignal {
+				return
+			}
+			deadline := time.Now().Add(time.Second)
+			for {
+				mu.Lock()
+				n := len(received)
+				mu.Unlock()
+				if n == len(tt.signals) {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("callback called %d times, want %d", n, len(tt.signals))
+				}
+				time.Sleep(time.Millisecond)
+			}
+			for i, sig := range tt.signals {
+				if received[i] != sig {
+					t.Errorf("callback %d received %v, want %v", i, received[i], sig)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleSignalsStop(t *testing.T) {
+	out := &fakeSink{}
+	unregistered := 0
+	ch := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	var stop func()
+	stop = handleSignals(ch, zap.New(newCore(out, Config{})), func(os.Signal) {
+		// Stopping from the callback must not deadlock.
+		stop()
+		close(stopped)
+	}, func() { unregistered++ })
+
+	ch <- syscall.SIGTERM
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("callback not called")
+	}
+	stop()
+	if unregistered != 1 {
+		t.Errorf("unregistered %d times, want 1", unregistered)
+	}
+
+	// Signals after stop are not handled.
+	ch <- syscall.SIGTERM
+	time.Sleep(10 * time.Millisecond)
+	if got := out.Flushes(); got != 1 {
+		t.Errorf("got %d flushes, want 1", got)
+	}
+}
+
+func TestInstallSignalFlush(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent to the own process on Windows")
+	}
+
+	out := &fakeSink{}
+	received := make(chan os.Signal, 1)
+	stop := InstallSignalFlush(zap.New(newCore(out, Config{})), func(sig os.Signal) { received <- sig }, syscall.SIGHUP)
+	defer stop()
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	// The process is not terminated, as the signal is not raised again.
+	select {
+	case sig := <-received:
+		if sig != syscall.SIGHUP {
+			t.Errorf("received %v, want %v", sig, syscall.SIGHUP)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal not handled")
+	}
+	if got := out.Flushes(); got != 1 {
+		t.Errorf("got %d flushes, want 1", got)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// fakeSink is a sink recording the entries written to it.
+type fakeSink struct {
+	mu       sync.Mutex
+	entries  []logging.Entry
+	flushes  int
+	flushErr error
+}
+
+// Log records the given entry.
+//
+// Parameters:
+// - e: The entry to record.
+func (s *fakeSink) Log(e logging.Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+}
+
+// Flush counts the flush and returns the configured error.
+//
+// Returns:
+// - The configured flush error.
+func (s *fakeSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	return s.flushErr
+}
+
+// Entries returns a copy of the recorded entries.
+//
+// Returns:
+// - The recorded entries.
+func (s *fakeSink) Entries() []logging.Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]logging.Entry(nil), s.entries...)
+}
+
+// Flushes returns the number of flushes.
+//
+// Returns:
+// - The number of flushes.
+func (s *fakeSink) Flushes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushes
+}
+
+// waitEntries waits until the sink has recorded at least n entries, failing the test after a second.
+//
+// Parameters:
+// - t: The test.
+// - s: The sink to wait for.
+// - n: The number of entries to wait for.
+//
+// Returns:
+// - The recorded entries.
+func waitEntries(t *testing.T, s *fakeSink, n int) []logging.Entry {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		entries := s.Entries()
+		if len(entries) >= n {
+			return entries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d entries, want %d", len(entries), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// payloadOf decodes the JSON payload of the given entry.
+//
+// Parameters:
+// - t: The test.
+// - e: The entry to decode the payload of.
+//
+// Returns:
+// - The decoded payload.
+func payloadOf(t *testing.T, e logging.Entry) map[string]interface{} {
+	t.Helper()
+	raw, ok := e.Payload.(json.RawMessage)
+	if !ok {
+		t.Fatalf("payload is %T, want json.RawMessage", e.Payload)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		t.Fatalf("invalid payload %s: %v", raw, err)
+	}
+	return payload
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"sync/atomic"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap/zapcore"
+)
+
+// severityCount is the number of distinct standard severities, DEFAULT to EMERGENCY.
+const severityCount = int(logging.Emergency/100) + 1
+
+// stats counts the entries written by a Core by severity.
+// It is shared between a Core and all of its clones.
+type stats struct {
+	counts [severityCount]atomic.Uint64
+}
+
+// add counts an entry with the given severity.
+// Non-standard severities are counted as the next lower standard severity.
+//
+// Parameters:
+// - severity: The severity of the entry.
+func (s *stats) add(severity logging.Severity) {
+	i := int(severity / 100)
+	if i < 0 {
+		i = 0
+	}
+	if i >= severityCount {
+		i = severityCount - 1
+	}
+	s.counts[i].Add(1)
+}
+
+// snapshot returns the current counts.
+//
+// Returns:
+// - The number of entries written by severity, omitting severities without entries.
+func (s *stats) snapshot() SeverityCounts {
+	counts := make(SeverityCounts)
+	for i := range s.counts {
+		if n := s.counts[i].Load(); n > 0 {
+			counts[logging.Severity(i*100)] = n
+		}
+	}
+
+	return counts
+}
+
+// SeverityCounts is the number of entries written by severity.
+type SeverityCounts map[logging.Severity]uint64
+
+// MarshalLogObject adds the counts to the given encoder, keyed by severity name.
+//
+// Parameters:
+// - enc: The encoder to add the counts to.
+//
+// Returns:
+// - Always nil.
+func (c SeverityCounts) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for severity, n := range c {
+		enc.AddUint64(severityName(severity), n)
+	}
+	return nil
+}
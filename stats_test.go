@@ -0,0 +1,99 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestEmitSummaryOnClose(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		levels      []zapcore.Level
+		wantSummary map[string]interface{}
+	}{
+		{
+			name:    "counts by severity",
+			enabled: true,
+			levels:  []zapcore.Level{zapcore.InfoLevel, zapcore.InfoLevel, zapcore.InfoLevel, zapcore.WarnLevel, zapcore.ErrorLevel, zapcore.ErrorLevel},
+			wantSummary: map[string]interface{}{
+				"INFO":    float64(3),
+				"WARNING": float64(1),
+				"ERROR":   float64(2),
+			},
+		},
+		{
+			name:        "no entries",
+			enabled:     true,
+			wantSummary: map[string]interface{}{},
+		},
+		{
+			name:    "disabled",
+			enabled: false,
+			levels:  []zapcore.Level{zapcore.InfoLevel},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			logger := zap.New(newCore(out, Config{EmitSummaryOnClose: tt.enabled}))
+			// Entries of clones are counted as well.
+			child := logger.With(zap.String("component", "worker"))
+			for _, level := range tt.levels {
+				child.Check(level, "hello").Write()
+			}
+			for i := 0; i < 2; i++ {
+				if err := Close(logger); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			entries := out.Entries()
+			if tt.wantSummary == nil {
+				if len(entries) != len(tt.levels) {
+					t.Errorf("got %d entries, want no summary", len(entries))
+				}
+				return
+			}
+			if len(entries) != len(tt.levels)+1 {
+				t.Fatalf("got %d entries, want a single summary", len(entries))
+			}
+			payload := payloadOf(t, entries[len(entries)-1])
+			if payload["message"] != "log summary" {
+				t.Errorf("message = %v, want the summary", payload["message"])
+			}
+			got, ok := payload["entries"]
+			if !ok {
+				got = map[string]interface{}{}
+			}
+			if !reflect.DeepEqual(got, tt.wantSummary) {
+				t.Errorf("entries = %v, want %v", got, tt.wantSummary)
+			}
+		})
+	}
+}
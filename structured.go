@@ -0,0 +1,284 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Special keys of the structured logging format recognized by the logging agents,
+// e.g. on Cloud Run, GKE and with the Ops Agent.
+// https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
+const (
+	structuredTraceKey          = "logging.googleapis.com/trace"
+	structuredSpanIDKey         = "logging.googleapis.com/spanId"
+	structuredTraceSampledKey   = "logging.googleapis.com/trace_sampled"
+	structuredLabelsKey         = "logging.googleapis.com/labels"
+	structuredSourceLocationKey = "logging.googleapis.com/sourceLocation"
+	structuredInsertIDKey       = "logging.googleapis.com/insertId"
+	structuredOperationKey      = "logging.googleapis.com/operation"
+	structuredHTTPRequestKey    = "httpRequest"
+)
+
+// NewStderr creates a new zap.Logger that writes logs to standard error
+// in the Google Cloud Logging structured logging format, instead of calling the API.
+// Special fields, such as the trace, are inlined into the JSON using the keys
+// recognized by the logging agent, e.g. on Cloud Run.
+// No Google Cloud Logging client is required.
+//
+// Parameters:
+// - config: The configuration for the zap.Logger.
+//
+// Returns:
+// - A new zap.Logger that writes structured logs to standard error.
+func NewStderr(config Config) *zap.Logger {
+	core := newCore(newStructuredSink(zapcore.Lock(os.Stderr)), config)
+	logger := zap.New(core, config.Options()...)
+	logEffectiveConfig(logger, config)
+
+	return logger
+}
+
+// structuredSink is a sink that writes entries to a zapcore.WriteSyncer
+// in the Google Cloud Logging structured logging format.
+type structuredSink struct {
+	out zapcore.WriteSyncer
+}
+
+// newStructuredSink creates a new structuredSink writing to the given syncer.
+//
+// Parameters:
+// - out: The syncer to write entries to.
+//
+// Returns:
+// - A new structuredSink.
+func newStructuredSink(out zapcore.WriteSyncer) *structuredSink {
+	return &structuredSink{out: out}
+}
+
+// Log writes the given entry as a single line of JSON.
+// Entries that cannot be rendered are written as a line describing the error,
+// since the sink has no way of reporting errors.
+//
+// Parameters:
+// - e: The entry to write.
+func (s *structuredSink) Log(e logging.Entry) {
+	line, err := renderStructured(e)
+	if err != nil {
+		line = []byte(fmt.Sprintf("{\"severity\":\"ERROR\",\"message\":%q}\n", "gclzap: failed to render entry: "+err.Error()))
+	}
+	_, _ = s.out.Write(line)
+}
+
+// Flush syncs the underlying syncer.
+// Syncers that do not support syncing, such as pipes and terminals, are not considered failed.
+//
+// Returns:
+// - An error if the syncer could not be synced, nil otherwise.
+func (s *structuredSink) Flush() error {
+	if err := s.out.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
+
+// structuredKey is a special key and its value to be inlined into the JSON.
+type structuredKey struct {
+	key   string
+	value interface{}
+}
+
+// structuredKeys returns the special keys for the given entry.
+//
+// Parameters:
+// - e: The entry.
+//
+// Returns:
+// - The special keys to inline into the JSON of the entry.
+func structuredKeys(e logging.Entry) []structuredKey {
+	var keys []structuredKey
+	if e.Trace != "" {
+		keys = append(keys, structuredKey{structuredTraceKey, e.Trace})
+	}
+	if e.SpanID != "" {
+		keys = append(keys, structuredKey{structuredSpanIDKey, e.SpanID})
+	}
+	if e.TraceSampled {
+		keys = append(keys, structuredKey{structuredTraceSampledKey, true})
+	}
+	if len(e.Labels) > 0 {
+		keys = append(keys, structuredKey{structuredLabelsKey, e.Labels})
+	}
+	if loc := e.SourceLocation; loc != nil {
+		keys = append(keys, structuredKey{structuredSourceLocationKey, structuredSourceLocation{
+			File:     loc.GetFile(),
+			Line:     strconv.FormatInt(loc.GetLine(), 10),
+			Function: loc.GetFunction(),
+		}})
+	}
+	if e.InsertID != "" {
+		keys = append(keys, structuredKey{structuredInsertIDKey, e.InsertID})
+	}
+	if op := e.Operation; op != nil {
+		keys = append(keys, structuredKey{structuredOperationKey, structuredOperation{
+			ID:       op.GetId(),
+			Producer: op.GetProducer(),
+			First:    op.GetFirst(),
+			Last:     op.GetLast(),
+		}})
+	}
+	if r := e.HTTPRequest; r != nil {
+		keys = append(keys, structuredKey{structuredHTTPRequestKey, newStructuredHTTPRequest(r)})
+	}
+
+	return keys
+}
+
+// structuredSourceLocation is the JSON representation of a source location.
+type structuredSourceLocation struct {
+	File     string `json:"file,omitempty"`
+	Line     string `json:"line,omitempty"`
+	Function string `json:"function,omitempty"`
+}
+
+// structuredOperation is the JSON representation of an operation.
+type structuredOperation struct {
+	ID       string `json:"id,omitempty"`
+	Producer string `json:"producer,omitempty"`
+	First    bool   `json:"first,omitempty"`
+	Last     bool   `json:"last,omitempty"`
+}
+
+// structuredHTTPRequest is the JSON representation of an HTTP request.
+type structuredHTTPRequest struct {
+	RequestMethod                  string `json:"requestMethod,omitempty"`
+	RequestURL                     string `json:"requestUrl,omitempty"`
+	RequestSize                    string `json:"requestSize,omitempty"`
+	Status                         int    `json:"status,omitempty"`
+	ResponseSize                   string `json:"responseSize,omitempty"`
+	UserAgent                      string `json:"userAgent,omitempty"`
+	RemoteIP                       string `json:"remoteIp,omitempty"`
+	ServerIP                       string `json:"serverIp,omitempty"`
+	Referer                        string `json:"referer,omitempty"`
+	Latency                        string `json:"latency,omitempty"`
+	CacheLookup                    bool   `json:"cacheLookup,omitempty"`
+	CacheHit                       bool   `json:"cacheHit,omitempty"`
+	CacheValidatedWithOriginServer bool   `json:"cacheValidatedWithOriginServer,omitempty"`
+	CacheFillBytes                 string `json:"cacheFillBytes,omitempty"`
+	Protocol                       string `json:"protocol,omitempty"`
+}
+
+// newStructuredHTTPRequest converts the given HTTP request to its JSON representation.
+//
+// Parameters:
+// - r: The HTTP request to convert.
+//
+// Returns:
+// - The JSON representation of the HTTP request.
+func newStructuredHTTPRequest(r *logging.HTTPRequest) structuredHTTPRequest {
+	s := structuredHTTPRequest{
+		Status:                         r.Status,
+		RemoteIP:                       r.RemoteIP,
+		ServerIP:                       r.LocalIP,
+		CacheLookup:                    r.CacheLookup,
+		CacheHit:                       r.CacheHit,
+		CacheValidatedWithOriginServer: r.CacheValidatedWithOriginServer,
+	}
+	if r.RequestSize != 0 {
+		s.RequestSize = strconv.FormatInt(r.RequestSize, 10)
+	}
+	if r.ResponseSize != 0 {
+		s.ResponseSize = strconv.FormatInt(r.ResponseSize, 10)
+	}
+	if r.CacheFillBytes != 0 {
+		s.CacheFillBytes = strconv.FormatInt(r.CacheFillBytes, 10)
+	}
+	if r.Latency != 0 {
+		s.Latency = strconv.FormatFloat(r.Latency.Seconds(), 'f', -1, 64) + "s"
+	}
+	if req := r.Request; req != nil {
+		s.RequestMethod = req.Method
+		if req.URL != nil {
+			s.RequestURL = req.URL.String()
+		}
+		s.UserAgent = req.UserAgent()
+		s.Referer = req.Referer()
+		s.Protocol = req.Proto
+	}
+
+	return s
+}
+
+// renderStructured renders the given entry as a single line of JSON,
+// with the special keys inlined into the payload.
+// Text payloads are rendered as the "message" key, along with the severity.
+//
+// Parameters:
+// - e: The entry to render.
+//
+// Returns:
+// - The rendered line, including the trailing newline.
+// - An error if the entry could not be rendered, nil otherwise.
+func renderStructured(e logging.Entry) ([]byte, error) {
+	keys := structuredKeys(e)
+
+	var object []byte
+	if text, ok := e.Payload.(string); ok {
+		object = []byte("{}")
+		keys = append([]structuredKey{{"message", text}, {"severity", severityName(e.Severity)}}, keys...)
+	} else {
+		object = bytes.TrimSpace(payloadBytes(e.Payload))
+	}
+	if len(object) < 2 || object[0] != '{' || object[len(object)-1] != '}' {
+		return nil, fmt.Errorf("payload is not a JSON object")
+	}
+
+	line := append([]byte(nil), object[:len(object)-1]...)
+	empty := len(bytes.TrimSpace(line)) == 1
+	for _, k := range keys {
+		value, err := json.Marshal(k.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %q: %w", k.key, err)
+		}
+		if !empty {
+			line = append(line, ',')
+		}
+		empty = false
+
+		key, _ := json.Marshal(k.key)
+		line = append(line, key...)
+		line = append(line, ':')
+		line = append(line, value...)
+	}
+
+	return append(line, '}', '\n'), nil
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// captureStderr redirects standard error to a pipe while fn runs.
+//
+// Parameters:
+// - t: The test.
+// - fn: The function whose standard error output is captured.
+//
+// Returns:
+// - The JSON lines written to standard error.
+func captureStderr(t *testing.T, fn func()) []map[string]interface{} {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	done := make(chan []map[string]interface{})
+	go func() {
+		var lines []map[string]interface{}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				line = map[string]interface{}{"invalid": scanner.Text()}
+			}
+			lines = append(lines, line)
+		}
+		done <- lines
+	}()
+
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestNewStderr(t *testing.T) {
+	tests := []struct {
+		name   string
+		level  string
+		fields []zap.Field
+		want   map[string]interface{}
+	}{
+		{
+			name:  "severity",
+			level: "info",
+			want:  map[string]interface{}{"severity": "INFO", "message": "hello"},
+		},
+		{
+			name:   "trace",
+			level:  "error",
+			fields: []zap.Field{Trace("projects/p/traces/abc"), zap.String("user", "u-1")},
+			want: map[string]interface{}{
+				"severity":                     "ERROR",
+				"message":                      "hello",
+				"user":                         "u-1",
+				"logging.googleapis.com/trace": "projects/p/traces/abc",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := captureStderr(t, func() {
+				logger := NewStderr(Config{EncoderConfig: DefaultEncoderConfig()})
+				if tt.level == "error" {
+					logger.Error("hello", tt.fields...)
+				} else {
+					logger.Info("hello", tt.fields...)
+				}
+				_ = logger.Sync()
+			})
+
+			if len(lines) != 1 {
+				t.Fatalf("got %d lines, want 1: %v", len(lines), lines)
+			}
+			for k, v := range tt.want {
+				if lines[0][k] != v {
+					t.Errorf("%s = %#v, want %#v", k, lines[0][k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestStructuredSpecialKeys(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/orders?id=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "test-agent")
+
+	tests := []struct {
+		name  string
+		entry logging.Entry
+		key   string
+		want  interface{}
+	}{
+		{
+			name:  "trace",
+			entry: logging.Entry{Trace: "projects/p/traces/abc"},
+			key:   "logging.googleapis.com/trace",
+			want:  "projects/p/traces/abc",
+		},
+		{
+			name:  "span ID",
+			entry: logging.Entry{SpanID: "000000000000004a"},
+			key:   "logging.googleapis.com/spanId",
+			want:  "000000000000004a",
+		},
+		{
+			name:  "trace sampled",
+			entry: logging.Entry{TraceSampled: true},
+			key:   "logging.googleapis.com/trace_sampled",
+			want:  true,
+		},
+		{
+			name:  "labels",
+			entry: logging.Entry{Labels: map[string]string{"user_id": "42"}},
+			key:   "logging.googleapis.com/labels",
+			want:  map[string]interface{}{"user_id": "42"},
+		},
+		{
+			name: "source location",
+			entry: logging.Entry{SourceLocation: &logpb.LogEntrySourceLocation{
+				File: "main.go", Line: 42, Function: "main.run",
+			}},
+			key:  "logging.googleapis.com/sourceLocation",
+			want: map[string]interface{}{"file": "main.go", "line": "42", "function": "main.run"},
+		},
+		{
+			name:  "insert ID",
+			entry: logging.Entry{InsertID: "id-1"},
+			key:   "logging.googleapis.com/insertId",
+			want:  "id-1",
+		},
+		{
+			name:  "operation",
+			entry: logging.Entry{Operation: &logpb.LogEntryOperation{Id: "op-1", Producer: "gclzap", First: true}},
+			key:   "logging.googleapis.com/operation",
+			want:  map[string]interface{}{"id": "op-1", "producer": "gclzap", "first": true},
+		},
+		{
+			name: "http request",
+			entry: logging.Entry{HTTPRequest: &logging.HTTPRequest{
+				Request: req, Status: 200, ResponseSize: 512, Latency: 1500 * time.Millisecond,
+			}},
+			key: "httpRequest",
+			want: map[string]interface{}{
+				"requestMethod": "GET",
+				"requestUrl":    "https://example.com/orders?id=1",
+				"status":        float64(200),
+				"responseSize":  "512",
+				"userAgent":     "test-agent",
+				"latency":       "1.5s",
+				"protocol":      "HTTP/1.1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.entry.Payload = json.RawMessage(`{"message":"hello"}`)
+			newStructuredSink(zapcore.AddSync(&buf)).Log(tt.entry)
+
+			var line map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("invalid line %s: %v", buf.Bytes(), err)
+			}
+			if !reflect.DeepEqual(line[tt.key], tt.want) {
+				t.Errorf("%s = %#v, want %#v", tt.key, line[tt.key], tt.want)
+			}
+			if line["message"] != "hello" {
+				t.Errorf("message = %#v, want the payload to be kept", line["message"])
+			}
+		})
+	}
+}
+
+func TestStructuredTextPayload(t *testing.T) {
+	var buf bytes.Buffer
+	newStructuredSink(zapcore.AddSync(&buf)).Log(logging.Entry{Payload: "plain", Severity: logging.Warning})
+	if got, want := buf.String(), `{"message":"plain","severity":"WARNING"}`+"\n"; got != want {
+		t.Errorf("line = %s, want %s", got, want)
+	}
+}
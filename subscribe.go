@@ -0,0 +1,90 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"sync"
+
+	"cloud.google.com/go/logging"
+)
+
+// subscriberBuffer is the number of entries buffered per subscriber.
+const subscriberBuffer = 64
+
+// hub fans out written entries to subscribers.
+// Entries are dropped for subscribers whose buffer is full, so that slow
+// subscribers never block writes.
+type hub struct {
+	mu   sync.RWMutex
+	subs map[chan logging.Entry]struct{}
+}
+
+// subscribe registers a new subscriber.
+//
+// Returns:
+// - The channel receiving the entries.
+// - A function that unregisters the subscriber and closes the channel.
+func (h *hub) subscribe() (<-chan logging.Entry, func()) {
+	ch := make(chan logging.Entry, subscriberBuffer)
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[chan logging.Entry]struct{})
+	}
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, ch)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// publish sends the given entry to all subscribers without blocking.
+//
+// Parameters:
+// - entry: The entry to send.
+func (h *hub) publish(entry logging.Entry) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.subs {
+		select {
+		case ch <- entry:
+		default:
+		}
+	}
+}
+
+// Subscribe registers a subscriber that receives every entry written by the Core
+// and its clones, e.g. for a live log viewer. Entries are dropped for a subscriber
+// that does not keep up, so that writes are never blocked.
+//
+// Returns:
+// - The channel receiving the entries.
+// - A function that unsubscribes and closes the channel. It is safe to call multiple times.
+func (c *Core) Subscribe() (<-chan logging.Entry, func()) {
+	return c.hub.subscribe()
+}
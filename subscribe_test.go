@@ -0,0 +1,93 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"strconv"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSubscribe(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes int
+		want   int
+	}{
+		{name: "none"},
+		{name: "receives entries", writes: 3, want: 3},
+		{name: "slow subscriber drops", writes: subscriberBuffer + 10, want: subscriberBuffer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{})
+			entries, unsubscribe := core.Subscribe()
+			clone := core.With([]zapcore.Field{zap.String("component", "clone")})
+
+			for i := 0; i < tt.writes; i++ {
+				if err := clone.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: strconv.Itoa(i)}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			unsubscribe()
+
+			var got int
+			for entry := range entries {
+				if payloadOf(t, entry)["message"] != strconv.Itoa(got) {
+					t.Errorf("entry %d = %v, want entries in write order", got, payloadOf(t, entry)["message"])
+				}
+				got++
+			}
+			if got != tt.want {
+				t.Errorf("received %d entries, want %d", got, tt.want)
+			}
+			if len(out.Entries()) != tt.writes {
+				t.Errorf("wrote %d entries, want %d regardless of the subscriber", len(out.Entries()), tt.writes)
+			}
+		})
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	out := &fakeSink{}
+	core := newCore(out, Config{})
+	first, unsubscribeFirst := core.Subscribe()
+	second, unsubscribeSecond := core.Subscribe()
+	defer unsubscribeSecond()
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := <-first; ok {
+		t.Error("unsubscribed channel received an entry")
+	}
+	if entry := <-second; payloadOf(t, entry)["message"] != "hello" {
+		t.Errorf("entry = %v, want the remaining subscriber to receive it", entry.Payload)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// SugaredCtx is a zap.SugaredLogger whose methods correlate entries with a context,
+// as if the Context field was passed with the key-value pairs.
+type SugaredCtx struct {
+	*zap.SugaredLogger
+	ctx *zap.SugaredLogger
+}
+
+// NewSugaredCtx creates a new SugaredCtx logging with the given logger.
+//
+// Parameters:
+// - logger: The logger to log with.
+//
+// Returns:
+// - A new SugaredCtx.
+func NewSugaredCtx(logger *zap.Logger) *SugaredCtx {
+	return &SugaredCtx{
+		SugaredLogger: logger.Sugar(),
+		ctx:           logger.WithOptions(zap.AddCallerSkip(1)).Sugar(),
+	}
+}
+
+// withContext returns the given key-value pairs preceded by the Context field of the given context.
+// The field comes first, so that an odd number of key-value pairs cannot pair it with a dangling key,
+// and a new slice is allocated, so that the array of the caller is never written to.
+//
+// Parameters:
+// - ctx: The context of the entry.
+// - keysAndValues: The key-value pairs of the entry.
+//
+// Returns:
+// - The key-value pairs including the Context field.
+func withContext(ctx context.Context, keysAndValues []interface{}) []interface{} {
+	args := make([]interface{}, 0, len(keysAndValues)+1)
+	args = append(args, Context(ctx))
+	return append(args, keysAndValues...)
+}
+
+// DebugwCtx logs a message with the given key-value pairs at Debug level,
+// correlated with the given context.
+//
+// Parameters:
+// - ctx: The context of the entry.
+// - msg: The message to log.
+// - keysAndValues: The key-value pairs to add to the entry.
+func (s *SugaredCtx) DebugwCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	s.ctx.Debugw(msg, withContext(ctx, keysAndValues)...)
+}
+
+// InfowCtx logs a message with the given key-value pairs at Info level,
+// correlated with the given context.
+//
+// Parameters:
+// - ctx: The context of the entry.
+// - msg: The message to log.
+// - keysAndValues: The key-value pairs to add to the entry.
+func (s *SugaredCtx) InfowCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	s.ctx.Infow(msg, withContext(ctx, keysAndValues)...)
+}
+
+// WarnwCtx logs a message with the given key-value pairs at Warn level,
+// correlated with the given context.
+//
+// Parameters:
+// - ctx: The context of the entry.
+// - msg: The message to log.
+// - keysAndValues: The key-value pairs to add to the entry.
+func (s *SugaredCtx) WarnwCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	s.ctx.Warnw(msg, withContext(ctx, keysAndValues)...)
+}
+
+// ErrorwCtx logs a message with the given key-value pairs at Error level,
+// correlated with the given context.
+//
+// Parameters:
+// - ctx: The context of the entry.
+// - msg: The message to log.
+// - keysAndValues: The key-value pairs to add to the entry.
+func (s *SugaredCtx) ErrorwCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	s.ctx.Errorw(msg, withContext(ctx, keysAndValues)...)
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/logging"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestSugaredCtx(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex(testTraceID)
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	spanCtx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	fieldsCtx := WithContextFields(spanCtx, zap.String("tenant", "acme"))
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		keysAndValues []interface{}
+		wantTrace     string
+		wantFields    map[string]interface{}
+	}{
+		{name: "no span", ctx: context.Background(), keysAndValues: []interface{}{"user", "alice"}, wantFields: map[string]interface{}{"user": "alice"}},
+		{name: "span", ctx: spanCtx, keysAndValues: []interface{}{"user", "alice"}, wantTrace: testTraceID, wantFields: map[string]interface{}{"user": "alice"}},
+		{
+			name:          "registered fields",
+			ctx:           fieldsCtx,
+			keysAndValues: []interface{}{"user", "alice"},
+			wantTrace:     testTraceID,
+			wantFields:    map[string]interface{}{"user": "alice", "tenant": "acme"},
+		},
+		{name: "odd number of arguments", ctx: spanCtx, keysAndValues: []interface{}{"user", "alice", "dangling"}, wantTrace: testTraceID},
+	}
+
+	levels := []struct {
+		name string
+		log  func(s *SugaredCtx, ctx context.Context, msg string, keysAndValues ...interface{})
+	}{
+		{name: "debug", log: (*SugaredCtx).DebugwCtx},
+		{name: "info", log: (*SugaredCtx).InfowCtx},
+		{name: "warn", log: (*SugaredCtx).WarnwCtx},
+		{name: "error", log: (*SugaredCtx).ErrorwCtx},
+	}
+
+	for _, level := range levels {
+		for _, tt := range tests {
+			t.Run(level.name+"/"+tt.name, func(t *testing.T) {
+				out := &fakeSink{}
+				logger := NewSugaredCtx(zap.New(newCore(out, Config{Level: zap.DebugLevel})))
+
+				// Spare capacity must not be written to.
+				args := make([]interface{}, len(tt.keysAndValues), len(tt.keysAndValues)+1)
+				copy(args, tt.keysAndValues)
+				spare := args[: len(args)+1 : len(args)+1]
+				level.log(logger, tt.ctx, "hello", args...)
+				if spare[len(args)] != nil {
+					t.Errorf("the array of the caller was written to: %v", spare[len(args)])
+				}
+
+				var entry *logging.Entry
+				for _, e := range out.Entries() {
+					if payloadOf(t, e)["message"] == "hello" {
+						e := e
+						entry = &e
+					}
+				}
+				if entry == nil {
+					t.Fatalf("entry not logged: %v", out.Entries())
+				}
+				if entry.Trace != tt.wantTrace {
+					t.Errorf("trace = %q, want %q", entry.Trace, tt.wantTrace)
+				}
+				payload := payloadOf(t, *entry)
+				for k, v := range tt.wantFields {
+					if payload[k] != v {
+						t.Errorf("%s = %#v, want %#v", k, payload[k], v)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Timer measures the time elapsed since it was started.
+// It relies on the monotonic clock, so it is not affected by changes of the wall clock.
+type Timer struct {
+	start time.Time
+}
+
+// StartTimer starts a new Timer.
+//
+// Returns:
+// - The started Timer.
+func StartTimer() Timer {
+	return Timer{start: time.Now()}
+}
+
+// Elapsed returns the time elapsed since the Timer was started.
+//
+// Returns:
+// - The elapsed time.
+func (t Timer) Elapsed() time.Duration {
+	return time.Since(t.start)
+}
+
+// Field returns a zap.Field holding the time elapsed since the Timer was started.
+//
+// Parameters:
+// - key: The key of the field.
+//
+// Returns:
+// - A zap.Field holding the elapsed time.
+func (t Timer) Field(key string) zap.Field {
+	return zap.Duration(key, t.Elapsed())
+}
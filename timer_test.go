@@ -0,0 +1,67 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTimer(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		sleep time.Duration
+	}{
+		{name: "after a pause", key: "duration", sleep: 5 * time.Millisecond},
+		{name: "latency key in seconds", key: "latency", sleep: 5 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timer := StartTimer()
+			time.Sleep(tt.sleep)
+			field := timer.Field(tt.key)
+
+			if field.Type != zapcore.DurationType {
+				t.Fatalf("field type = %v, want a duration", field.Type)
+			}
+			if got := time.Duration(field.Integer); got <= 0 || got < tt.sleep {
+				t.Errorf("duration = %v, want a positive duration of at least %v", got, tt.sleep)
+			}
+			if timer.Elapsed() < time.Duration(field.Integer) {
+				t.Error("elapsed time decreased")
+			}
+
+			out := &fakeSink{}
+			core := newCore(out, Config{EncoderConfig: DefaultEncoderConfig()})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "done"}, []zapcore.Field{field}); err != nil {
+				t.Fatal(err)
+			}
+			if got, ok := payloadOf(t, out.Entries()[0])[tt.key].(float64); !ok || got <= 0 {
+				t.Errorf("%s = %#v, want a positive number", tt.key, got)
+			}
+		})
+	}
+}
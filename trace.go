@@ -0,0 +1,131 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultTraceURLTemplate is a Config.TraceURLTemplate linking to the Cloud Trace console.
+const DefaultTraceURLTemplate = "https://console.cloud.google.com/traces/list?project={project}&tid={trace}"
+
+// cloudTraceHeader is the header carrying the trace context on Google Cloud,
+// in the format "TRACE_ID/SPAN_ID;o=OPTIONS".
+const cloudTraceHeader = "X-Cloud-Trace-Context"
+
+// ParseCloudTraceHeader parses the value of the X-Cloud-Trace-Context header
+// injected by the Google Cloud load balancer, e.g. "TRACE_ID/SPAN_ID;o=1".
+// The decimal span ID of the header is converted to the 16 digit hexadecimal
+// form expected by Google Cloud Logging. Malformed headers are reported as not ok.
+//
+// Parameters:
+// - h: The value of the header.
+//
+// Returns:
+// - The trace ID.
+// - The span ID, or an empty string if the header carries none.
+// - Whether the trace is sampled.
+// - Whether the header could be parsed.
+func ParseCloudTraceHeader(h string) (trace, span string, sampled, ok bool) {
+	h = strings.TrimSpace(h)
+	rest, options, _ := strings.Cut(h, ";")
+	trace, spanID, hasSpan := strings.Cut(rest, "/")
+	if !isHex(trace) || len(trace) != 32 {
+		return "", "", false, false
+	}
+	if hasSpan && spanID != "" {
+		id, err := strconv.ParseUint(spanID, 10, 64)
+		if err != nil {
+			return "", "", false, false
+		}
+		span = fmt.Sprintf("%016x", id)
+	}
+	sampled = options == "o=1"
+
+	return trace, span, sampled, true
+}
+
+// isHex reports whether the given string is a non-empty hexadecimal string.
+//
+// Parameters:
+// - s: The string to check.
+//
+// Returns:
+// - True if the string only consists of hexadecimal digits, false otherwise.
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// qualifyTrace returns the full resource name of the given trace in the given project.
+// Traces that are already qualified, or that cannot be qualified without a project, are returned unchanged.
+//
+// Parameters:
+// - projectID: The ID of the project, may be empty.
+// - trace: The trace ID or resource name.
+//
+// Returns:
+// - The full resource name of the trace.
+func qualifyTrace(projectID, trace string) string {
+	if projectID == "" || trace == "" || strings.HasPrefix(trace, "projects/") {
+		return trace
+	}
+
+	return "projects/" + projectID + "/traces/" + trace
+}
+
+// traceURL formats the given template with the project and ID of the given trace.
+// The placeholders "{project}" and "{trace}" are replaced by the escaped project ID and trace ID.
+//
+// Parameters:
+// - template: The URL template.
+// - trace: The full resource name of the trace, "projects/<project>/traces/<trace>".
+//
+// Returns:
+// - The formatted URL.
+// - Whether the trace could be split into its project and ID.
+func traceURL(template, trace string) (string, bool) {
+	rest, ok := strings.CutPrefix(trace, "projects/")
+	if !ok {
+		return "", false
+	}
+	project, id, ok := strings.Cut(rest, "/traces/")
+	if !ok || project == "" || id == "" {
+		return "", false
+	}
+
+	return strings.NewReplacer(
+		"{project}", url.QueryEscape(project),
+		"{trace}", url.QueryEscape(id),
+	).Replace(template), true
+}
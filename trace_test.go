@@ -0,0 +1,157 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// testTraceID is a valid trace ID used by the tests.
+const testTraceID = "105445aa7843bc8bf206b12000100000"
+
+func TestParseCloudTraceHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		wantTrace   string
+		wantSpan    string
+		wantSampled bool
+		wantOK      bool
+	}{
+		{name: "sampled", header: testTraceID + "/1;o=1", wantTrace: testTraceID, wantSpan: "0000000000000001", wantSampled: true, wantOK: true},
+		{name: "unsampled", header: testTraceID + "/255;o=0", wantTrace: testTraceID, wantSpan: "00000000000000ff", wantOK: true},
+		{name: "no options", header: testTraceID + "/18446744073709551615", wantTrace: testTraceID, wantSpan: "ffffffffffffffff", wantOK: true},
+		{name: "no span", header: testTraceID + ";o=1", wantTrace: testTraceID, wantSampled: true, wantOK: true},
+		{name: "empty span", header: testTraceID + "/;o=1", wantTrace: testTraceID, wantSampled: true, wantOK: true},
+		{name: "surrounding spaces", header: "  " + testTraceID + "/1;o=1 ", wantTrace: testTraceID, wantSpan: "0000000000000001", wantSampled: true, wantOK: true},
+		{name: "empty", header: ""},
+		{name: "short trace", header: "abc/1;o=1"},
+		{name: "non-hex trace", header: "zz5445aa7843bc8bf206b12000100000/1;o=1"},
+		{name: "non-decimal span", header: testTraceID + "/abc;o=1"},
+		{name: "span overflow", header: testTraceID + "/18446744073709551616"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace, span, sampled, ok := ParseCloudTraceHeader(tt.header)
+			if trace != tt.wantTrace || span != tt.wantSpan || sampled != tt.wantSampled || ok != tt.wantOK {
+				t.Errorf("ParseCloudTraceHeader(%q) = %q, %q, %v, %v, want %q, %q, %v, %v",
+					tt.header, trace, span, sampled, ok, tt.wantTrace, tt.wantSpan, tt.wantSampled, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTraceSampled(t *testing.T) {
+	tests := []struct {
+		name   string
+		with   []zapcore.Field
+		fields []zapcore.Field
+		want   bool
+	}{
+		{name: "none"},
+		{name: "sampled", fields: []zapcore.Field{TraceSampled(true)}, want: true},
+		{name: "inherited", with: []zapcore.Field{TraceSampled(true)}, want: true},
+		{name: "entry field wins", with: []zapcore.Field{TraceSampled(true)}, fields: []zapcore.Field{TraceSampled(false)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{}).With(tt.with)
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hello"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if entry.TraceSampled != tt.want {
+				t.Errorf("trace sampled = %v, want %v", entry.TraceSampled, tt.want)
+			}
+			if _, ok := payloadOf(t, entry)["trace_sampled"]; ok {
+				t.Error("trace sampled field written to the payload")
+			}
+		})
+	}
+}
+
+func TestTraceURL(t *testing.T) {
+	qualified := "projects/my-project/traces/" + testTraceID
+
+	tests := []struct {
+		name      string
+		template  string
+		projectID string
+		level     zapcore.Level
+		fields    []zapcore.Field
+		want      interface{}
+	}{
+		{
+			name:     "default template",
+			template: DefaultTraceURLTemplate,
+			level:    zapcore.ErrorLevel,
+			fields:   []zapcore.Field{Trace(qualified)},
+			want:     "https://console.cloud.google.com/traces/list?project=my-project&tid=" + testTraceID,
+		},
+		{
+			name:      "bare trace qualified with the project",
+			template:  DefaultTraceURLTemplate,
+			projectID: "other-project",
+			level:     zapcore.DPanicLevel,
+			fields:    []zapcore.Field{Trace(testTraceID)},
+			want:      "https://console.cloud.google.com/traces/list?project=other-project&tid=" + testTraceID,
+		},
+		{
+			name:     "custom template",
+			template: "https://traces.example.com/{project}/{trace}",
+			level:    zapcore.ErrorLevel,
+			fields:   []zapcore.Field{Trace(qualified)},
+			want:     "https://traces.example.com/my-project/" + testTraceID,
+		},
+		{
+			name:     "placeholders escaped",
+			template: "https://traces.example.com/?p={project}",
+			level:    zapcore.ErrorLevel,
+			fields:   []zapcore.Field{Trace("projects/a&b/traces/" + testTraceID)},
+			want:     "https://traces.example.com/?p=a%26b",
+		},
+		{name: "below error level", template: DefaultTraceURLTemplate, level: zapcore.WarnLevel, fields: []zapcore.Field{Trace(qualified)}},
+		{name: "no trace", template: DefaultTraceURLTemplate, level: zapcore.ErrorLevel},
+		{name: "bare trace without project", template: DefaultTraceURLTemplate, level: zapcore.ErrorLevel, fields: []zapcore.Field{Trace(testTraceID)}},
+		{name: "disabled", level: zapcore.ErrorLevel, fields: []zapcore.Field{Trace(qualified)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{TraceURLTemplate: tt.template, ProjectID: tt.projectID})
+			if err := core.Write(zapcore.Entry{Level: tt.level, Message: "failed"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := payloadOf(t, out.Entries()[0])["trace_url"]; got != tt.want {
+				t.Errorf("trace_url = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"sort"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// userIDLabelKey is the key of the label holding the user identifier.
+const userIDLabelKey = "user_id"
+
+// userIdentity is the value of a field created by User.
+type userIdentity struct {
+	id    string
+	attrs map[string]string
+}
+
+// apply sets the user identity on the entry metadata.
+//
+// Parameters:
+// - key: The key of the field, unused.
+// - meta: The entry metadata.
+func (u *userIdentity) apply(_ string, meta *entryMeta) {
+	meta.identity = u
+}
+
+// MarshalLogObject encodes the user identity as an object.
+// The attributes are encoded in key order for a deterministic payload.
+//
+// Parameters:
+// - enc: The object encoder.
+//
+// Returns:
+// - An error if the identity could not be encoded, nil otherwise.
+func (u *userIdentity) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("id", u.id)
+	keys := make([]string, 0, len(u.attrs))
+	for k := range u.attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		enc.AddString(k, u.attrs[k])
+	}
+
+	return nil
+}
+
+// User returns a zap.Field that identifies the user on whose behalf the entry is logged,
+// e.g. for audit trails. The identity is written as a nested "user" object holding the
+// id and the given attributes. If Config.UserIDLabel is set, the id is also attached
+// as the "user_id" label for filtering. The id is used as the user of the
+// Error Reporting context object unless ErrorContext sets one.
+//
+// Parameters:
+// - id: The identifier of the user.
+// - attrs: Additional attributes of the user, e.g. the email or role, may be nil.
+//
+// Returns:
+// - A zap.Field that identifies the user.
+func User(id string, attrs map[string]string) zap.Field {
+	copied := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		copied[k] = v
+	}
+
+	return special("user", &userIdentity{id: id, attrs: copied})
+}
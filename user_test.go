@@ -0,0 +1,92 @@
+// Copyright (c) 2024 Felix Kahle.
+
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be
+// included in all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+// LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+// OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+// WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gclzap
+
+import (
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestUser(t *testing.T) {
+	tests := []struct {
+		name        string
+		userIDLabel bool
+		fields      []zapcore.Field
+		wantUser    interface{}
+		wantLabel   string
+	}{
+		{name: "none", userIDLabel: true},
+		{
+			name:     "nested object",
+			fields:   []zapcore.Field{User("u-42", map[string]string{"role": "admin", "email": "a@example.com"})},
+			wantUser: map[string]interface{}{"id": "u-42", "role": "admin", "email": "a@example.com"},
+		},
+		{
+			name:        "object and label",
+			userIDLabel: true,
+			fields:      []zapcore.Field{User("u-42", nil)},
+			wantUser:    map[string]interface{}{"id": "u-42"},
+			wantLabel:   "u-42",
+		},
+		{
+			name:        "empty id is not labeled",
+			userIDLabel: true,
+			fields:      []zapcore.Field{User("", map[string]string{"role": "anonymous"})},
+			wantUser:    map[string]interface{}{"id": "", "role": "anonymous"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &fakeSink{}
+			core := newCore(out, Config{UserIDLabel: tt.userIDLabel})
+			if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "role granted"}, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := out.Entries()[0]
+			if got := payloadOf(t, entry)["user"]; !reflect.DeepEqual(got, tt.wantUser) {
+				t.Errorf("user = %#v, want %#v", got, tt.wantUser)
+			}
+			if got := entry.Labels[userIDLabelKey]; got != tt.wantLabel {
+				t.Errorf("user_id label = %q, want %q", got, tt.wantLabel)
+			}
+		})
+	}
+}
+
+func TestUserCopiesAttributes(t *testing.T) {
+	attrs := map[string]string{"role": "admin"}
+	field := User("u-42", attrs)
+	attrs["role"] = "viewer"
+
+	out := &fakeSink{}
+	if err := newCore(out, Config{}).Write(zapcore.Entry{Level: zapcore.InfoLevel}, []zapcore.Field{field}); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := payloadOf(t, out.Entries()[0])["user"].(map[string]interface{})
+	if user["role"] != "admin" {
+		t.Errorf("role = %#v, want the attributes at the time the field was created", user["role"])
+	}
+}